@@ -6,6 +6,7 @@ package main
 import (
 	"fmt"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/react"
+	proxy "github.com/QubitPi/packer-plugin-qubitpi/provisioner/reverse-proxy"
 	artifactory "github.com/QubitPi/packer-plugin-qubitpi/provisioner/sonatype-nexus-repository"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/webservice"
 	"os"
@@ -24,6 +25,8 @@ func main() {
 	pps.RegisterProvisioner("sonatype-nexus-repository-provisioner", new(artifactory.Provisioner))
 	pps.RegisterProvisioner("webservice-provisioner", new(webservice.Provisioner))
 	pps.RegisterProvisioner("react-provisioner", new(react.Provisioner))
+	pps.RegisterProvisioner("static-site-provisioner", new(react.StaticSiteProvisioner))
+	pps.RegisterProvisioner("reverse-proxy-provisioner", new(proxy.Provisioner))
 	pps.SetVersion(pluginVersion.PluginVersion)
 	err := pps.Run()
 	if err != nil {
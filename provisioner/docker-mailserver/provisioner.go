@@ -8,7 +8,6 @@ package mailserver
 import (
 	"context"
 	"fmt"
-	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/file-provisioner"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/shell"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
 	"github.com/hashicorp/hcl/v2/hcldec"
@@ -52,29 +51,29 @@ func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, communicat
 
 	composeFile := strings.Replace(getDockerComposeFileTemplate(), "mail.domain.com", mailServerDomain, -1)
 	composeFileDst := fmt.Sprintf(filepath.Join(p.config.HomeDir, "compose.yaml"))
-	composeFileSource, err := ssl.WriteToFile(composeFile)
-	err = file.Provision(p.config.ctx, ui, communicator, composeFileSource, composeFileDst)
+	err := ssl.Upload(p.config.ctx, ui, communicator, composeFile, composeFileDst)
 	if err != nil {
-		ui.Say(fmt.Sprintf("error uploading '%s' to '%s': %s", composeFileSource, composeFileDst, err))
-		panic(err)
+		return err
 	}
 
 	sslCert, err := ssl.DecodeBase64(p.config.SslCertBase64)
-	sslCertSource, err := ssl.WriteToFile(sslCert)
+	if err != nil {
+		return err
+	}
 	sslCertDestination := fmt.Sprintf(filepath.Join(p.config.HomeDir, "fullchain.pem"))
-	err = file.Provision(p.config.ctx, ui, communicator, sslCertSource, sslCertDestination)
+	err = ssl.Upload(p.config.ctx, ui, communicator, sslCert, sslCertDestination)
 	if err != nil {
-		ui.Say(fmt.Sprintf("error uploading '%s' to '%s': %s", sslCertSource, sslCertDestination, err))
-		panic(err)
+		return err
 	}
 
 	sslCertKey, err := ssl.DecodeBase64(p.config.SslCertKeyBase64)
-	sslCertKeySource, err := ssl.WriteToFile(sslCertKey)
-	sslCertKeyDestination := fmt.Sprintf(filepath.Join(p.config.HomeDir, "privkey.pem"))
-	err = file.Provision(p.config.ctx, ui, communicator, sslCertKeySource, sslCertKeyDestination)
 	if err != nil {
-		ui.Say(fmt.Sprintf("error uploading '%s' to '%s': %s", sslCertKeySource, sslCertKeyDestination, err))
-		panic(err)
+		return err
+	}
+	sslCertKeyDestination := ssl.PrivateStagingPath("privkey.pem")
+	err = ssl.UploadPrivate(ctx, ui, communicator, sslCertKey, filepath.Base(sslCertKeyDestination))
+	if err != nil {
+		return err
 	}
 
 	return shell.Provision(ctx, ui, communicator, getCommands(p.config.HomeDir, mailServerDomain, sslCertDestination, sslCertKeyDestination))
@@ -115,12 +114,18 @@ services:
 func getCommands(homeDir string, domain string, sslCertDestination string, sslCertKeyDestination string) []string {
 	certsDir := filepath.Join(homeDir, fmt.Sprintf("docker-data/certbot/certs/live/%s", domain))
 
+	sslCertKeyInstalled := filepath.Join(certsDir, "privkey.pem")
+
 	return append(
-		shell.CommandsInstallingSudoLessDocker(),
+		append(
+			[]string{shell.CommandCleaningUpOnExit(fmt.Sprintf("if [ -e %s ]; then sudo shred -u %s; fi", sslCertKeyDestination, sslCertKeyDestination))},
+			shell.CommandsInstallingSudoLessDocker()...,
+		),
 		[]string{
 			fmt.Sprintf("sudo mkdir -p %s", certsDir),
 			fmt.Sprintf("sudo mv %s %s", sslCertDestination, certsDir),
-			fmt.Sprintf("sudo mv %s %s", sslCertKeyDestination, certsDir),
+			ssl.CommandInstallingPrivateFile(sslCertKeyDestination, sslCertKeyInstalled, "root", "600"),
+			ssl.CommandCheckingPermissions(sslCertKeyInstalled, "root", "600"),
 
 			"wget \"https://raw.githubusercontent.com/docker-mailserver/docker-mailserver/master/mailserver.env\"",
 		}...,
@@ -6,23 +6,27 @@
 package gateway
 
 import (
-	"bytes"
 	"context"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/shell"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
-	"text/template"
 )
 
+// PORT Default proxy port of Kong API gateway
+const PORT string = "8000"
+
 type Config struct {
 	SslCertBase64        string `mapstructure:"sslCertBase64" required:"true"`
 	SslCertKeyBase64     string `mapstructure:"sslCertKeyBase64" required:"true"`
 	KongApiGatewayDomain string `mapstructure:"kongApiGatewayDomain" required:"true"`
 	HomeDir              string `mapstructure:"homeDir" required:"false"`
 
+	ssl.Config `mapstructure:",squash"`
+
 	ctx interpolate.Context
 }
 
@@ -40,7 +44,13 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		return err
 	}
 
-	return nil
+	err = p.config.Config.Validate()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.config.NginxConfig(p.config.KongApiGatewayDomain, PORT, getNginxConfig(p.config.KongApiGatewayDomain, p.config.Config))
+	return err
 }
 
 func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, communicator packersdk.Communicator, generatedData map[string]interface{}) error {
@@ -50,15 +60,23 @@ func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, communicat
 		return err
 	}
 
+	nginxConfig, err := p.config.NginxConfig(p.config.KongApiGatewayDomain, PORT, getNginxConfig(p.config.KongApiGatewayDomain, p.config.Config))
+	if err != nil {
+		return err
+	}
+
 	return ssl.Provision(
 		ctx,
 		p.config.ctx,
 		ui,
 		communicator,
 		p.config.HomeDir,
+		ssl.Owner("kong-api-gateway-provisioner", generatedData),
+		p.config.KongApiGatewayDomain,
 		p.config.SslCertBase64,
 		p.config.SslCertKeyBase64,
-		getNginxConfig(p.config.KongApiGatewayDomain),
+		p.config.Config,
+		nginxConfig,
 	)
 }
 
@@ -66,102 +84,69 @@ func getCommands() []string {
 	return append(shell.CommandsInstallingSudoLessDocker(), []string{"git clone https://github.com/QubitPi/docker-kong.git"}...)
 }
 
-func getNginxConfig(domain string) string {
-	var sslConfigs = struct {
-		Domain        string
-		SslCertDst    string
-		SslCertKeyDst string
-	}{domain, ssl.SslCertDst, ssl.SslCertKeyDst}
-	var buf bytes.Buffer
-	t := template.Must(template.New("Nginx Config").Parse(`
-server {
-    listen 80 default_server;
-    listen [::]:80 default_server;
-
-    root /var/www/html;
-
-    index index.html index.htm index.nginx-debian.html;
-
-    server_name _;
-
-    location / {
-        try_files $uri $uri/ =404;
-    }
-}
-
-server {
-    root /var/www/html;
-
-    index index.html index.htm index.nginx-debian.html;
-    server_name {{.Domain}};
-
-    location / {
-        if ($request_method = 'OPTIONS') {
-            add_header 'Access-Control-Allow-Origin'  '*';
-            add_header 'Access-Control-Allow-Methods' 'GET, POST, OPTIONS, HEAD';
-            add_header 'Access-Control-Allow-Headers' 'Authorization, Origin, X-Requested-With, Content-Type, Accept';
-
-            return 200;
-        }
-
-        if ($request_method ~* '(GET|POST)') {
-            add_header 'Access-Control-Allow-Origin' '*';
-        }
-
-        proxy_pass http://localhost:8000;
-    }
-
-    listen [::]:443 ssl ipv6only=on;
-    listen 443 ssl;
-    ssl_certificate {{.SslCertDst}};
-    ssl_certificate_key {{.SslCertKeyDst}};
-}
-server {
-    if ($host = {{.Domain}}) {
-        return 301 https://$host$request_uri;
-    }
-
-    listen 80 ;
-    listen [::]:80 ;
-    server_name {{.Domain}};
-    return 404;
-}
-
-server {
-    root /var/www/html;
-
-    index index.html index.htm index.nginx-debian.html;
-    server_name {{.Domain}};
-
-    location / {
-        proxy_pass http://localhost:8001;
-    }
-
-    listen [::]:8444 ssl ipv6only=on;
-    listen 8444 ssl;
-    ssl_certificate {{.SslCertDst}};
-    ssl_certificate_key {{.SslCertKeyDst}};
+func getNginxConfig(domain string, sslConfig ssl.Config) nginx.Config {
+	tls := ssl.NginxTls(domain)
+
+	return nginx.Config{
+		Servers: []nginx.Server{
+			{
+				Listens:     nginx.SslListens("443"),
+				ServerNames: []string{domain},
+				Root:        nginx.DefaultRoot,
+				Index:       nginx.DefaultIndex,
+				TLS:         tls,
+				Locations: []nginx.Location{
+					{Path: "/", Directives: getCorsDirectives(), Proxy: sslConfig.ProxyWithDefaults(nginx.Proxy{}), ProxyPass: "http://localhost:" + PORT},
+				},
+			},
+			nginx.RedirectServer(domain),
+			{
+				Listens:     nginx.SslListens("8444"),
+				ServerNames: []string{domain},
+				Root:        nginx.DefaultRoot,
+				Index:       nginx.DefaultIndex,
+				TLS:         tls,
+				Locations: []nginx.Location{
+					{Path: "/", Proxy: sslConfig.ProxyWithDefaults(adminProxy), ProxyPass: "http://localhost:8001"},
+				},
+			},
+			{
+				Listens:     nginx.SslListens("8445"),
+				ServerNames: []string{domain},
+				Root:        nginx.DefaultRoot,
+				Index:       nginx.DefaultIndex,
+				TLS:         tls,
+				Locations: []nginx.Location{
+					{Path: "/", Proxy: sslConfig.ProxyWithDefaults(adminProxy), ProxyPass: "http://localhost:8002"},
+				},
+			},
+		},
+	}
 }
-server {
-    root /var/www/html;
-
-    index index.html index.htm index.nginx-debian.html;
-    server_name {{.Domain}};
 
-    location / {
-        proxy_pass http://localhost:8002;
-    }
-
-    listen [::]:8445 ssl ipv6only=on;
-    listen 8445 ssl;
-    ssl_certificate {{.SslCertDst}};
-    ssl_certificate_key {{.SslCertKeyDst}};
+// Admin API calls, such as bulk config imports, can take much longer than regular proxied requests, unless the proxy
+// settings in HCL say otherwise
+var adminProxy = nginx.Proxy{
+	ConnectTimeout: "60s",
+	SendTimeout:    "600s",
+	ReadTimeout:    "600s",
 }
-	`))
 
-	if err := t.Execute(&buf, sslConfigs); err != nil {
-		panic(err)
+// Allows cross-origin requests to the proxy port of the gateway
+func getCorsDirectives() []nginx.Directive {
+	return []nginx.Directive{
+		nginx.NewBlock(
+			"if",
+			[]string{"($request_method = 'OPTIONS')"},
+			nginx.NewDirective("add_header", "'Access-Control-Allow-Origin'", "'*'"),
+			nginx.NewDirective("add_header", "'Access-Control-Allow-Methods'", "'GET, POST, OPTIONS, HEAD'"),
+			nginx.NewDirective("add_header", "'Access-Control-Allow-Headers'", "'Authorization, Origin, X-Requested-With, Content-Type, Accept'"),
+			nginx.NewDirective("return", "200"),
+		),
+		nginx.NewBlock(
+			"if",
+			[]string{"($request_method ~* '(GET|POST)')"},
+			nginx.NewDirective("add_header", "'Access-Control-Allow-Origin'", "'*'"),
+		),
 	}
-
-	return buf.String()
 }
@@ -3,6 +3,7 @@
 package gateway
 
 import (
+	ssl "github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -10,10 +11,28 @@ import (
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
-	SslCertBase64        *string `mapstructure:"sslCertBase64" required:"true" cty:"sslCertBase64" hcl:"sslCertBase64"`
-	SslCertKeyBase64     *string `mapstructure:"sslCertKeyBase64" required:"true" cty:"sslCertKeyBase64" hcl:"sslCertKeyBase64"`
-	KongApiGatewayDomain *string `mapstructure:"kongApiGatewayDomain" required:"true" cty:"kongApiGatewayDomain" hcl:"kongApiGatewayDomain"`
-	HomeDir              *string `mapstructure:"homeDir" required:"false" cty:"homeDir" hcl:"homeDir"`
+	SslCertBase64        *string              `mapstructure:"sslCertBase64" required:"true" cty:"sslCertBase64" hcl:"sslCertBase64"`
+	SslCertKeyBase64     *string              `mapstructure:"sslCertKeyBase64" required:"true" cty:"sslCertKeyBase64" hcl:"sslCertKeyBase64"`
+	KongApiGatewayDomain *string              `mapstructure:"kongApiGatewayDomain" required:"true" cty:"kongApiGatewayDomain" hcl:"kongApiGatewayDomain"`
+	HomeDir              *string              `mapstructure:"homeDir" required:"false" cty:"homeDir" hcl:"homeDir"`
+	ProxyBackend         *string              `mapstructure:"proxyBackend" required:"false" cty:"proxyBackend" hcl:"proxyBackend"`
+	TlsProfile           *string              `mapstructure:"tlsProfile" required:"false" cty:"tlsProfile" hcl:"tlsProfile"`
+	HstsPreload          *bool                `mapstructure:"hstsPreload" required:"false" cty:"hstsPreload" hcl:"hstsPreload"`
+	OcspStapling         *bool                `mapstructure:"ocspStapling" required:"false" cty:"ocspStapling" hcl:"ocspStapling"`
+	Resolver             *string              `mapstructure:"resolver" required:"false" cty:"resolver" hcl:"resolver"`
+	NginxTemplate        *string              `mapstructure:"nginxTemplate" required:"false" cty:"nginxTemplate" hcl:"nginxTemplate"`
+	NginxTemplateVars    map[string]string    `mapstructure:"nginxTemplateVars" required:"false" cty:"nginxTemplateVars" hcl:"nginxTemplateVars"`
+	ProxyConnectTimeout  *string              `mapstructure:"proxyConnectTimeout" required:"false" cty:"proxyConnectTimeout" hcl:"proxyConnectTimeout"`
+	ProxySendTimeout     *string              `mapstructure:"proxySendTimeout" required:"false" cty:"proxySendTimeout" hcl:"proxySendTimeout"`
+	ProxyReadTimeout     *string              `mapstructure:"proxyReadTimeout" required:"false" cty:"proxyReadTimeout" hcl:"proxyReadTimeout"`
+	ProxyBuffering       *bool                `mapstructure:"proxyBuffering" required:"false" cty:"proxyBuffering" hcl:"proxyBuffering"`
+	ProxyWebSocket       *bool                `mapstructure:"proxyWebSocket" required:"false" cty:"proxyWebSocket" hcl:"proxyWebSocket"`
+	ClientMaxBodySize    *string              `mapstructure:"clientMaxBodySize" required:"false" cty:"clientMaxBodySize" hcl:"clientMaxBodySize"`
+	SecurityHeaders      map[string]string    `mapstructure:"securityHeaders" required:"false" cty:"securityHeaders" hcl:"securityHeaders"`
+	RateLimit            *string              `mapstructure:"rateLimit" required:"false" cty:"rateLimit" hcl:"rateLimit"`
+	RateLimitBurst       *string              `mapstructure:"rateLimitBurst" required:"false" cty:"rateLimitBurst" hcl:"rateLimitBurst"`
+	AccessRules          []ssl.FlatAccessRule `mapstructure:"accessRule" required:"false" cty:"accessRule" hcl:"accessRule"`
+	ClientCaBase64       *string              `mapstructure:"clientCaBase64" required:"false" cty:"clientCaBase64" hcl:"clientCaBase64"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -32,6 +51,24 @@ func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 		"sslCertKeyBase64":     &hcldec.AttrSpec{Name: "sslCertKeyBase64", Type: cty.String, Required: false},
 		"kongApiGatewayDomain": &hcldec.AttrSpec{Name: "kongApiGatewayDomain", Type: cty.String, Required: false},
 		"homeDir":              &hcldec.AttrSpec{Name: "homeDir", Type: cty.String, Required: false},
+		"proxyBackend":         &hcldec.AttrSpec{Name: "proxyBackend", Type: cty.String, Required: false},
+		"tlsProfile":           &hcldec.AttrSpec{Name: "tlsProfile", Type: cty.String, Required: false},
+		"hstsPreload":          &hcldec.AttrSpec{Name: "hstsPreload", Type: cty.Bool, Required: false},
+		"ocspStapling":         &hcldec.AttrSpec{Name: "ocspStapling", Type: cty.Bool, Required: false},
+		"resolver":             &hcldec.AttrSpec{Name: "resolver", Type: cty.String, Required: false},
+		"nginxTemplate":        &hcldec.AttrSpec{Name: "nginxTemplate", Type: cty.String, Required: false},
+		"nginxTemplateVars":    &hcldec.AttrSpec{Name: "nginxTemplateVars", Type: cty.Map(cty.String), Required: false},
+		"proxyConnectTimeout":  &hcldec.AttrSpec{Name: "proxyConnectTimeout", Type: cty.String, Required: false},
+		"proxySendTimeout":     &hcldec.AttrSpec{Name: "proxySendTimeout", Type: cty.String, Required: false},
+		"proxyReadTimeout":     &hcldec.AttrSpec{Name: "proxyReadTimeout", Type: cty.String, Required: false},
+		"proxyBuffering":       &hcldec.AttrSpec{Name: "proxyBuffering", Type: cty.Bool, Required: false},
+		"proxyWebSocket":       &hcldec.AttrSpec{Name: "proxyWebSocket", Type: cty.Bool, Required: false},
+		"clientMaxBodySize":    &hcldec.AttrSpec{Name: "clientMaxBodySize", Type: cty.String, Required: false},
+		"securityHeaders":      &hcldec.AttrSpec{Name: "securityHeaders", Type: cty.Map(cty.String), Required: false},
+		"rateLimit":            &hcldec.AttrSpec{Name: "rateLimit", Type: cty.String, Required: false},
+		"rateLimitBurst":       &hcldec.AttrSpec{Name: "rateLimitBurst", Type: cty.String, Required: false},
+		"accessRule":           &hcldec.BlockListSpec{TypeName: "accessRule", Nested: hcldec.ObjectSpec((*ssl.FlatAccessRule)(nil).HCL2Spec())},
+		"clientCaBase64":       &hcldec.AttrSpec{Name: "clientCaBase64", Type: cty.String, Required: false},
 	}
 	return s
 }
@@ -0,0 +1,38 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package gateway
+
+import (
+	_ "embed"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"reflect"
+	"testing"
+)
+
+//go:embed test-fixtures/nginx-ssl.conf
+var expectedNginxConfig string
+
+func Test_getNginxConfig(t *testing.T) {
+	actualNginxConfig := getNginxConfig("api.mycompany.com", ssl.Config{}).Render()
+
+	if actualNginxConfig != expectedNginxConfig {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expectedNginxConfig, actualNginxConfig)
+	}
+}
+
+func Test_getNginxConfigWithProxySettings(t *testing.T) {
+	nginxConfig := getNginxConfig("api.mycompany.com", ssl.Config{ProxyReadTimeout: "30s"})
+
+	expected := &nginx.Proxy{ConnectTimeout: "60s", SendTimeout: "600s", ReadTimeout: "30s"}
+	for _, server := range nginxConfig.Servers[2:] {
+		if actual := server.Locations[0].Proxy; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Expected the timeout in HCL to override the one of the admin port %v: %v, got %v", server.Listens, expected, actual)
+		}
+	}
+
+	if actual := nginxConfig.Servers[0].Locations[0].Proxy; !reflect.DeepEqual(&nginx.Proxy{ReadTimeout: "30s"}, actual) {
+		t.Errorf("Expected the timeout in HCL on the proxy port, got %v", actual)
+	}
+}
@@ -0,0 +1,423 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+// Package nginx models an Nginx site configuration, i.e. its upstreams, server blocks, listeners, locations and TLS
+// settings, as Go types and renders them into Nginx config file syntax.
+//
+// Rendering is deterministic: everything is emitted in the order it is declared in the model with a 4-space
+// indentation, so that a given model always produces byte-identical output
+package nginx
+
+import (
+	"fmt"
+	"strings"
+)
+
+const indentation string = "    "
+
+// DefaultRoot is the web root that ships with the Nginx package on Ubuntu
+const DefaultRoot string = "/var/www/html"
+
+// DefaultIndex is the list of index files that ships with the Nginx package on Ubuntu
+var DefaultIndex = []string{"index.html", "index.htm", "index.nginx-debian.html"}
+
+// Config is the top-level model of an Nginx site config file
+type Config struct {
+	// HttpDirectives are the directives of the enclosing "http" context, such as "limit_req_zone", which are rendered
+	// before anything else
+	HttpDirectives []Directive
+
+	Upstreams []Upstream
+	Servers   []Server
+
+	// Directives are rendered as-is after the upstreams and servers, e.g. the directives Parse()d from a custom config
+	Directives []Directive
+}
+
+// Upstream models an "upstream" block, i.e. a named group of backend servers that a location can proxy_pass to
+type Upstream struct {
+	Name    string
+	Servers []string
+}
+
+// Server models a "server" block
+type Server struct {
+	Listens     []Listen
+	ServerNames []string
+	Root        string
+	Index       []string
+	TLS         *TLS
+
+	// Directives are rendered after the TLS settings and before the locations. Since rewrite directives, such as "if"
+	// and "return", are executed in the order they appear, the order of this list is preserved as-is
+	Directives []Directive
+	Locations  []Location
+}
+
+// Listen models a single "listen" directive
+type Listen struct {
+	Port          string
+	IPv6          bool
+	SSL           bool
+	HTTP2         bool
+	DefaultServer bool
+	IPv6Only      bool
+}
+
+// TLS models the certificate and protocol settings of an SSL-enabled server block. Except for the certificate pair,
+// every setting is optional and is left to the Nginx default when empty
+type TLS struct {
+	Certificate    string
+	CertificateKey string
+
+	Protocols           []string
+	ECDHCurve           string
+	Ciphers             string
+	PreferServerCiphers string
+	DHParam             string
+	SessionTimeout      string
+	SessionCache        string
+	SessionTickets      string
+
+	// Stapling turns on OCSP stapling, which needs a Resolver to look up the OCSP responder of the certificate issuer
+	Stapling bool
+	Resolver string
+
+	// HSTS is the value of the "Strict-Transport-Security" response header, e.g. "max-age=63072000"
+	HSTS string
+
+	// ClientCertificate is the CA bundle that client certificates are verified against when VerifyClient is "on" or
+	// "optional"
+	ClientCertificate string
+	VerifyClient      string
+}
+
+// Location models a "location" block
+type Location struct {
+	Path      string
+	TryFiles  []string
+	ProxyPass string
+
+	// Proxy is rendered right before "proxy_pass"; it has no effect without ProxyPass
+	Proxy *Proxy
+
+	// Directives are rendered before "try_files" and "proxy_pass"
+	Directives []Directive
+}
+
+// Proxy models how a location proxy_passes requests to its upstream. The Host, X-Real-IP, X-Forwarded-For and
+// X-Forwarded-Proto headers are always passed to the upstream; all other settings are left to the Nginx default when
+// empty
+type Proxy struct {
+	ConnectTimeout    string
+	SendTimeout       string
+	ReadTimeout       string
+	Buffering         string
+	ClientMaxBodySize string
+
+	// WebSocket, if set to true, passes the "Upgrade" header to the upstream over HTTP/1.1 so that WebSocket connections
+	// are proxied. The "Connection" header is taken from the variable of ConnectionUpgradeMap(), which the "http" context
+	// must define. It is a pointer so that an explicit false can override a default of true
+	WebSocket *bool
+}
+
+// Directive is a single Nginx directive, such as "return 404;". Args are rendered verbatim, i.e. the caller is
+// responsible for quoting. A directive with non-nil Block is rendered as a block, such as "if (...) { ... }"
+type Directive struct {
+	Name  string
+	Args  []string
+	Block []Directive
+}
+
+const connectionUpgradeVariable string = "$connection_upgrade"
+
+// ConnectionUpgradeMap returns the "map" block of the "http" context that sets the "Connection" header of WebSocket
+// proxying to "upgrade" if the client asks for an upgrade and to "close" otherwise, so that plain requests to the same
+// location are not sent with "Connection: upgrade". Nginx rejects a variable that is mapped twice, so the block is
+// defined once per machine instead of once per site
+func ConnectionUpgradeMap() Directive {
+	return NewBlock(
+		"map",
+		[]string{"$http_upgrade", connectionUpgradeVariable},
+		NewDirective("default", "upgrade"),
+		NewDirective("''", "close"),
+	)
+}
+
+// NewDirective is a shorthand for constructing a simple, non-block Directive
+func NewDirective(name string, args ...string) Directive {
+	return Directive{Name: name, Args: args}
+}
+
+// NewBlock is a shorthand for constructing a block Directive
+func NewBlock(name string, args []string, directives ...Directive) Directive {
+	if directives == nil {
+		directives = []Directive{}
+	}
+	return Directive{Name: name, Args: args, Block: directives}
+}
+
+// DefaultServer returns the catch-all server block that answers HTTP requests whose Host header matches no other server
+// with files from DefaultRoot
+func DefaultServer() Server {
+	return Server{
+		Listens: []Listen{
+			{Port: "80", DefaultServer: true},
+			{Port: "80", IPv6: true, DefaultServer: true},
+		},
+		ServerNames: []string{"_"},
+		Root:        DefaultRoot,
+		Index:       DefaultIndex,
+		Locations: []Location{
+			{Path: "/", TryFiles: []string{"$uri", "$uri/", "=404"}},
+		},
+	}
+}
+
+// RedirectServer returns the HTTP server block that redirects all plain HTTP requests to the given domain to HTTPS
+func RedirectServer(domain string) Server {
+	return Server{
+		Listens: []Listen{
+			{Port: "80"},
+			{Port: "80", IPv6: true},
+		},
+		ServerNames: []string{domain},
+		Directives: []Directive{
+			NewBlock("if", []string{fmt.Sprintf("($host = %s)", domain)}, NewDirective("return", "301", "https://$host$request_uri")),
+			NewDirective("return", "404"),
+		},
+	}
+}
+
+// SslListens returns the IPv4 and IPv6 SSL listeners on a specified port.
+//
+// The IPv6 listener does not set "ipv6only=on" explicitly, because it is the default already and Nginx allows a listen
+// option like this to be set only once per address, which breaks as soon as a second site listens on the same port
+func SslListens(port string) []Listen {
+	return []Listen{
+		{Port: port, SSL: true},
+		{Port: port, IPv6: true, SSL: true},
+	}
+}
+
+// Bindings returns the distinct "<port> <server name>" pairs that the servers of this config answer to, in the order
+// they are declared. Two sites on the same Nginx instance that share a binding conflict with each other, because
+// Nginx only uses the first one of them
+func (c Config) Bindings() []string {
+	var servers []Directive
+	for _, server := range c.Servers {
+		servers = append(servers, server.directive())
+	}
+	for _, directive := range c.Directives {
+		if directive.Name == "server" && directive.Block != nil {
+			servers = append(servers, directive)
+		}
+	}
+
+	var bindings []string
+	seen := map[string]bool{}
+	for _, server := range servers {
+		var ports []string
+		var serverNames []string
+		for _, directive := range server.Block {
+			switch {
+			case directive.Name == "listen" && len(directive.Args) > 0:
+				address := directive.Args[0]
+				ports = append(ports, address[strings.LastIndex(address, ":")+1:])
+			case directive.Name == "server_name":
+				serverNames = append(serverNames, directive.Args...)
+			}
+		}
+
+		for _, port := range ports {
+			for _, serverName := range serverNames {
+				binding := port + " " + serverName
+				if !seen[binding] {
+					seen[binding] = true
+					bindings = append(bindings, binding)
+				}
+			}
+		}
+	}
+
+	return bindings
+}
+
+// Render returns the config file content of this model
+func (c Config) Render() string {
+	blocks := append([]Directive{}, c.HttpDirectives...)
+	for _, upstream := range c.Upstreams {
+		blocks = append(blocks, upstream.directive())
+	}
+	for _, server := range c.Servers {
+		blocks = append(blocks, server.directive())
+	}
+	blocks = append(blocks, c.Directives...)
+
+	var builder strings.Builder
+	for i, block := range blocks {
+		if i > 0 {
+			builder.WriteString("\n")
+		}
+		block.render(&builder, 0)
+	}
+
+	return builder.String()
+}
+
+func (u Upstream) directive() Directive {
+	var directives []Directive
+	for _, server := range u.Servers {
+		directives = append(directives, NewDirective("server", server))
+	}
+	return NewBlock("upstream", []string{u.Name}, directives...)
+}
+
+func (s Server) directive() Directive {
+	var directives []Directive
+
+	for _, listen := range s.Listens {
+		directives = append(directives, listen.directive())
+	}
+	if len(s.ServerNames) > 0 {
+		directives = append(directives, NewDirective("server_name", s.ServerNames...))
+	}
+	if s.Root != "" {
+		directives = append(directives, NewDirective("root", s.Root))
+	}
+	if len(s.Index) > 0 {
+		directives = append(directives, NewDirective("index", s.Index...))
+	}
+	if s.TLS != nil {
+		directives = append(directives, s.TLS.directives()...)
+	}
+	directives = append(directives, s.Directives...)
+	for _, location := range s.Locations {
+		directives = append(directives, location.directive())
+	}
+
+	return NewBlock("server", nil, directives...)
+}
+
+func (l Listen) directive() Directive {
+	address := l.Port
+	if l.IPv6 {
+		address = "[::]:" + l.Port
+	}
+
+	args := []string{address}
+	if l.SSL {
+		args = append(args, "ssl")
+	}
+	if l.HTTP2 {
+		args = append(args, "http2")
+	}
+	if l.DefaultServer {
+		args = append(args, "default_server")
+	}
+	if l.IPv6Only {
+		args = append(args, "ipv6only=on")
+	}
+
+	return NewDirective("listen", args...)
+}
+
+func (t TLS) directives() []Directive {
+	directives := []Directive{
+		NewDirective("ssl_certificate", t.Certificate),
+		NewDirective("ssl_certificate_key", t.CertificateKey),
+	}
+
+	directives = append(directives, optionalDirectives(
+		[2]string{"ssl_protocols", strings.Join(t.Protocols, " ")},
+		[2]string{"ssl_ecdh_curve", t.ECDHCurve},
+		[2]string{"ssl_ciphers", t.Ciphers},
+		[2]string{"ssl_prefer_server_ciphers", t.PreferServerCiphers},
+		[2]string{"ssl_dhparam", t.DHParam},
+		[2]string{"ssl_session_timeout", t.SessionTimeout},
+		[2]string{"ssl_session_cache", t.SessionCache},
+		[2]string{"ssl_session_tickets", t.SessionTickets},
+		[2]string{"ssl_client_certificate", t.ClientCertificate},
+		[2]string{"ssl_verify_client", t.VerifyClient},
+	)...)
+
+	if t.Stapling {
+		directives = append(directives, NewDirective("ssl_stapling", "on"), NewDirective("ssl_stapling_verify", "on"))
+	}
+	if t.Resolver != "" {
+		directives = append(directives, NewDirective("resolver", t.Resolver))
+	}
+	if t.HSTS != "" {
+		directives = append(directives, NewDirective("add_header", "Strict-Transport-Security", fmt.Sprintf("\"%s\"", t.HSTS), "always"))
+	}
+
+	return directives
+}
+
+func (l Location) directive() Directive {
+	directives := append([]Directive{}, l.Directives...)
+	if len(l.TryFiles) > 0 {
+		directives = append(directives, NewDirective("try_files", l.TryFiles...))
+	}
+	if l.ProxyPass != "" {
+		if l.Proxy != nil {
+			directives = append(directives, l.Proxy.directives()...)
+		}
+		directives = append(directives, NewDirective("proxy_pass", l.ProxyPass))
+	}
+
+	return NewBlock("location", []string{l.Path}, directives...)
+}
+
+func (p Proxy) directives() []Directive {
+	directives := []Directive{
+		NewDirective("proxy_set_header", "Host", "$host"),
+		NewDirective("proxy_set_header", "X-Real-IP", "$remote_addr"),
+		NewDirective("proxy_set_header", "X-Forwarded-For", "$proxy_add_x_forwarded_for"),
+		NewDirective("proxy_set_header", "X-Forwarded-Proto", "$scheme"),
+	}
+	if p.WebSocket != nil && *p.WebSocket {
+		directives = append(
+			directives,
+			NewDirective("proxy_http_version", "1.1"),
+			NewDirective("proxy_set_header", "Upgrade", "$http_upgrade"),
+			NewDirective("proxy_set_header", "Connection", connectionUpgradeVariable),
+		)
+	}
+
+	return append(directives, optionalDirectives(
+		[2]string{"proxy_connect_timeout", p.ConnectTimeout},
+		[2]string{"proxy_send_timeout", p.SendTimeout},
+		[2]string{"proxy_read_timeout", p.ReadTimeout},
+		[2]string{"proxy_buffering", p.Buffering},
+		[2]string{"client_max_body_size", p.ClientMaxBodySize},
+	)...)
+}
+
+// Returns a single-argument directive for each of the given name-argument pairs whose argument is not empty
+func optionalDirectives(pairs ...[2]string) []Directive {
+	var directives []Directive
+	for _, pair := range pairs {
+		if pair[1] != "" {
+			directives = append(directives, NewDirective(pair[0], pair[1]))
+		}
+	}
+	return directives
+}
+
+func (d Directive) render(builder *strings.Builder, depth int) {
+	builder.WriteString(strings.Repeat(indentation, depth))
+	builder.WriteString(strings.Join(append([]string{d.Name}, d.Args...), " "))
+
+	if d.Block == nil {
+		builder.WriteString(";\n")
+		return
+	}
+
+	builder.WriteString(" {\n")
+	for _, child := range d.Block {
+		child.render(builder, depth+1)
+	}
+	builder.WriteString(strings.Repeat(indentation, depth))
+	builder.WriteString("}\n")
+}
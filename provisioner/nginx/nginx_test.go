@@ -0,0 +1,107 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package nginx
+
+import (
+	_ "embed"
+	"reflect"
+	"testing"
+)
+
+//go:embed test-fixtures/upstream.conf
+var expectedUpstreamConfig string
+
+func TestRender(t *testing.T) {
+	config := Config{
+		Upstreams: []Upstream{
+			{Name: "backend", Servers: []string{"localhost:8080", "localhost:8081"}},
+		},
+		Servers: []Server{
+			DefaultServer(),
+			{
+				Listens:     SslListens("443"),
+				ServerNames: []string{"app.mycompany.com"},
+				TLS:         &TLS{Certificate: "/etc/ssl/certs/server.crt", CertificateKey: "/etc/ssl/private/server.key"},
+				Locations: []Location{
+					{Path: "/", ProxyPass: "http://backend"},
+				},
+			},
+			RedirectServer("app.mycompany.com"),
+		},
+	}
+
+	if actual := config.Render(); actual != expectedUpstreamConfig {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expectedUpstreamConfig, actual)
+	}
+	if config.Render() != config.Render() {
+		t.Errorf("Rendering the same config twice should produce identical output")
+	}
+}
+
+func TestListenDirective(t *testing.T) {
+	data := []struct {
+		name     string
+		listen   Listen
+		expected string
+	}{
+		{"plain HTTP", Listen{Port: "80"}, "listen 80;\n"},
+		{"IPv6 default server", Listen{Port: "80", IPv6: true, DefaultServer: true}, "listen [::]:80 default_server;\n"},
+		{"IPv6-only SSL", Listen{Port: "443", IPv6: true, SSL: true, IPv6Only: true}, "listen [::]:443 ssl ipv6only=on;\n"},
+		{"HTTP/2 over SSL", Listen{Port: "443", SSL: true, HTTP2: true}, "listen 443 ssl http2;\n"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			actual := Config{Servers: []Server{{Listens: []Listen{d.listen}}}}.Render()
+			expected := "server {\n    " + d.expected + "}\n"
+			if actual != expected {
+				t.Errorf("Expected %q, got %q", expected, actual)
+			}
+		})
+	}
+}
+
+func TestEmptyBlock(t *testing.T) {
+	actual := Config{Servers: []Server{{Locations: []Location{{Path: "/"}}}}}.Render()
+	expected := "server {\n    location / {\n    }\n}\n"
+
+	if actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
+
+func TestBindings(t *testing.T) {
+	config := Config{
+		Servers: []Server{
+			{Listens: SslListens("443"), ServerNames: []string{"app.mycompany.com", "www.mycompany.com"}},
+			RedirectServer("app.mycompany.com"),
+		},
+	}
+
+	expected := []string{"443 app.mycompany.com", "443 www.mycompany.com", "80 app.mycompany.com"}
+	if actual := config.Bindings(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+}
+
+func TestHttpDirectivesAreRenderedFirst(t *testing.T) {
+	config := Config{
+		HttpDirectives: []Directive{NewDirective("limit_req_zone", "$binary_remote_addr", "zone=app:10m", "rate=10r/s")},
+		Servers:        []Server{{Locations: []Location{{Path: "/"}}}},
+	}
+	expected := "limit_req_zone $binary_remote_addr zone=app:10m rate=10r/s;\n\nserver {\n    location / {\n    }\n}\n"
+
+	if actual := config.Render(); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
+
+func TestConnectionUpgradeMap(t *testing.T) {
+	config := Config{HttpDirectives: []Directive{ConnectionUpgradeMap()}}
+	expected := "map $http_upgrade $connection_upgrade {\n    default upgrade;\n    '' close;\n}\n"
+
+	if actual := config.Render(); actual != expected {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
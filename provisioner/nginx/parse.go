@@ -0,0 +1,156 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package nginx
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type token struct {
+	value string
+	line  int
+}
+
+// Parse reads Nginx config file syntax into a list of Directives. Quoted arguments are kept with their quotes so that
+// rendering the parsed directives produces the same config, except that comments and formatting are not preserved.
+//
+// Parse checks the syntax only, e.g. unbalanced braces, unterminated quotes, or a missing ";". Whether the directives
+// and their arguments are valid is up to "nginx -t"
+func Parse(content string) ([]Directive, error) {
+	tokens, err := tokenize(content)
+	if err != nil {
+		return nil, err
+	}
+
+	directives, rest, err := parseBlock(tokens, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected '}' on line %d", rest[0].line)
+	}
+
+	return directives, nil
+}
+
+func parseBlock(tokens []token, depth int) ([]Directive, []token, error) {
+	directives := []Directive{}
+	var words []token
+
+	for len(tokens) > 0 {
+		current := tokens[0]
+		tokens = tokens[1:]
+
+		switch current.value {
+		case ";":
+			if len(words) == 0 {
+				return nil, nil, fmt.Errorf("unexpected ';' on line %d", current.line)
+			}
+			directives = append(directives, NewDirective(words[0].value, values(words[1:])...))
+			words = nil
+		case "{":
+			if len(words) == 0 {
+				return nil, nil, fmt.Errorf("unexpected '{' on line %d", current.line)
+			}
+			children, rest, err := parseBlock(tokens, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(rest) == 0 {
+				return nil, nil, fmt.Errorf("'%s' block opened on line %d is never closed", words[0].value, current.line)
+			}
+			directives = append(directives, NewBlock(words[0].value, values(words[1:]), children...))
+			words = nil
+			tokens = rest[1:]
+		case "}":
+			if len(words) > 0 {
+				return nil, nil, fmt.Errorf("directive '%s' on line %d is not terminated by ';'", words[0].value, words[0].line)
+			}
+			if depth == 0 {
+				return nil, nil, fmt.Errorf("unexpected '}' on line %d", current.line)
+			}
+			return directives, append([]token{current}, tokens...), nil
+		default:
+			words = append(words, current)
+		}
+	}
+
+	if len(words) > 0 {
+		return nil, nil, fmt.Errorf("directive '%s' on line %d is not terminated by ';'", words[0].value, words[0].line)
+	}
+
+	return directives, nil, nil
+}
+
+func tokenize(content string) ([]token, error) {
+	var tokens []token
+	var word strings.Builder
+	line := 1
+	wordLine := 1
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, token{word.String(), wordLine})
+			word.Reset()
+		}
+	}
+
+	runes := []rune(content)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			flush()
+			line++
+		case unicode.IsSpace(r):
+			flush()
+		case r == '#' && word.Len() == 0:
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			i--
+		case r == ';' || r == '{' || r == '}':
+			flush()
+			tokens = append(tokens, token{string(r), line})
+		case r == '"' || r == '\'':
+			if word.Len() == 0 {
+				wordLine = line
+			}
+			start := line
+			word.WriteRune(r)
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					word.WriteRune(runes[i])
+					i++
+				}
+				if runes[i] == '\n' {
+					line++
+				}
+				word.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("quote opened on line %d is never closed", start)
+			}
+			word.WriteRune(r)
+		default:
+			if word.Len() == 0 {
+				wordLine = line
+			}
+			word.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens, nil
+}
+
+func values(tokens []token) []string {
+	var values []string
+	for _, t := range tokens {
+		values = append(values, t.value)
+	}
+	return values
+}
@@ -0,0 +1,82 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package nginx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	directives, err := Parse(expectedUpstreamConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := (Config{Directives: directives}).Render(); actual != expectedUpstreamConfig {
+		t.Errorf("Rendering parsed config should reproduce the original: %s\n\n%s", expectedUpstreamConfig, actual)
+	}
+}
+
+func TestParse(t *testing.T) {
+	actual, err := Parse(`
+# comments are dropped
+server {
+    listen 443 ssl; # trailing comment
+    add_header X-Frame-Options "SAMEORIGIN; really" always;
+    location ~ \.php$ {}
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Directive{
+		NewBlock(
+			"server",
+			nil,
+			NewDirective("listen", "443", "ssl"),
+			NewDirective("add_header", "X-Frame-Options", `"SAMEORIGIN; really"`, "always"),
+			NewBlock("location", []string{"~", `\.php$`}),
+		),
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	data := []struct {
+		name    string
+		content string
+		error   string
+	}{
+		{"missing semicolon", "server {\n    listen 443\n}", "directive 'listen' on line 2 is not terminated by ';'"},
+		{"unclosed block", "server {\n    listen 443;\n", "'server' block opened on line 1 is never closed"},
+		{"extra closing brace", "server {\n}\n}", "unexpected '}' on line 3"},
+		{"unclosed quote", "add_header X-Foo \"bar;\n", "quote opened on line 1 is never closed"},
+		{"trailing directive", "user www-data", "directive 'user' on line 1 is not terminated by ';'"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			_, err := Parse(d.content)
+			if err == nil || err.Error() != d.error {
+				t.Errorf("Expected error %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func TestBindingsOfParsedServers(t *testing.T) {
+	directives, err := Parse("server {\n    listen [::]:8443 ssl;\n    listen 0.0.0.0:8443 ssl;\n    server_name a.com b.com;\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"8443 a.com", "8443 b.com"}
+	if actual := (Config{Directives: directives}).Bindings(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+}
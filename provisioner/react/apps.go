@@ -0,0 +1,253 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type App
+
+package react
+
+import (
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"path/filepath"
+	"strings"
+)
+
+// App is an additional frontend that Nginx serves from the same host as the app of appDomain, either on a domain of its
+// own or under a path prefix of a domain, e.g.
+//
+//	app {
+//	  distSource       = "admin/dist"
+//	  domain           = "admin.mycompany.com"
+//	  sslCertBase64    = var.admin_ssl_cert_base64
+//	  sslCertKeyBase64 = var.admin_ssl_cert_key_base64
+//	}
+//
+//	app {
+//	  distSource = "docs/build"
+//	  pathPrefix = "/docs/"
+//	  framework  = "docusaurus"
+//	}
+type App struct {
+	// DistSource is the path to the local dist of the app
+	DistSource string `mapstructure:"distSource" required:"true"`
+
+	// Domain is the domain serving the app; default to appDomain
+	Domain string `mapstructure:"domain" required:"false"`
+
+	// PathPrefix is the path the app is served under, e.g. "/docs/"; default to "/"
+	PathPrefix string `mapstructure:"pathPrefix" required:"false"`
+
+	// SslCertBase64 and SslCertKeyBase64 are the certificate and key of a domain other than appDomain. The apps on the
+	// same domain share them, so only one of them needs to set them
+	SslCertBase64    string `mapstructure:"sslCertBase64" required:"false"`
+	SslCertKeyBase64 string `mapstructure:"sslCertKeyBase64" required:"false"`
+
+	Site `mapstructure:",squash"`
+}
+
+// An SSL-enabled domain serving apps, other than appDomain, with its certificate and key
+type appDomain struct {
+	domain           string
+	sslCertBase64    string
+	sslCertKeyBase64 string
+}
+
+func (a App) domain(defaultDomain string) string {
+	if a.Domain == "" {
+		return defaultDomain
+	}
+	return a.Domain
+}
+
+func (a App) pathPrefix() string {
+	if a.PathPrefix == "" {
+		return "/"
+	}
+	return a.PathPrefix
+}
+
+// Returns the web root an app is published to. An app under a path prefix is a directory of the root shared by the
+// prefixed apps of its domain, e.g. /var/www/mycompany.com-apps/docs, so that it never ends up in the dist of the app
+// serving "/"
+func appRoot(domain string, pathPrefix string) string {
+	if pathPrefix == "/" {
+		return staticRoot(domain)
+	}
+	return filepath.Join(prefixedAppsRoot(domain), pathPrefix)
+}
+
+func prefixedAppsRoot(domain string) string {
+	return staticRoot(domain) + "-apps"
+}
+
+func appDistFilename(i int) string {
+	return fmt.Sprintf("app-%d-dist", i)
+}
+
+// Returns an error if an app block is incomplete, if two apps claim the same path, or if a domain other than appDomain
+// has no certificate or conflicting ones
+func (c Config) validateApps() error {
+	if len(c.Apps) == 0 {
+		return nil
+	}
+
+	if c.ProxyBackend != "" && c.ProxyBackend != ssl.NginxBackend {
+		return fmt.Errorf("app is only supported by the '%s' proxyBackend", ssl.NginxBackend)
+	}
+	if c.NginxTemplate != "" {
+		return fmt.Errorf("app cannot be combined with nginxTemplate")
+	}
+
+	prefixes := map[string][]string{}
+	for i, app := range c.Apps {
+		if app.DistSource == "" {
+			return fmt.Errorf("app #%d requires distSource", i+1)
+		}
+		if err := app.Site.validate(); err != nil {
+			return fmt.Errorf("app #%d: %s", i+1, err)
+		}
+
+		domain := app.domain(c.AppDomain)
+		prefix := app.pathPrefix()
+		if !strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") {
+			return fmt.Errorf("app #%d: pathPrefix '%s' must start and end with '/'", i+1, prefix)
+		}
+		if domain == c.AppDomain && prefix == "/" {
+			return fmt.Errorf("app #%d: '/' of appDomain '%s' is served by distSource or sourceDir; set a domain or pathPrefix", i+1, domain)
+		}
+		if domain == c.AppDomain && app.SslCertBase64 != "" {
+			return fmt.Errorf("app #%d: apps on appDomain '%s' use its certificate", i+1, domain)
+		}
+		if (app.SslCertBase64 == "") != (app.SslCertKeyBase64 == "") {
+			return fmt.Errorf("app #%d: sslCertBase64 and sslCertKeyBase64 must be configured together", i+1)
+		}
+
+		for _, other := range prefixes[domain] {
+			// The app serving "/" has a web root of its own, so only the prefixed apps must not be nested
+			if other == prefix || (other != "/" && prefix != "/" && (strings.HasPrefix(prefix, other) || strings.HasPrefix(other, prefix))) {
+				return fmt.Errorf("app #%d: pathPrefix '%s' of '%s' overlaps with '%s'", i+1, prefix, domain, other)
+			}
+		}
+		prefixes[domain] = append(prefixes[domain], prefix)
+	}
+
+	_, err := c.appDomains()
+	return err
+}
+
+// Returns the domains, other than appDomain, serving apps in the order of their first app, together with the
+// certificate of each domain
+func (c Config) appDomains() ([]appDomain, error) {
+	var domains []appDomain
+	index := map[string]int{}
+	for _, app := range c.Apps {
+		domain := app.domain(c.AppDomain)
+		if domain == c.AppDomain {
+			continue
+		}
+
+		i, ok := index[domain]
+		if !ok {
+			i = len(domains)
+			index[domain] = i
+			domains = append(domains, appDomain{domain: domain})
+		}
+
+		if app.SslCertBase64 == "" {
+			continue
+		}
+		if domains[i].sslCertBase64 != "" && (domains[i].sslCertBase64 != app.SslCertBase64 || domains[i].sslCertKeyBase64 != app.SslCertKeyBase64) {
+			return nil, fmt.Errorf("the apps of domain '%s' have different certificates", domain)
+		}
+		domains[i].sslCertBase64 = app.SslCertBase64
+		domains[i].sslCertKeyBase64 = app.SslCertKeyBase64
+	}
+
+	for _, domain := range domains {
+		if domain.sslCertBase64 == "" {
+			return nil, fmt.Errorf("an app of domain '%s' must set sslCertBase64 and sslCertKeyBase64", domain.domain)
+		}
+	}
+
+	return domains, nil
+}
+
+// Adds the apps of a domain, if any, to the SSL-enabled server of an Nginx config. An app serving "/" uses the root of
+// the server, the others the root of the prefixed apps. The server compresses responses unless it does already
+func (c Config) withApps(domain string, nginxConfig nginx.Config) nginx.Config {
+	if !c.servesApps(domain) {
+		return nginxConfig
+	}
+
+	servers := make([]nginx.Server, 0, len(nginxConfig.Servers))
+	for _, server := range nginxConfig.Servers {
+		if server.TLS != nil {
+			locations := append([]nginx.Location{}, server.Locations...)
+			for _, app := range c.Apps {
+				if app.domain(c.AppDomain) != domain {
+					continue
+				}
+
+				root := ""
+				if app.pathPrefix() != "/" {
+					root = prefixedAppsRoot(domain)
+				}
+				locations = append(locations, app.preset("").locations(app.pathPrefix(), root, false)...)
+			}
+			server.Locations = locations
+
+			if !compresses(server) {
+				server.Directives = append(append([]nginx.Directive{}, server.Directives...), compressionDirectives(c.Brotli)...)
+			}
+		}
+		servers = append(servers, server)
+	}
+
+	nginxConfig.Servers = servers
+	return nginxConfig
+}
+
+func (c Config) servesApps(domain string) bool {
+	for _, app := range c.Apps {
+		if app.domain(c.AppDomain) == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func compresses(server nginx.Server) bool {
+	for _, directive := range server.Directives {
+		if directive.Name == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the Nginx config of a domain, other than appDomain, that serves apps only
+func (c Config) appNginxConfig(domain string) nginx.Config {
+	return c.withApps(domain, nginx.Config{
+		Servers: []nginx.Server{
+			{
+				Listens:     nginx.SslListens("443"),
+				ServerNames: []string{domain},
+				Root:        staticRoot(domain),
+				Index:       []string{"index.html"},
+				TLS:         ssl.NginxTls(domain),
+			},
+			nginx.RedirectServer(domain),
+		},
+	})
+}
+
+// Returns the commands publishing the uploaded dist of every app to its web root
+func (c Config) getCommandsPublishingApps() []string {
+	var commands []string
+	for i, app := range c.Apps {
+		dist := filepath.Join(c.HomeDir, appDistFilename(i))
+		commands = append(commands, getCommandsPublishing(dist, appRoot(app.domain(c.AppDomain), app.pathPrefix()), c.Brotli)...)
+	}
+	return commands
+}
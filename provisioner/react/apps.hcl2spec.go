@@ -0,0 +1,53 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package react
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatApp is an auto-generated flat version of App.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatApp struct {
+	DistSource        *string  `mapstructure:"distSource" required:"true" cty:"distSource" hcl:"distSource"`
+	Domain            *string  `mapstructure:"domain" required:"false" cty:"domain" hcl:"domain"`
+	PathPrefix        *string  `mapstructure:"pathPrefix" required:"false" cty:"pathPrefix" hcl:"pathPrefix"`
+	SslCertBase64     *string  `mapstructure:"sslCertBase64" required:"false" cty:"sslCertBase64" hcl:"sslCertBase64"`
+	SslCertKeyBase64  *string  `mapstructure:"sslCertKeyBase64" required:"false" cty:"sslCertKeyBase64" hcl:"sslCertKeyBase64"`
+	Framework         *string  `mapstructure:"framework" required:"false" cty:"framework" hcl:"framework"`
+	Routing           *string  `mapstructure:"routing" required:"false" cty:"routing" hcl:"routing"`
+	TrailingSlash     *string  `mapstructure:"trailingSlash" required:"false" cty:"trailingSlash" hcl:"trailingSlash"`
+	NotFoundPage      *string  `mapstructure:"notFoundPage" required:"false" cty:"notFoundPage" hcl:"notFoundPage"`
+	HashedAssetPaths  []string `mapstructure:"hashedAssetPaths" required:"false" cty:"hashedAssetPaths" hcl:"hashedAssetPaths"`
+	AssetCacheControl *string  `mapstructure:"assetCacheControl" required:"false" cty:"assetCacheControl" hcl:"assetCacheControl"`
+	PageCacheControl  *string  `mapstructure:"pageCacheControl" required:"false" cty:"pageCacheControl" hcl:"pageCacheControl"`
+}
+
+// FlatMapstructure returns a new FlatApp.
+// FlatApp is an auto-generated flat version of App.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*App) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatApp)
+}
+
+// HCL2Spec returns the hcl spec of a App.
+// This spec is used by HCL to read the fields of App.
+// The decoded values from this spec will then be applied to a FlatApp.
+func (*FlatApp) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"distSource":        &hcldec.AttrSpec{Name: "distSource", Type: cty.String, Required: false},
+		"domain":            &hcldec.AttrSpec{Name: "domain", Type: cty.String, Required: false},
+		"pathPrefix":        &hcldec.AttrSpec{Name: "pathPrefix", Type: cty.String, Required: false},
+		"sslCertBase64":     &hcldec.AttrSpec{Name: "sslCertBase64", Type: cty.String, Required: false},
+		"sslCertKeyBase64":  &hcldec.AttrSpec{Name: "sslCertKeyBase64", Type: cty.String, Required: false},
+		"framework":         &hcldec.AttrSpec{Name: "framework", Type: cty.String, Required: false},
+		"routing":           &hcldec.AttrSpec{Name: "routing", Type: cty.String, Required: false},
+		"trailingSlash":     &hcldec.AttrSpec{Name: "trailingSlash", Type: cty.String, Required: false},
+		"notFoundPage":      &hcldec.AttrSpec{Name: "notFoundPage", Type: cty.String, Required: false},
+		"hashedAssetPaths":  &hcldec.AttrSpec{Name: "hashedAssetPaths", Type: cty.List(cty.String), Required: false},
+		"assetCacheControl": &hcldec.AttrSpec{Name: "assetCacheControl", Type: cty.String, Required: false},
+		"pageCacheControl":  &hcldec.AttrSpec{Name: "pageCacheControl", Type: cty.String, Required: false},
+	}
+	return s
+}
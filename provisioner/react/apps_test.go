@@ -0,0 +1,140 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package react
+
+import (
+	_ "embed"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//go:embed test-fixtures/nginx-apps.conf
+var expectedAppsNginxConfig string
+
+func TestPrepareApps(t *testing.T) {
+	admin := map[string]interface{}{"distSource": "admin", "domain": "admin.mycompany.com", "sslCertBase64": "Y2VydA==", "sslCertKeyBase64": "a2V5"}
+
+	data := []struct {
+		name  string
+		apps  []map[string]interface{}
+		extra map[string]interface{}
+		error string
+	}{
+		{
+			"domain and path prefixes",
+			[]map[string]interface{}{
+				admin,
+				{"distSource": "admin-docs", "domain": "admin.mycompany.com", "pathPrefix": "/docs/"},
+				{"distSource": "docs", "pathPrefix": "/docs/", "framework": "docusaurus"},
+			},
+			nil,
+			"",
+		},
+		{"missing dist", []map[string]interface{}{{"pathPrefix": "/docs/"}}, nil, "app #1 requires distSource"},
+		{"root of appDomain", []map[string]interface{}{{"distSource": "docs"}}, nil, "'/' of appDomain 'mycompany.com' is served by distSource"},
+		{"invalid prefix", []map[string]interface{}{{"distSource": "docs", "pathPrefix": "/docs"}}, nil, "must start and end with '/'"},
+		{
+			"nested prefixes",
+			[]map[string]interface{}{{"distSource": "docs", "pathPrefix": "/docs/"}, {"distSource": "v2", "pathPrefix": "/docs/v2/"}},
+			nil,
+			"pathPrefix '/docs/v2/' of 'mycompany.com' overlaps with '/docs/'",
+		},
+		{"missing certificate", []map[string]interface{}{{"distSource": "admin", "domain": "admin.mycompany.com"}}, nil, "must set sslCertBase64 and sslCertKeyBase64"},
+		{
+			"different certificates",
+			[]map[string]interface{}{admin, {"distSource": "docs", "domain": "admin.mycompany.com", "pathPrefix": "/docs/", "sslCertBase64": "b3RoZXI=", "sslCertKeyBase64": "a2V5"}},
+			nil,
+			"the apps of domain 'admin.mycompany.com' have different certificates",
+		},
+		{"certificate of appDomain", []map[string]interface{}{{"distSource": "docs", "pathPrefix": "/docs/", "sslCertBase64": "Y2VydA==", "sslCertKeyBase64": "a2V5"}}, nil, "use its certificate"},
+		{"invalid site", []map[string]interface{}{{"distSource": "docs", "pathPrefix": "/docs/", "routing": "hash"}}, nil, "app #1: unknown routing 'hash'"},
+		{"caddy", []map[string]interface{}{admin}, map[string]interface{}{"proxyBackend": "caddy"}, "app is only supported by the 'nginx' proxyBackend"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			config := map[string]interface{}{"appDomain": "mycompany.com", "distSource": "dist", "app": d.apps}
+			for key, value := range d.extra {
+				config[key] = value
+			}
+
+			err := (&Provisioner{}).Prepare(config)
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func Test_builtInNginxConfigApps(t *testing.T) {
+	config := Config{
+		AppDomain: "mycompany.com",
+		Apps: []App{
+			{DistSource: "admin", Domain: "admin.mycompany.com"},
+			{DistSource: "docs", PathPrefix: "/docs/", Site: Site{Framework: DocusaurusFramework, TrailingSlash: AlwaysTrailingSlash}},
+		},
+	}
+
+	if actualNginxConfig := config.builtInNginxConfig().Render(); actualNginxConfig != expectedAppsNginxConfig {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expectedAppsNginxConfig, actualNginxConfig)
+	}
+
+	admin := config.appNginxConfig("admin.mycompany.com").Render()
+	for _, expected := range []string{
+		"    root /var/www/admin.mycompany.com;\n",
+		"    gzip on;\n",
+		"    location / {\n        try_files $uri $uri/ /index.html;\n    }\n",
+	} {
+		if !strings.Contains(admin, expected) {
+			t.Errorf("Expected %q in Nginx config: %s", expected, admin)
+		}
+	}
+}
+
+func TestConfig_appDomains(t *testing.T) {
+	config := Config{
+		AppDomain: "mycompany.com",
+		Apps: []App{
+			{DistSource: "docs", PathPrefix: "/docs/"},
+			{DistSource: "blog", Domain: "blog.mycompany.com", PathPrefix: "/2024/"},
+			{DistSource: "admin", Domain: "admin.mycompany.com", SslCertBase64: "YWRtaW4=", SslCertKeyBase64: "a2V5"},
+			{DistSource: "blog", Domain: "blog.mycompany.com", SslCertBase64: "YmxvZw==", SslCertKeyBase64: "a2V5"},
+		},
+	}
+
+	expected := []appDomain{
+		{domain: "blog.mycompany.com", sslCertBase64: "YmxvZw==", sslCertKeyBase64: "a2V5"},
+		{domain: "admin.mycompany.com", sslCertBase64: "YWRtaW4=", sslCertKeyBase64: "a2V5"},
+	}
+
+	actual, err := config.appDomains()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected and actual domains do not match: %v\n\n%v", expected, actual)
+	}
+}
+
+func Test_getCommandsPublishingApps(t *testing.T) {
+	config := Config{
+		HomeDir:   "/home/ubuntu",
+		AppDomain: "mycompany.com",
+		Apps:      []App{{DistSource: "docs", PathPrefix: "/docs/"}, {DistSource: "admin", Domain: "admin.mycompany.com"}},
+	}
+
+	commands := strings.Join(config.getCommandsPublishingApps(), "\n")
+	for _, expected := range []string{
+		"sudo mkdir -p /var/www/mycompany.com-apps && sudo rm -rf /var/www/mycompany.com-apps/docs\nsudo mv /home/ubuntu/app-0-dist /var/www/mycompany.com-apps/docs\n",
+		"sudo mkdir -p /var/www && sudo rm -rf /var/www/admin.mycompany.com\nsudo mv /home/ubuntu/app-1-dist /var/www/admin.mycompany.com\n",
+	} {
+		if !strings.Contains(commands, expected) {
+			t.Errorf("Expected %q in commands: %s", expected, commands)
+		}
+	}
+}
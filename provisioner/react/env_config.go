@@ -0,0 +1,177 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package react
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/systemd"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The sources that the runtime environment of the React app can be regenerated from at boot
+const (
+	EnvFileSource  string = "file"
+	MetadataSource string = "metadata"
+)
+
+// ENV_CONFIG_FILENAME The script in the dist that assigns the runtime environment to window.__ENV__
+const ENV_CONFIG_FILENAME string = "env-config.js"
+
+// ENV_CONFIG_SERVICE_NAME The name of the systemd oneshot regenerating ENV_CONFIG_FILENAME at boot
+const ENV_CONFIG_SERVICE_NAME string = "react-env-config"
+
+const envConfigScriptDst string = "/usr/local/bin/" + ENV_CONFIG_SERVICE_NAME
+const envConfigDefaultsDst string = "/etc/react-app/env-config.defaults"
+const envConfigDefaultsFilename string = "env-config.defaults"
+
+// The EC2 instance metadata service, which exposes the instance tags if they are allowed in the metadata options
+const instanceMetadataUrl string = "http://169.254.169.254/latest"
+
+// Returns an error if the runtime environment cannot be written into ENV_CONFIG_FILENAME or regenerated at boot
+func (c Config) validateRuntimeEnv() error {
+	for name := range c.RuntimeEnv {
+		if !environmentVariableName.MatchString(name) {
+			return fmt.Errorf("invalid runtimeEnv variable name '%s'", name)
+		}
+	}
+
+	switch c.RuntimeEnvSource {
+	case "":
+		return nil
+	case EnvFileSource, MetadataSource:
+		if len(c.RuntimeEnv) == 0 {
+			return fmt.Errorf("runtimeEnvSource requires runtimeEnv to declare the variables to regenerate")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown runtimeEnvSource '%s'; supported sources are '%s' and '%s'", c.RuntimeEnvSource, EnvFileSource, MetadataSource)
+	}
+}
+
+// Returns the directory in remote machine that the dist is served from
+func (c Config) distDir() string {
+	if c.StaticMode {
+		return staticRoot(c.AppDomain)
+	}
+	return filepath.Join(APP_DIR, "dist")
+}
+
+// Returns the content of ENV_CONFIG_FILENAME, which assigns the variables as a JSON object to window.__ENV__, e.g.
+//
+//	window.__ENV__ = {"API_URL":"https://api.mycompany.com"};
+//
+// The app loads it with a <script src="/env-config.js"></script> in its index.html before its own bundle
+func getEnvConfig(runtimeEnv map[string]string) (string, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(runtimeEnv); err != nil {
+		return "", fmt.Errorf("error encoding runtimeEnv: %s", err)
+	}
+
+	return fmt.Sprintf("window.__ENV__ = %s;\n", strings.TrimSpace(buffer.String())), nil
+}
+
+// Returns the script that regenerates ENV_CONFIG_FILENAME in a dist directory from the environment of the
+// ENV_CONFIG_SERVICE_NAME service. With MetadataSource, the EC2 instance tags of the same names take precedence.
+//
+// The output has the same format as getEnvConfig() and replaces the file atomically, so that the app never loads a
+// partially written file
+func getEnvConfigScript(distDir string, names []string, source string) string {
+	target := filepath.Join(distDir, ENV_CONFIG_FILENAME)
+
+	lines := []string{
+		"#!/bin/bash",
+		fmt.Sprintf("# Regenerates %s at boot; installed by the react provisioner", target),
+		"set -e",
+	}
+	if source == MetadataSource {
+		lines = append(
+			lines,
+			fmt.Sprintf("TOKEN=$(curl -fsS -m 2 -X PUT %s/api/token -H 'X-aws-ec2-metadata-token-ttl-seconds: 60' || true)", instanceMetadataUrl),
+			fmt.Sprintf("for NAME in %s; do", strings.Join(names, " ")),
+			fmt.Sprintf("  if VALUE=$(curl -fsS -m 2 -H \"X-aws-ec2-metadata-token: $TOKEN\" %s/meta-data/tags/instance/$NAME); then export \"$NAME=$VALUE\"; fi", instanceMetadataUrl),
+			"done",
+		)
+	}
+
+	return strings.Join(
+		append(
+			lines,
+			fmt.Sprintf("ENV_JSON=$(jq -n -c '$ENV | {%s}')", strings.Join(names, ", ")),
+			fmt.Sprintf("printf 'window.__ENV__ = %%s;\\n' \"$ENV_JSON\" > %s.tmp", target),
+			fmt.Sprintf("chmod 644 %s.tmp && mv -f %s.tmp %s", target, target, target),
+		),
+		"\n",
+	) + "\n"
+}
+
+// Returns the systemd oneshot that runs the script of getEnvConfigScript() at boot, before the app and Nginx serve the
+// file. The variables of runtimeEnv are the defaults, which the optional environment file overrides
+func getEnvConfigService() systemd.Service {
+	return systemd.Service{
+		Description:      "Runtime environment of the React app",
+		After:            []string{"network-online.target"},
+		Before:           []string{SERVICE_NAME + ".service", "nginx.service"},
+		Type:             "oneshot",
+		EnvironmentFiles: []string{envConfigDefaultsDst, "-" + systemd.EnvironmentFileDst(ENV_CONFIG_SERVICE_NAME)},
+		ExecStart:        envConfigScriptDst,
+		Directives:       [][2]string{{"RemainAfterExit", "true"}},
+	}
+}
+
+// Returns the files of the runtime environment uploaded to the home directory by their file names, i.e. the
+// ENV_CONFIG_FILENAME and, if it is regenerated at boot, the defaults, the script and the oneshot service
+func (c Config) getEnvConfigUploads() (map[string]string, error) {
+	envConfig, err := getEnvConfig(c.RuntimeEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := map[string]string{ENV_CONFIG_FILENAME: envConfig}
+	if c.RuntimeEnvSource == "" {
+		return uploads, nil
+	}
+
+	names := make([]string, 0, len(c.RuntimeEnv))
+	for name := range c.RuntimeEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	uploads[envConfigDefaultsFilename] = getEnvironmentFile(c.RuntimeEnv)
+	uploads[ENV_CONFIG_SERVICE_NAME] = getEnvConfigScript(c.distDir(), names, c.RuntimeEnvSource)
+	uploads[ENV_CONFIG_SERVICE_NAME+".service"] = getEnvConfigService().Render()
+
+	return uploads, nil
+}
+
+// Returns the commands installing the uploaded ENV_CONFIG_FILENAME into a dist directory and, if it is regenerated at
+// boot from a source, the oneshot service doing so. The file is installed after the dist is precompressed, so that Nginx
+// never serves a stale precompressed copy of it
+func getCommandsInstallingEnvConfig(homeDir string, distDir string, source string) []string {
+	commands := []string{
+		fmt.Sprintf("sudo install -o root -g root -m 644 %s %s && rm %s", filepath.Join(homeDir, ENV_CONFIG_FILENAME), filepath.Join(distDir, ENV_CONFIG_FILENAME), filepath.Join(homeDir, ENV_CONFIG_FILENAME)),
+	}
+	if source == "" {
+		return commands
+	}
+
+	defaults := filepath.Join(homeDir, envConfigDefaultsFilename)
+	script := filepath.Join(homeDir, ENV_CONFIG_SERVICE_NAME)
+
+	commands = append(
+		commands,
+		"sudo apt install -y jq curl",
+		fmt.Sprintf("sudo mkdir -p %s", filepath.Dir(envConfigDefaultsDst)),
+		fmt.Sprintf("sudo install -o root -g root -m 644 %s %s && rm %s", defaults, envConfigDefaultsDst, defaults),
+		fmt.Sprintf("sudo install -o root -g root -m 755 %s %s && rm %s", script, envConfigScriptDst, script),
+	)
+	commands = append(commands, systemd.CommandsInstallingUnit(filepath.Join(homeDir, ENV_CONFIG_SERVICE_NAME+".service"), ENV_CONFIG_SERVICE_NAME)...)
+	return append(commands, systemd.CommandsStartingService(ENV_CONFIG_SERVICE_NAME)...)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package react
+
+import (
+	_ "embed"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//go:embed test-fixtures/react-env-config
+var expectedEnvConfigScript string
+
+func Test_getEnvConfig(t *testing.T) {
+	expected := "window.__ENV__ = {\"API_URL\":\"https://api.mycompany.com/<v1>\",\"GREETING\":\"say \\\"hi\\\"\"};\n"
+
+	actual, err := getEnvConfig(map[string]string{"GREETING": `say "hi"`, "API_URL": "https://api.mycompany.com/<v1>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != expected {
+		t.Errorf("Expected and actual env-config.js do not match: %s\n\n%s", expected, actual)
+	}
+}
+
+func Test_getEnvConfigScript(t *testing.T) {
+	actual := getEnvConfigScript("/var/www/app.mycompany.com", []string{"API_URL", "GREETING"}, MetadataSource)
+
+	if actual != expectedEnvConfigScript {
+		t.Errorf("Expected and actual script do not match: %s\n\n%s", expectedEnvConfigScript, actual)
+	}
+
+	if fromFile := getEnvConfigScript("/opt/react-app/dist", []string{"API_URL"}, EnvFileSource); strings.Contains(fromFile, "169.254.169.254") {
+		t.Errorf("Expected no instance metadata lookup with the env file source: %s", fromFile)
+	}
+}
+
+func Test_validateRuntimeEnv(t *testing.T) {
+	data := []struct {
+		name   string
+		config Config
+		error  string
+	}{
+		{"build time only", Config{RuntimeEnv: map[string]string{"API_URL": "https://api.mycompany.com"}}, ""},
+		{"metadata", Config{RuntimeEnv: map[string]string{"API_URL": ""}, RuntimeEnvSource: MetadataSource}, ""},
+		{"invalid name", Config{RuntimeEnv: map[string]string{"API-URL": ""}}, "invalid runtimeEnv variable name 'API-URL'"},
+		{"source without variables", Config{RuntimeEnvSource: EnvFileSource}, "runtimeEnvSource requires runtimeEnv"},
+		{"unknown source", Config{RuntimeEnv: map[string]string{"API_URL": ""}, RuntimeEnvSource: "consul"}, "unknown runtimeEnvSource 'consul'"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			err := d.config.validateRuntimeEnv()
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func Test_getCommandsInstallingEnvConfig(t *testing.T) {
+	actualCommands := getCommandsInstallingEnvConfig("/home/ubuntu", "/var/www/app.mycompany.com", EnvFileSource)
+
+	expectedCommands := []string{
+		"sudo install -o root -g root -m 644 /home/ubuntu/env-config.js /var/www/app.mycompany.com/env-config.js && rm /home/ubuntu/env-config.js",
+		"sudo apt install -y jq curl",
+		"sudo mkdir -p /etc/react-app",
+		"sudo install -o root -g root -m 644 /home/ubuntu/env-config.defaults /etc/react-app/env-config.defaults && rm /home/ubuntu/env-config.defaults",
+		"sudo install -o root -g root -m 755 /home/ubuntu/react-env-config /usr/local/bin/react-env-config && rm /home/ubuntu/react-env-config",
+		"sudo install -o root -g root -m 644 /home/ubuntu/react-env-config.service /etc/systemd/system/react-env-config.service && rm /home/ubuntu/react-env-config.service",
+		"if [ -d /run/systemd/system ]; then sudo systemctl daemon-reload && sudo systemctl enable react-env-config && sudo systemctl restart react-env-config; else sudo mkdir -p /etc/systemd/system/multi-user.target.wants && sudo ln -sf /etc/systemd/system/react-env-config.service /etc/systemd/system/multi-user.target.wants/react-env-config.service && echo \"systemd is not running; react-env-config starts at next boot\"; fi",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, actualCommands) {
+		t.Errorf("Expected and actual commands do not match: %s\n\n%s", expectedCommands, actualCommands)
+	}
+
+	if buildTimeOnly := getCommandsInstallingEnvConfig("/home/ubuntu", "/opt/react-app/dist", ""); len(buildTimeOnly) != 1 {
+		t.Errorf("Expected only env-config.js to be installed without a source: %s", buildTimeOnly)
+	}
+}
+
+func Test_getEnvConfigService(t *testing.T) {
+	unit := getEnvConfigService().Render()
+
+	for _, expected := range []string{
+		"Before=react-app.service nginx.service\n",
+		"Type=oneshot\n",
+		"EnvironmentFile=/etc/react-app/env-config.defaults\nEnvironmentFile=-/etc/default/react-env-config\n",
+		"RemainAfterExit=true\n",
+	} {
+		if !strings.Contains(unit, expected) {
+			t.Errorf("Expected %q in unit: %s", expected, unit)
+		}
+	}
+}
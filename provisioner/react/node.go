@@ -0,0 +1,144 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package react
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// The strategies installing Node.js in remote machine
+const (
+	// TarballNodeInstall installs the official binary tarball from nodejs.org, verified against its published SHA-256
+	// checksums
+	TarballNodeInstall string = "tarball"
+	// NvmNodeInstall installs Node.js with nvm, https://github.com/nvm-sh/nvm
+	NvmNodeInstall string = "nvm"
+	// FnmNodeInstall installs Node.js with fnm, https://github.com/Schniz/fnm
+	FnmNodeInstall string = "fnm"
+	// DistroNodeInstall installs the "nodejs" and "npm" packages of the distribution
+	DistroNodeInstall string = "distro"
+)
+
+// DEFAULT_NODE_INSTALL Default strategy installing Node.js
+const DEFAULT_NODE_INSTALL string = TarballNodeInstall
+
+// The pinned versions of the version managers and of the global packages installed with Node.js
+const (
+	NVM_VERSION   string = "0.39.7"
+	FNM_VERSION   string = "1.37.1"
+	YARN_VERSION  string = "1.22.22"
+	SERVE_VERSION string = "14.2.3"
+)
+
+const nodeDistUrl string = "https://nodejs.org/dist"
+const nodeTarballDir string = "/usr/local/lib/nodejs"
+const nvmDir string = "/usr/local/nvm"
+const fnmDir string = "/usr/local/fnm"
+
+// A major version, e.g. "18", which resolves to its latest release, or an exact version, e.g. "18.19.1"
+var nodeVersionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+\.[0-9]+)?$`)
+
+// Returns an error if a strategy is unknown or a version is neither a major nor an exact version. Empty values stand for
+// the defaults
+func validateNodeInstall(nodeInstall string, nodeVersion string) error {
+	switch nodeInstall {
+	case "", TarballNodeInstall, NvmNodeInstall, FnmNodeInstall, DistroNodeInstall:
+	default:
+		return fmt.Errorf(
+			"unknown nodeInstall '%s'; supported strategies are '%s', '%s', '%s' and '%s'",
+			nodeInstall, TarballNodeInstall, NvmNodeInstall, FnmNodeInstall, DistroNodeInstall,
+		)
+	}
+
+	if nodeVersion != "" && !nodeVersionPattern.MatchString(nodeVersion) {
+		return fmt.Errorf("invalid nodeVersion '%s'; expected a major version, e.g. '18', or an exact version, e.g. '18.19.1'", nodeVersion)
+	}
+
+	return nil
+}
+
+// Returns the commands installing a version of Node.js with a strategy, as well as the pinned yarn and serve.
+//
+// Except for the distribution packages, Node.js is installed into a versioned directory, whose binaries, including the
+// global packages, are linked into /usr/local/bin, so that they are on the PATH of every user and of systemd services.
+// The build fails unless the installed Node.js matches the version. The distribution packages come in the version of
+// the distribution, which is only checked if a version is given
+func getCommandsInstallingNode(nodeInstall string, nodeVersion string) []string {
+	var commands []string
+	switch nodeInstall {
+	case NvmNodeInstall:
+		commands = getCommandsInstallingNodeWithNvm(nodeVersion)
+	case FnmNodeInstall:
+		commands = getCommandsInstallingNodeWithFnm(nodeVersion)
+	case DistroNodeInstall:
+		commands = []string{"sudo apt install -y nodejs npm", "NODE_HOME="}
+	default:
+		commands = getCommandsInstallingNodeTarball(nodeVersion)
+	}
+
+	commands = append(commands, "if [ -n \"$NODE_HOME\" ]; then export PATH=$NODE_HOME/bin:$PATH; fi")
+	if nodeVersion != "" {
+		commands = append(
+			commands,
+			fmt.Sprintf(
+				"NODE_INSTALLED=$(node --version); if [[ \"$NODE_INSTALLED\" != v%s && \"$NODE_INSTALLED\" != v%s.* ]]; then echo \"Expected Node.js %s, got $NODE_INSTALLED\" >&2; exit 1; fi",
+				nodeVersion, nodeVersion, nodeVersion,
+			),
+		)
+	}
+
+	return append(
+		commands,
+		fmt.Sprintf("sudo env PATH=$PATH npm install -g yarn@%s serve@%s", YARN_VERSION, SERVE_VERSION),
+		"if [ -n \"$NODE_HOME\" ]; then sudo ln -sf $NODE_HOME/bin/* /usr/local/bin/; fi",
+	)
+}
+
+// Downloads the official tarball of the current architecture and verifies it against the SHASUMS256.txt of the release.
+// A major version resolves to the latest release of it
+func getCommandsInstallingNodeTarball(nodeVersion string) []string {
+	release := fmt.Sprintf("%s/latest-v%s.x", nodeDistUrl, nodeVersion)
+	if nodeVersionPattern.FindStringSubmatch(nodeVersion)[1] != "" {
+		release = fmt.Sprintf("%s/v%s", nodeDistUrl, nodeVersion)
+	}
+
+	return []string{
+		"sudo apt install -y curl xz-utils",
+		"NODE_ARCH=$(dpkg --print-architecture | sed -e 's/^amd64$/x64/' -e 's/^armhf$/armv7l/')",
+		fmt.Sprintf("cd /tmp && curl -fsSLO %s/SHASUMS256.txt", release),
+		"NODE_TARBALL=$(grep -o -E \"node-v[0-9.]+-linux-$NODE_ARCH\\.tar\\.xz\" SHASUMS256.txt | head -n 1)",
+		fmt.Sprintf("if [ -z \"$NODE_TARBALL\" ]; then echo \"No Node.js %s tarball for $NODE_ARCH\" >&2; exit 1; fi", nodeVersion),
+		fmt.Sprintf("curl -fsSLO %s/$NODE_TARBALL && grep \" $NODE_TARBALL$\" SHASUMS256.txt | sha256sum -c -", release),
+		fmt.Sprintf("NODE_HOME=%s/${NODE_TARBALL%%.tar.xz}", nodeTarballDir),
+		fmt.Sprintf("sudo mkdir -p %s && sudo rm -rf $NODE_HOME && sudo tar -xJf $NODE_TARBALL -C %s --no-same-owner", nodeTarballDir, nodeTarballDir),
+		"rm $NODE_TARBALL SHASUMS256.txt && cd -",
+	}
+}
+
+// Installs the pinned nvm from its Git tag, which then installs Node.js and verifies its checksum
+func getCommandsInstallingNodeWithNvm(nodeVersion string) []string {
+	return []string{
+		"sudo apt install -y curl git",
+		fmt.Sprintf("if [ ! -d %s ]; then sudo git clone --depth 1 --branch v%s https://github.com/nvm-sh/nvm.git %s; fi", nvmDir, NVM_VERSION, nvmDir),
+		fmt.Sprintf(
+			"NODE_HOME=$(sudo bash -c 'export NVM_DIR=%s && . $NVM_DIR/nvm.sh && nvm install %s >&2 && dirname \"$(dirname \"$(nvm which %s)\")\"')",
+			nvmDir, nodeVersion, nodeVersion,
+		),
+	}
+}
+
+// Installs the pinned fnm release of the current architecture, which then installs Node.js
+func getCommandsInstallingNodeWithFnm(nodeVersion string) []string {
+	return []string{
+		"sudo apt install -y curl unzip",
+		"FNM_ZIP=$(dpkg --print-architecture | sed -e 's/^amd64$/fnm-linux.zip/' -e 's/^arm64$/fnm-arm64.zip/' -e 's/^armhf$/fnm-arm32.zip/')",
+		fmt.Sprintf(
+			"if ! fnm --version 2>/dev/null | grep -q -F %s; then cd /tmp && curl -fsSLO https://github.com/Schniz/fnm/releases/download/v%s/$FNM_ZIP && sudo unzip -o $FNM_ZIP fnm -d /usr/local/bin && sudo chmod 755 /usr/local/bin/fnm && rm $FNM_ZIP && cd -; fi",
+			FNM_VERSION, FNM_VERSION,
+		),
+		fmt.Sprintf("sudo fnm --fnm-dir %s install %s", fnmDir, nodeVersion),
+		fmt.Sprintf("NODE_HOME=$(dirname \"$(dirname \"$(sudo fnm --fnm-dir %s exec --using=%s -- node -p process.execPath)\")\")", fnmDir, nodeVersion),
+	}
+}
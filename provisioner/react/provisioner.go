@@ -6,18 +6,22 @@
 package react
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/file-provisioner"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/shell"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/systemd"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"os"
 	"path/filepath"
-	"text/template"
+	"regexp"
+	"sort"
+	"strings"
 )
 
 // PORT Default port of React app
@@ -26,13 +30,45 @@ const PORT string = "3000"
 // NODE_VERSION Default node version running the React app
 const NODE_VERSION = "18"
 
+// SERVICE_NAME The name of the systemd service serving the React app
+const SERVICE_NAME string = "react-app"
+
+// SERVICE_USER The dedicated system user running the React app
+const SERVICE_USER string = "react"
+
+// APP_DIR The directory in remote machine that the React app is served from
+const APP_DIR string = "/opt/react-app"
+
+// DEFAULT_HASHED_ASSET_PATHS Default locations of the content-hashed assets of create-react-app and Vite builds
+var DEFAULT_HASHED_ASSET_PATHS = []string{"/static/", "/assets/"}
+
+// The file types that are precompressed in staticMode
+var compressibleExtensions = []string{"html", "js", "mjs", "css", "json", "map", "svg", "txt", "xml", "wasm"}
+
+var environmentVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 type Config struct {
-	DistSource       string `mapstructure:"distSource" required:"true"`
-	SslCertBase64    string `mapstructure:"sslCertBase64" required:"true"`
-	SslCertKeyBase64 string `mapstructure:"sslCertKeyBase64" required:"true"`
-	AppDomain        string `mapstructure:"appDomain" required:"true"`
-	NodeVersion      string `mapstructure:"nodeVersion" required:"false"`
-	HomeDir          string `mapstructure:"homeDir" required:"false"`
+	DistSource       string            `mapstructure:"distSource" required:"false"`
+	SslCertBase64    string            `mapstructure:"sslCertBase64" required:"true"`
+	SslCertKeyBase64 string            `mapstructure:"sslCertKeyBase64" required:"true"`
+	AppDomain        string            `mapstructure:"appDomain" required:"true"`
+	NodeVersion      string            `mapstructure:"nodeVersion" required:"false"`
+	NodeInstall      string            `mapstructure:"nodeInstall" required:"false"`
+	HomeDir          string            `mapstructure:"homeDir" required:"false"`
+	Port             string            `mapstructure:"port" required:"false"`
+	Environment      map[string]string `mapstructure:"environment" required:"false"`
+	StaticMode       bool              `mapstructure:"staticMode" required:"false"`
+	Brotli           bool              `mapstructure:"brotli" required:"false"`
+	RuntimeEnv       map[string]string `mapstructure:"runtimeEnv" required:"false"`
+	RuntimeEnvSource string            `mapstructure:"runtimeEnvSource" required:"false"`
+	SourceDir        string            `mapstructure:"sourceDir" required:"false"`
+	BuildCommand     string            `mapstructure:"buildCommand" required:"false"`
+	BuildOutputDir   string            `mapstructure:"buildOutputDir" required:"false"`
+	SsrFramework     string            `mapstructure:"ssrFramework" required:"false"`
+	Apps             []App             `mapstructure:"app" required:"false"`
+
+	Site       `mapstructure:",squash"`
+	ssl.Config `mapstructure:",squash"`
 
 	ctx interpolate.Context
 }
@@ -46,94 +82,473 @@ func (p *Provisioner) ConfigSpec() hcldec.ObjectSpec {
 }
 
 func (p *Provisioner) Prepare(raws ...interface{}) error {
+	return p.prepare(false, raws...)
+}
+
+// Decodes and validates the config. Provisioners that are always in staticMode turn it on after decoding, since
+// decoding HCL2 resets the config
+func (p *Provisioner) prepare(staticMode bool, raws ...interface{}) error {
 	err := config.Decode(&p.config, nil, raws...)
 	if err != nil {
 		return err
 	}
+	if staticMode {
+		p.config.StaticMode = true
+	}
 
-	return nil
+	err = p.config.Config.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = validateNodeInstall(p.config.NodeInstall, p.config.NodeVersion)
+	if err != nil {
+		return err
+	}
+
+	if (p.config.DistSource == "") == (p.config.SourceDir == "") {
+		return fmt.Errorf("exactly one of distSource and sourceDir must be configured")
+	}
+	if p.config.SourceDir != "" {
+		if _, err = packageManager(p.config.SourceDir); err != nil {
+			return err
+		}
+	} else if p.config.BuildCommand != "" || p.config.BuildOutputDir != "" {
+		return fmt.Errorf("buildCommand and buildOutputDir require sourceDir")
+	}
+
+	for name := range p.config.Environment {
+		if !environmentVariableName.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name '%s'", name)
+		}
+	}
+
+	if p.config.StaticMode && p.config.ProxyBackend != "" && p.config.ProxyBackend != ssl.NginxBackend {
+		return fmt.Errorf("staticMode is only supported by the '%s' proxyBackend", ssl.NginxBackend)
+	}
+	if p.config.Brotli && !p.config.StaticMode {
+		return fmt.Errorf("brotli requires staticMode")
+	}
+
+	err = p.config.validateRuntimeEnv()
+	if err != nil {
+		return err
+	}
+
+	err = p.config.validateSsr()
+	if err != nil {
+		return err
+	}
+
+	err = p.config.validateSite()
+	if err != nil {
+		return err
+	}
+
+	err = p.config.validateApps()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.config.NginxConfig(p.config.AppDomain, p.config.port(), p.config.builtInNginxConfig())
+	return err
+}
+
+// Returns the built-in Nginx config, which either serves the dist directly in staticMode or proxies to the service
+// serving it otherwise, together with the apps under the path prefixes of appDomain. Nginx serves the assets of a
+// server-side rendering framework directly; the other proxy backends proxy them to the server as well
+func (c Config) builtInNginxConfig() nginx.Config {
+	if c.StaticMode {
+		return c.withApps(c.AppDomain, getStaticNginxConfig(c.AppDomain, c.site(), c.Brotli, len(c.RuntimeEnv) > 0))
+	}
+
+	nginxConfig := getNginxConfig(c.AppDomain, c.port(), c.Config)
+	if framework, ok := ssrFrameworks[c.SsrFramework]; ok && (c.ProxyBackend == "" || c.ProxyBackend == ssl.NginxBackend) {
+		nginxConfig.Servers[0].Locations = append(nginxConfig.Servers[0].Locations, ssrAssetLocation(framework))
+	}
+	return c.withApps(c.AppDomain, nginxConfig)
+}
+
+func (c Config) port() string {
+	if c.Port == "" {
+		return PORT
+	}
+	return c.Port
 }
 
 func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, communicator packersdk.Communicator, generatedData map[string]interface{}) error {
 	p.config.HomeDir = ssl.GetHomeDir(p.config.HomeDir)
 
-	distFileDst := fmt.Sprintf(filepath.Join(p.config.HomeDir, "dist"))
-	err := file.Provision(p.config.ctx, ui, communicator, p.config.DistSource, distFileDst)
+	var err error
+	if p.config.SourceDir != "" {
+		err = p.uploadSource(ui, communicator)
+	} else {
+		distFileDst := fmt.Sprintf(filepath.Join(p.config.HomeDir, "dist"))
+		err = file.Provision(p.config.ctx, ui, communicator, p.config.DistSource, distFileDst)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, app := range p.config.Apps {
+		err = file.Provision(p.config.ctx, ui, communicator, app.DistSource, filepath.Join(p.config.HomeDir, appDistFilename(i)))
+		if err != nil {
+			return err
+		}
+	}
+
+	if !p.config.StaticMode {
+		err = p.uploadServiceFiles(ctx, ui, communicator)
+		if err != nil {
+			return err
+		}
+	}
+
+	commands, err := p.config.getCommands()
+	if err != nil {
+		return err
+	}
+	err = shell.Provision(ctx, ui, communicator, commands)
+	if err != nil {
+		return err
+	}
+
+	if len(p.config.RuntimeEnv) > 0 {
+		err = p.provisionEnvConfig(ctx, ui, communicator)
+		if err != nil {
+			return err
+		}
+	}
+
+	nginxConfig, err := p.config.NginxConfig(p.config.AppDomain, p.config.port(), p.config.builtInNginxConfig())
 	if err != nil {
 		return err
 	}
 
-	if p.config.NodeVersion == "" {
-		p.config.NodeVersion = NODE_VERSION
+	owner := ssl.Owner("react-provisioner", generatedData)
+	err = ssl.Provision(
+		ctx,
+		p.config.ctx,
+		ui,
+		communicator,
+		p.config.HomeDir,
+		owner,
+		p.config.AppDomain,
+		p.config.SslCertBase64,
+		p.config.SslCertKeyBase64,
+		p.config.Config,
+		nginxConfig,
+	)
+	if err != nil {
+		return err
+	}
+
+	return p.provisionAppDomains(ctx, ui, communicator, owner)
+}
+
+// Installs the site of every domain, other than appDomain, that serves apps with its own certificate
+func (p *Provisioner) provisionAppDomains(ctx context.Context, ui packersdk.Ui, communicator packersdk.Communicator, owner string) error {
+	domains, err := p.config.appDomains()
+	if err != nil {
+		return err
+	}
+
+	for _, domain := range domains {
+		err = ssl.Provision(
+			ctx,
+			p.config.ctx,
+			ui,
+			communicator,
+			p.config.HomeDir,
+			owner,
+			domain.domain,
+			domain.sslCertBase64,
+			domain.sslCertKeyBase64,
+			p.config.Config,
+			p.config.appNginxConfig(domain.domain),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Uploads the source of the React app as a tarball, which is built in remote machine
+func (p *Provisioner) uploadSource(ui packersdk.Ui, communicator packersdk.Communicator) error {
+	archive, err := archiveSource(p.config.SourceDir)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive)
+
+	return file.Provision(p.config.ctx, ui, communicator, archive, filepath.Join(p.config.HomeDir, sourceArchiveFilename))
+}
+
+// Uploads the unit and environment file of the service serving the dist
+func (p *Provisioner) uploadServiceFiles(ctx context.Context, ui packersdk.Ui, communicator packersdk.Communicator) error {
+	unitFileDst := filepath.Join(p.config.HomeDir, SERVICE_NAME+".service")
+	err := ssl.Upload(p.config.ctx, ui, communicator, getService(p.config.port(), p.config.SsrFramework).Render(), unitFileDst)
+	if err != nil {
+		return err
+	}
+
+	return ssl.UploadPrivate(ctx, ui, communicator, getEnvironmentFile(p.config.Environment), SERVICE_NAME+".env")
+}
+
+// Returns all commands deploying the uploaded dist, or building it from the uploaded source first, and publishing the
+// dists of the apps. Node is only installed if it builds the source or runs the service serving the dist
+func (c Config) getCommands() ([]string, error) {
+	// The distribution packages come in the version of the distribution, e.g. Node.js 12 on Ubuntu 22.04, rather than in
+	// NODE_VERSION
+	nodeVersion := c.NodeVersion
+	if nodeVersion == "" && c.NodeInstall != DistroNodeInstall {
+		nodeVersion = NODE_VERSION
+	}
+
+	commands := getCommandsUpdatingUbuntu()
+	if c.SourceDir != "" || !c.StaticMode {
+		commands = append(commands, getCommandsInstallingNode(c.NodeInstall, nodeVersion)...)
+	}
+
+	if c.SourceDir != "" {
+		manager, err := packageManager(c.SourceDir)
+		if err != nil {
+			return nil, err
+		}
+
+		buildCommand := c.BuildCommand
+		if buildCommand == "" {
+			buildCommand = defaultBuildCommand(manager)
+		}
+		outputDir := c.site().buildOutputDir
+		var prepareCommands []string
+		if framework, ok := ssrFrameworks[c.SsrFramework]; ok {
+			if c.BuildOutputDir == "" {
+				outputDir = framework.buildOutputDir
+			}
+			prepareCommands = framework.prepareCommands
+		}
+
+		commands = append(commands, getCommandsBuildingSource(c.HomeDir, manager, buildCommand, prepareCommands, outputDir)...)
+	}
+
+	if c.StaticMode {
+		commands = append(commands, getStaticCommands(c.HomeDir, c.AppDomain, c.Brotli)...)
+	} else {
+		commands = append(commands, getCommandsInstallingService(c.HomeDir, c.port(), c.SsrFramework)...)
 	}
-	err = shell.Provision(ctx, ui, communicator, getCommands(p.config.NodeVersion))
+	return append(commands, c.getCommandsPublishingApps()...), nil
+}
+
+// Writes the runtime environment into the dist and installs the oneshot service regenerating it at boot, if configured
+func (p *Provisioner) provisionEnvConfig(ctx context.Context, ui packersdk.Ui, communicator packersdk.Communicator) error {
+	uploads, err := p.config.getEnvConfigUploads()
 	if err != nil {
 		return err
 	}
 
-	return ssl.Provision(ctx, p.config.ctx, ui, communicator, p.config.HomeDir, p.config.SslCertBase64, p.config.SslCertKeyBase64, getNginxConfig(p.config.AppDomain))
+	for filename, content := range uploads {
+		err = ssl.Upload(p.config.ctx, ui, communicator, content, filepath.Join(p.config.HomeDir, filename))
+		if err != nil {
+			return err
+		}
+	}
+
+	return shell.Provision(ctx, ui, communicator, getCommandsInstallingEnvConfig(p.config.HomeDir, p.config.distDir(), p.config.RuntimeEnvSource))
 }
 
-func getNginxConfig(domain string) string {
-	var sslConfigs = struct {
-		Domain        string
-		SslCertDst    string
-		SslCertKeyDst string
-		Port          string
-	}{domain, ssl.SslCertDst, ssl.SslCertKeyDst, PORT}
-	var buf bytes.Buffer
-	t := template.Must(template.New("Nginx Config").Parse(`
-server {
-    listen 80 default_server;
-    listen [::]:80 default_server;
+func getNginxConfig(domain string, port string, sslConfig ssl.Config) nginx.Config {
+	webSocket := true
+	return nginx.Config{
+		Servers: []nginx.Server{
+			{
+				Listens:     nginx.SslListens("443"),
+				ServerNames: []string{domain},
+				Root:        nginx.DefaultRoot,
+				Index:       nginx.DefaultIndex,
+				TLS:         ssl.NginxTls(domain),
+				Locations: []nginx.Location{
+					{
+						Path: "/",
+						// Keeps WebSocket connections, e.g. hot reloading of dev servers, working through the proxy
+						Proxy:     sslConfig.ProxyWithDefaults(nginx.Proxy{WebSocket: &webSocket}),
+						ProxyPass: "http://localhost:" + port,
+					},
+				},
+			},
+			nginx.RedirectServer(domain),
+		},
+	}
+}
 
-    root /var/www/html;
+// Returns the Nginx config serving the dist of a domain directly from staticRoot(domain). With SpaRouting, unknown
+// paths fall back to index.html, so that client-side routes survive page reloads. Missing assets are answered with 404
+// instead of index.html, so that browsers do not cache HTML as scripts.
+//
+// Responses are compressed on the fly and precompressed files are preferred
+func getStaticNginxConfig(domain string, site sitePreset, brotli bool, envConfig bool) nginx.Config {
+	return nginx.Config{
+		Servers: []nginx.Server{
+			{
+				Listens:     nginx.SslListens("443"),
+				ServerNames: []string{domain},
+				Root:        staticRoot(domain),
+				Index:       []string{"index.html"},
+				TLS:         ssl.NginxTls(domain),
+				Directives:  compressionDirectives(brotli),
+				Locations:   site.locations("/", "", envConfig),
+			},
+			nginx.RedirectServer(domain),
+		},
+	}
+}
 
-    index index.html index.htm index.nginx-debian.html;
+// Returns the directives compressing responses with gzip, and optionally brotli, preferring precompressed files
+func compressionDirectives(brotli bool) []nginx.Directive {
+	compressedTypes := []string{
+		"text/plain", "text/css", "text/xml", "application/javascript", "application/json", "application/xml",
+		"application/wasm", "image/svg+xml",
+	}
 
-    server_name _;
+	directives := []nginx.Directive{
+		nginx.NewDirective("gzip", "on"),
+		nginx.NewDirective("gzip_static", "on"),
+		nginx.NewDirective("gzip_vary", "on"),
+		nginx.NewDirective("gzip_comp_level", "6"),
+		nginx.NewDirective("gzip_types", compressedTypes...),
+	}
+	if brotli {
+		directives = append(
+			directives,
+			nginx.NewDirective("brotli", "on"),
+			nginx.NewDirective("brotli_static", "on"),
+			nginx.NewDirective("brotli_comp_level", "6"),
+			nginx.NewDirective("brotli_types", compressedTypes...),
+		)
+	}
+	return directives
+}
 
-    location / {
-        try_files $uri $uri/ =404;
-    }
+// Returns the Nginx web root of the dist of a domain in staticMode, e.g. /var/www/app.mycompany.com
+func staticRoot(domain string) string {
+	return filepath.Join(filepath.Dir(nginx.DefaultRoot), domain)
 }
 
-server {
-    root /var/www/html;
+// Returns the commands moving the uploaded dist into the web root of a domain and precompressing its text files, so
+// that Nginx serves them without compressing them on every request.
+//
+// Brotli is supported by the Nginx modules packaged since Ubuntu 24.04
+func getStaticCommands(homeDir string, domain string, brotli bool) []string {
+	var commands []string
+	if brotli {
+		commands = append(commands, "sudo apt install -y brotli libnginx-mod-http-brotli-filter libnginx-mod-http-brotli-static")
+	}
+	return append(commands, getCommandsPublishing(filepath.Join(homeDir, "dist"), staticRoot(domain), brotli)...)
+}
 
-    index index.html index.htm index.nginx-debian.html;
-    server_name {{.Domain}};
+// Returns the commands replacing a web root with an uploaded dist and precompressing its text files, optionally with
+// brotli as well
+func getCommandsPublishing(dist string, root string, brotli bool) []string {
+	var names []string
+	for _, extension := range compressibleExtensions {
+		names = append(names, fmt.Sprintf("-name '*.%s'", extension))
+	}
+	findCompressible := fmt.Sprintf("sudo find %s -type f \\( %s \\)", root, strings.Join(names, " -o "))
 
-    location / {
-        proxy_pass http://localhost:{{.Port}};
-    }
+	commands := []string{
+		fmt.Sprintf("sudo mkdir -p %s && sudo rm -rf %s", filepath.Dir(root), root),
+		fmt.Sprintf("sudo mv %s %s", dist, root),
+		fmt.Sprintf("sudo chown -R root:root %s && sudo chmod -R a+rX %s", root, root),
+		findCompressible + " -exec sudo gzip -k -f -9 {} \\;",
+	}
+	if brotli {
+		commands = append(commands, findCompressible+" -exec sudo brotli -k -f -q 11 {} \\;")
+	}
 
-    listen [::]:443 ssl ipv6only=on;
-    listen 443 ssl;
-    ssl_certificate {{.SslCertDst}};
-    ssl_certificate_key {{.SslCertKeyDst}};
+	return commands
 }
-server {
-    if ($host = {{.Domain}}) {
-        return 301 https://$host$request_uri;
-    }
 
-    listen 80 ;
-    listen [::]:80 ;
-    server_name {{.Domain}};
-    return 404;
+// Returns the systemd service serving the React app at boot. Without a server-side rendering framework, "serve" runs in
+// single-page-app mode, i.e. it answers unknown paths with index.html, so that client-side routes survive page
+// reloads. The server of a framework runs in production mode instead, bound to the loopback interface, since Nginx
+// proxies to it. The environment file overrides the variables set here
+func getService(port string, ssrFrameworkName string) systemd.Service {
+	workingDirectory := APP_DIR
+	execStart := fmt.Sprintf("/usr/bin/env serve -s dist -l %s", port)
+	var environment []string
+	if framework, ok := ssrFrameworks[ssrFrameworkName]; ok {
+		workingDirectory = filepath.Join(APP_DIR, "dist")
+		execStart = framework.execStart
+		environment = []string{"NODE_ENV=production", "PORT=" + port, framework.hostVariable + "=127.0.0.1"}
+	}
+
+	return systemd.Service{
+		Description:      "React app",
+		After:            []string{"network-online.target"},
+		User:             SERVICE_USER,
+		Group:            SERVICE_USER,
+		WorkingDirectory: workingDirectory,
+		EnvironmentFiles: []string{"-" + systemd.EnvironmentFileDst(SERVICE_NAME)},
+		Environment:      environment,
+		ExecStart:        execStart,
+		Restart:          "always",
+		RestartSec:       "5",
+		Directives: [][2]string{
+			{"NoNewPrivileges", "true"},
+			{"ProtectSystem", "full"},
+			{"ProtectHome", "true"},
+			{"PrivateTmp", "true"},
+		},
+	}
 }
-	`))
 
-	if err := t.Execute(&buf, sslConfigs); err != nil {
-		panic(err)
+// Returns the environment file of the React app service with one "NAME=value" line per variable, sorted by name.
+// Values are quoted, so that they can contain spaces, quotes and backslashes
+func getEnvironmentFile(environment map[string]string) string {
+	names := make([]string, 0, len(environment))
+	for name := range environment {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	return buf.String()
+	quoter := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+	var builder strings.Builder
+	for _, name := range names {
+		builder.WriteString(fmt.Sprintf("%s=\"%s\"\n", name, quoter.Replace(environment[name])))
+	}
+	return builder.String()
 }
 
-func getCommands(nodeVersion string) []string {
-	return append(getCommandsUpdatingUbuntu(), getCommandsInstallingNode(nodeVersion)...)
+// Returns the commands moving the uploaded dist, or the build output of a server-side rendering framework, into APP_DIR
+// and starting the service serving it as SERVICE_USER. The environment file may contain secrets, so it is streamed into
+// ssl.PrivateStagingDir and installed next to the unit as only readable by root, since systemd reads it before dropping
+// privileges. The build fails unless the app answers on its port
+func getCommandsInstallingService(homeDir string, port string, ssrFrameworkName string) []string {
+	environmentFile := systemd.EnvironmentFileDst(SERVICE_NAME)
+	stagedEnvironmentFile := ssl.PrivateStagingPath(SERVICE_NAME + ".env")
+
+	commands := []string{shell.CommandCleaningUpOnExit(fmt.Sprintf("sudo shred -u -f %s 2>/dev/null", stagedEnvironmentFile))}
+	commands = append(commands, systemd.CommandsCreatingUser(SERVICE_USER)...)
+	commands = append(
+		commands,
+		fmt.Sprintf("sudo mkdir -p %s && sudo rm -rf %s/dist", APP_DIR, APP_DIR),
+		fmt.Sprintf("sudo mv %s/dist %s/dist", homeDir, APP_DIR),
+	)
+	if framework, ok := ssrFrameworks[ssrFrameworkName]; ok && framework.productionDependencies {
+		commands = append(commands, getCommandsInstallingProductionDependencies()...)
+	}
+	commands = append(
+		commands,
+		fmt.Sprintf("sudo chown -R root:root %s && sudo chmod -R a+rX %s", APP_DIR, APP_DIR),
+		ssl.CommandInstallingPrivateFile(stagedEnvironmentFile, environmentFile, "root", "600"),
+		ssl.CommandCheckingPermissions(environmentFile, "root", "600"),
+	)
+	commands = append(commands, systemd.CommandsInstallingUnit(filepath.Join(homeDir, SERVICE_NAME+".service"), SERVICE_NAME)...)
+	commands = append(commands, systemd.CommandsStartingService(SERVICE_NAME)...)
+	return append(commands, systemd.CommandsCheckingHealth(SERVICE_NAME, fmt.Sprintf("http://127.0.0.1:%s/", port))...)
 }
 
 func getCommandsUpdatingUbuntu() []string {
@@ -142,13 +557,3 @@ func getCommandsUpdatingUbuntu() []string {
 		"sudo apt install software-properties-common -y",
 	}
 }
-
-func getCommandsInstallingNode(nodeVersion string) []string {
-	return []string{
-		"sudo apt install -y curl",
-		fmt.Sprintf("curl -fsSL https://deb.nodesource.com/setup_%s.x | sudo -E bash -", nodeVersion),
-		"sudo apt install -y nodejs",
-		"sudo npm install -g yarn",
-		"sudo npm install -g serve",
-	}
-}
@@ -3,6 +3,7 @@
 package react
 
 import (
+	ssl "github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -10,12 +11,49 @@ import (
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
-	DistSource       *string `mapstructure:"distSource" required:"true" cty:"distSource" hcl:"distSource"`
-	SslCertBase64    *string `mapstructure:"sslCertBase64" required:"true" cty:"sslCertBase64" hcl:"sslCertBase64"`
-	SslCertKeyBase64 *string `mapstructure:"sslCertKeyBase64" required:"true" cty:"sslCertKeyBase64" hcl:"sslCertKeyBase64"`
-	AppDomain        *string `mapstructure:"appDomain" required:"true" cty:"appDomain" hcl:"appDomain"`
-	NodeVersion      *string `mapstructure:"nodeVersion" required:"false" cty:"nodeVersion" hcl:"nodeVersion"`
-	HomeDir          *string `mapstructure:"homeDir" required:"false" cty:"homeDir" hcl:"homeDir"`
+	DistSource          *string              `mapstructure:"distSource" required:"false" cty:"distSource" hcl:"distSource"`
+	SslCertBase64       *string              `mapstructure:"sslCertBase64" required:"true" cty:"sslCertBase64" hcl:"sslCertBase64"`
+	SslCertKeyBase64    *string              `mapstructure:"sslCertKeyBase64" required:"true" cty:"sslCertKeyBase64" hcl:"sslCertKeyBase64"`
+	AppDomain           *string              `mapstructure:"appDomain" required:"true" cty:"appDomain" hcl:"appDomain"`
+	NodeVersion         *string              `mapstructure:"nodeVersion" required:"false" cty:"nodeVersion" hcl:"nodeVersion"`
+	NodeInstall         *string              `mapstructure:"nodeInstall" required:"false" cty:"nodeInstall" hcl:"nodeInstall"`
+	HomeDir             *string              `mapstructure:"homeDir" required:"false" cty:"homeDir" hcl:"homeDir"`
+	Port                *string              `mapstructure:"port" required:"false" cty:"port" hcl:"port"`
+	Environment         map[string]string    `mapstructure:"environment" required:"false" cty:"environment" hcl:"environment"`
+	StaticMode          *bool                `mapstructure:"staticMode" required:"false" cty:"staticMode" hcl:"staticMode"`
+	Brotli              *bool                `mapstructure:"brotli" required:"false" cty:"brotli" hcl:"brotli"`
+	RuntimeEnv          map[string]string    `mapstructure:"runtimeEnv" required:"false" cty:"runtimeEnv" hcl:"runtimeEnv"`
+	RuntimeEnvSource    *string              `mapstructure:"runtimeEnvSource" required:"false" cty:"runtimeEnvSource" hcl:"runtimeEnvSource"`
+	SourceDir           *string              `mapstructure:"sourceDir" required:"false" cty:"sourceDir" hcl:"sourceDir"`
+	BuildCommand        *string              `mapstructure:"buildCommand" required:"false" cty:"buildCommand" hcl:"buildCommand"`
+	BuildOutputDir      *string              `mapstructure:"buildOutputDir" required:"false" cty:"buildOutputDir" hcl:"buildOutputDir"`
+	SsrFramework        *string              `mapstructure:"ssrFramework" required:"false" cty:"ssrFramework" hcl:"ssrFramework"`
+	Apps                []FlatApp            `mapstructure:"app" required:"false" cty:"app" hcl:"app"`
+	Framework           *string              `mapstructure:"framework" required:"false" cty:"framework" hcl:"framework"`
+	Routing             *string              `mapstructure:"routing" required:"false" cty:"routing" hcl:"routing"`
+	TrailingSlash       *string              `mapstructure:"trailingSlash" required:"false" cty:"trailingSlash" hcl:"trailingSlash"`
+	NotFoundPage        *string              `mapstructure:"notFoundPage" required:"false" cty:"notFoundPage" hcl:"notFoundPage"`
+	HashedAssetPaths    []string             `mapstructure:"hashedAssetPaths" required:"false" cty:"hashedAssetPaths" hcl:"hashedAssetPaths"`
+	AssetCacheControl   *string              `mapstructure:"assetCacheControl" required:"false" cty:"assetCacheControl" hcl:"assetCacheControl"`
+	PageCacheControl    *string              `mapstructure:"pageCacheControl" required:"false" cty:"pageCacheControl" hcl:"pageCacheControl"`
+	ProxyBackend        *string              `mapstructure:"proxyBackend" required:"false" cty:"proxyBackend" hcl:"proxyBackend"`
+	TlsProfile          *string              `mapstructure:"tlsProfile" required:"false" cty:"tlsProfile" hcl:"tlsProfile"`
+	HstsPreload         *bool                `mapstructure:"hstsPreload" required:"false" cty:"hstsPreload" hcl:"hstsPreload"`
+	OcspStapling        *bool                `mapstructure:"ocspStapling" required:"false" cty:"ocspStapling" hcl:"ocspStapling"`
+	Resolver            *string              `mapstructure:"resolver" required:"false" cty:"resolver" hcl:"resolver"`
+	NginxTemplate       *string              `mapstructure:"nginxTemplate" required:"false" cty:"nginxTemplate" hcl:"nginxTemplate"`
+	NginxTemplateVars   map[string]string    `mapstructure:"nginxTemplateVars" required:"false" cty:"nginxTemplateVars" hcl:"nginxTemplateVars"`
+	ProxyConnectTimeout *string              `mapstructure:"proxyConnectTimeout" required:"false" cty:"proxyConnectTimeout" hcl:"proxyConnectTimeout"`
+	ProxySendTimeout    *string              `mapstructure:"proxySendTimeout" required:"false" cty:"proxySendTimeout" hcl:"proxySendTimeout"`
+	ProxyReadTimeout    *string              `mapstructure:"proxyReadTimeout" required:"false" cty:"proxyReadTimeout" hcl:"proxyReadTimeout"`
+	ProxyBuffering      *bool                `mapstructure:"proxyBuffering" required:"false" cty:"proxyBuffering" hcl:"proxyBuffering"`
+	ProxyWebSocket      *bool                `mapstructure:"proxyWebSocket" required:"false" cty:"proxyWebSocket" hcl:"proxyWebSocket"`
+	ClientMaxBodySize   *string              `mapstructure:"clientMaxBodySize" required:"false" cty:"clientMaxBodySize" hcl:"clientMaxBodySize"`
+	SecurityHeaders     map[string]string    `mapstructure:"securityHeaders" required:"false" cty:"securityHeaders" hcl:"securityHeaders"`
+	RateLimit           *string              `mapstructure:"rateLimit" required:"false" cty:"rateLimit" hcl:"rateLimit"`
+	RateLimitBurst      *string              `mapstructure:"rateLimitBurst" required:"false" cty:"rateLimitBurst" hcl:"rateLimitBurst"`
+	AccessRules         []ssl.FlatAccessRule `mapstructure:"accessRule" required:"false" cty:"accessRule" hcl:"accessRule"`
+	ClientCaBase64      *string              `mapstructure:"clientCaBase64" required:"false" cty:"clientCaBase64" hcl:"clientCaBase64"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -30,12 +68,49 @@ func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec }
 // The decoded values from this spec will then be applied to a FlatConfig.
 func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"distSource":       &hcldec.AttrSpec{Name: "distSource", Type: cty.String, Required: false},
-		"sslCertBase64":    &hcldec.AttrSpec{Name: "sslCertBase64", Type: cty.String, Required: false},
-		"sslCertKeyBase64": &hcldec.AttrSpec{Name: "sslCertKeyBase64", Type: cty.String, Required: false},
-		"appDomain":        &hcldec.AttrSpec{Name: "appDomain", Type: cty.String, Required: false},
-		"nodeVersion":      &hcldec.AttrSpec{Name: "nodeVersion", Type: cty.String, Required: false},
-		"homeDir":          &hcldec.AttrSpec{Name: "homeDir", Type: cty.String, Required: false},
+		"distSource":          &hcldec.AttrSpec{Name: "distSource", Type: cty.String, Required: false},
+		"sslCertBase64":       &hcldec.AttrSpec{Name: "sslCertBase64", Type: cty.String, Required: false},
+		"sslCertKeyBase64":    &hcldec.AttrSpec{Name: "sslCertKeyBase64", Type: cty.String, Required: false},
+		"appDomain":           &hcldec.AttrSpec{Name: "appDomain", Type: cty.String, Required: false},
+		"nodeVersion":         &hcldec.AttrSpec{Name: "nodeVersion", Type: cty.String, Required: false},
+		"nodeInstall":         &hcldec.AttrSpec{Name: "nodeInstall", Type: cty.String, Required: false},
+		"homeDir":             &hcldec.AttrSpec{Name: "homeDir", Type: cty.String, Required: false},
+		"port":                &hcldec.AttrSpec{Name: "port", Type: cty.String, Required: false},
+		"environment":         &hcldec.AttrSpec{Name: "environment", Type: cty.Map(cty.String), Required: false},
+		"staticMode":          &hcldec.AttrSpec{Name: "staticMode", Type: cty.Bool, Required: false},
+		"brotli":              &hcldec.AttrSpec{Name: "brotli", Type: cty.Bool, Required: false},
+		"runtimeEnv":          &hcldec.AttrSpec{Name: "runtimeEnv", Type: cty.Map(cty.String), Required: false},
+		"runtimeEnvSource":    &hcldec.AttrSpec{Name: "runtimeEnvSource", Type: cty.String, Required: false},
+		"sourceDir":           &hcldec.AttrSpec{Name: "sourceDir", Type: cty.String, Required: false},
+		"buildCommand":        &hcldec.AttrSpec{Name: "buildCommand", Type: cty.String, Required: false},
+		"buildOutputDir":      &hcldec.AttrSpec{Name: "buildOutputDir", Type: cty.String, Required: false},
+		"ssrFramework":        &hcldec.AttrSpec{Name: "ssrFramework", Type: cty.String, Required: false},
+		"app":                 &hcldec.BlockListSpec{TypeName: "app", Nested: hcldec.ObjectSpec((*FlatApp)(nil).HCL2Spec())},
+		"framework":           &hcldec.AttrSpec{Name: "framework", Type: cty.String, Required: false},
+		"routing":             &hcldec.AttrSpec{Name: "routing", Type: cty.String, Required: false},
+		"trailingSlash":       &hcldec.AttrSpec{Name: "trailingSlash", Type: cty.String, Required: false},
+		"notFoundPage":        &hcldec.AttrSpec{Name: "notFoundPage", Type: cty.String, Required: false},
+		"hashedAssetPaths":    &hcldec.AttrSpec{Name: "hashedAssetPaths", Type: cty.List(cty.String), Required: false},
+		"assetCacheControl":   &hcldec.AttrSpec{Name: "assetCacheControl", Type: cty.String, Required: false},
+		"pageCacheControl":    &hcldec.AttrSpec{Name: "pageCacheControl", Type: cty.String, Required: false},
+		"proxyBackend":        &hcldec.AttrSpec{Name: "proxyBackend", Type: cty.String, Required: false},
+		"tlsProfile":          &hcldec.AttrSpec{Name: "tlsProfile", Type: cty.String, Required: false},
+		"hstsPreload":         &hcldec.AttrSpec{Name: "hstsPreload", Type: cty.Bool, Required: false},
+		"ocspStapling":        &hcldec.AttrSpec{Name: "ocspStapling", Type: cty.Bool, Required: false},
+		"resolver":            &hcldec.AttrSpec{Name: "resolver", Type: cty.String, Required: false},
+		"nginxTemplate":       &hcldec.AttrSpec{Name: "nginxTemplate", Type: cty.String, Required: false},
+		"nginxTemplateVars":   &hcldec.AttrSpec{Name: "nginxTemplateVars", Type: cty.Map(cty.String), Required: false},
+		"proxyConnectTimeout": &hcldec.AttrSpec{Name: "proxyConnectTimeout", Type: cty.String, Required: false},
+		"proxySendTimeout":    &hcldec.AttrSpec{Name: "proxySendTimeout", Type: cty.String, Required: false},
+		"proxyReadTimeout":    &hcldec.AttrSpec{Name: "proxyReadTimeout", Type: cty.String, Required: false},
+		"proxyBuffering":      &hcldec.AttrSpec{Name: "proxyBuffering", Type: cty.Bool, Required: false},
+		"proxyWebSocket":      &hcldec.AttrSpec{Name: "proxyWebSocket", Type: cty.Bool, Required: false},
+		"clientMaxBodySize":   &hcldec.AttrSpec{Name: "clientMaxBodySize", Type: cty.String, Required: false},
+		"securityHeaders":     &hcldec.AttrSpec{Name: "securityHeaders", Type: cty.Map(cty.String), Required: false},
+		"rateLimit":           &hcldec.AttrSpec{Name: "rateLimit", Type: cty.String, Required: false},
+		"rateLimitBurst":      &hcldec.AttrSpec{Name: "rateLimitBurst", Type: cty.String, Required: false},
+		"accessRule":          &hcldec.BlockListSpec{TypeName: "accessRule", Nested: hcldec.ObjectSpec((*ssl.FlatAccessRule)(nil).HCL2Spec())},
+		"clientCaBase64":      &hcldec.AttrSpec{Name: "clientCaBase64", Type: cty.String, Required: false},
 	}
 	return s
 }
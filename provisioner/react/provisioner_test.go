@@ -4,24 +4,269 @@
 package react
 
 import (
+	_ "embed"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"os/exec"
 	"reflect"
+	"strings"
 	"testing"
 )
 
+//go:embed test-fixtures/nginx-ssl.conf
+var expectedNginxConfig string
+
+//go:embed test-fixtures/nginx-static.conf
+var expectedStaticNginxConfig string
+
+//go:embed test-fixtures/react-app.service
+var expectedUnit string
+
+func Test_getNginxConfig(t *testing.T) {
+	actualNginxConfig := getNginxConfig("app.mycompany.com", PORT, ssl.Config{}).Render()
+
+	if actualNginxConfig != expectedNginxConfig {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expectedNginxConfig, actualNginxConfig)
+	}
+}
+
 func Test_getCommandsInstallingNode(t *testing.T) {
-	actualCommands := getCommandsInstallingNode("18")
+	actualCommands := getCommandsInstallingNode(TarballNodeInstall, "18.19.1")
+
+	expectedCommands := []string{
+		"sudo apt install -y curl xz-utils",
+		"NODE_ARCH=$(dpkg --print-architecture | sed -e 's/^amd64$/x64/' -e 's/^armhf$/armv7l/')",
+		"cd /tmp && curl -fsSLO https://nodejs.org/dist/v18.19.1/SHASUMS256.txt",
+		"NODE_TARBALL=$(grep -o -E \"node-v[0-9.]+-linux-$NODE_ARCH\\.tar\\.xz\" SHASUMS256.txt | head -n 1)",
+		"if [ -z \"$NODE_TARBALL\" ]; then echo \"No Node.js 18.19.1 tarball for $NODE_ARCH\" >&2; exit 1; fi",
+		"curl -fsSLO https://nodejs.org/dist/v18.19.1/$NODE_TARBALL && grep \" $NODE_TARBALL$\" SHASUMS256.txt | sha256sum -c -",
+		"NODE_HOME=/usr/local/lib/nodejs/${NODE_TARBALL%.tar.xz}",
+		"sudo mkdir -p /usr/local/lib/nodejs && sudo rm -rf $NODE_HOME && sudo tar -xJf $NODE_TARBALL -C /usr/local/lib/nodejs --no-same-owner",
+		"rm $NODE_TARBALL SHASUMS256.txt && cd -",
+
+		"if [ -n \"$NODE_HOME\" ]; then export PATH=$NODE_HOME/bin:$PATH; fi",
+		"NODE_INSTALLED=$(node --version); if [[ \"$NODE_INSTALLED\" != v18.19.1 && \"$NODE_INSTALLED\" != v18.19.1.* ]]; then echo \"Expected Node.js 18.19.1, got $NODE_INSTALLED\" >&2; exit 1; fi",
+
+		"sudo env PATH=$PATH npm install -g yarn@1.22.22 serve@14.2.3",
+		"if [ -n \"$NODE_HOME\" ]; then sudo ln -sf $NODE_HOME/bin/* /usr/local/bin/; fi",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, actualCommands) {
+		t.Errorf("Expected and actual commands do not match: %s\n\n%s", expectedCommands, actualCommands)
+	}
+
+	if latest := getCommandsInstallingNode(TarballNodeInstall, "20"); latest[2] != "cd /tmp && curl -fsSLO https://nodejs.org/dist/latest-v20.x/SHASUMS256.txt" {
+		t.Errorf("Expected a major version to resolve to its latest release: %s", latest)
+	}
+
+	for _, nodeInstall := range []string{NvmNodeInstall, FnmNodeInstall, DistroNodeInstall} {
+		commands := strings.Join(getCommandsInstallingNode(nodeInstall, "18"), "\n")
+		if strings.Contains(commands, "| sudo -E bash") || !strings.Contains(commands, "yarn@1.22.22 serve@14.2.3") {
+			t.Errorf("Unexpected commands installing Node.js with %s: %s", nodeInstall, commands)
+		}
+	}
+}
+
+// Runs the version check of the installed Node.js with a stub of node
+func Test_getCommandsInstallingNodeVersionCheck(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	data := []struct {
+		name        string
+		nodeInstall string
+		nodeVersion string
+		installed   string
+		error       string
+	}{
+		{"major version", TarballNodeInstall, "18", "v18.19.1", ""},
+		{"exact version", NvmNodeInstall, "18.19.1", "v18.19.1", ""},
+		{"other major version", TarballNodeInstall, "18", "v20.11.1", "Expected Node.js 18, got v20.11.1"},
+		{"other exact version", FnmNodeInstall, "18.19.1", "v18.19.10", "Expected Node.js 18.19.1, got v18.19.10"},
+		{"distro", DistroNodeInstall, "", "v12.22.9", ""},
+		{"distro with version", DistroNodeInstall, "18", "v12.22.9", "Expected Node.js 18, got v12.22.9"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			var check []string
+			for _, command := range getCommandsInstallingNode(d.nodeInstall, d.nodeVersion) {
+				if strings.HasPrefix(command, "NODE_INSTALLED=") {
+					check = append(check, command)
+				}
+			}
+
+			var stderr strings.Builder
+			cmd := exec.Command("bash", "-c", strings.Join(append([]string{"set -e", "node() { echo " + d.installed + "; }"}, check...), "\n"))
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+
+			if d.error == "" && err != nil {
+				t.Errorf("Expected the check to pass, got %s: %s", err, stderr.String())
+			}
+			if d.error != "" && (err == nil || !strings.Contains(stderr.String(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v: %s", d.error, err, stderr.String())
+			}
+		})
+	}
+}
+
+func Test_getCommandsWithDistroNode(t *testing.T) {
+	commands, err := Config{HomeDir: "/home/ubuntu", NodeInstall: DistroNodeInstall}.getCommands()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	joined := strings.Join(commands, "\n")
+	if !strings.Contains(joined, "sudo apt install -y nodejs npm") || strings.Contains(joined, "NODE_INSTALLED") {
+		t.Errorf("Expected the Node.js of the distribution without a version check: %s", joined)
+	}
+}
+
+func Test_validateNodeInstall(t *testing.T) {
+	data := []struct {
+		nodeInstall string
+		nodeVersion string
+		error       string
+	}{
+		{"", "", ""},
+		{NvmNodeInstall, "18", ""},
+		{FnmNodeInstall, "20.11.1", ""},
+		{"nodesource", "18", "unknown nodeInstall 'nodesource'"},
+		{"", "18.x", "invalid nodeVersion '18.x'"},
+		{"", "18.19", "invalid nodeVersion '18.19'"},
+		{"", "18; rm -rf /", "invalid nodeVersion"},
+	}
+
+	for _, d := range data {
+		err := validateNodeInstall(d.nodeInstall, d.nodeVersion)
+		if d.error == "" && err != nil {
+			t.Errorf("Expected no error, got %s", err)
+		}
+		if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+			t.Errorf("Expected error containing %q, got %v", d.error, err)
+		}
+	}
+}
+
+func Test_getService(t *testing.T) {
+	if actualUnit := getService("3000", "").Render(); actualUnit != expectedUnit {
+		t.Errorf("Expected and actual unit do not match: %s\n\n%s", expectedUnit, actualUnit)
+	}
+}
+
+func Test_getEnvironmentFile(t *testing.T) {
+	expected := "API_URL=\"https://api.mycompany.com\"\nGREETING=\"say \\\"hi\\\" \\\\o/\"\n"
+
+	actual := getEnvironmentFile(map[string]string{"GREETING": `say "hi" \o/`, "API_URL": "https://api.mycompany.com"})
+	if actual != expected {
+		t.Errorf("Expected and actual environment file do not match: %s\n\n%s", expected, actual)
+	}
+}
+
+func Test_getCommandsInstallingService(t *testing.T) {
+	actualCommands := getCommandsInstallingService("/home/ubuntu", "3000", "")
 
 	expectedCommands := []string{
-		"sudo apt install -y curl",
-		"curl -fsSL https://deb.nodesource.com/setup_18.x | sudo -E bash -",
-		"sudo apt install -y nodejs",
+		`EXIT_CLEANUPS="${EXIT_CLEANUPS:+$EXIT_CLEANUPS; }"'{ sudo shred -u -f /run/qubitpi-private/react-app.env 2>/dev/null; } || true'; trap 'eval "$EXIT_CLEANUPS"' EXIT`,
+		"if ! id react >/dev/null 2>&1; then sudo useradd --system --user-group --no-create-home --shell /usr/sbin/nologin react; fi",
+		"sudo mkdir -p /opt/react-app && sudo rm -rf /opt/react-app/dist",
+		"sudo mv /home/ubuntu/dist /opt/react-app/dist",
+		"sudo chown -R root:root /opt/react-app && sudo chmod -R a+rX /opt/react-app",
+		"sudo install -o root -g root -m 600 /run/qubitpi-private/react-app.env /etc/default/react-app && sudo shred -u /run/qubitpi-private/react-app.env",
+		`if [ "$(sudo stat -c '%U:%G %a' /etc/default/react-app)" != "root:root 600" ]; then echo "/etc/default/react-app must be owned by root:root with mode 600, got $(sudo stat -c '%U:%G %a' /etc/default/react-app)" >&2; exit 1; fi`,
+		"sudo install -o root -g root -m 644 /home/ubuntu/react-app.service /etc/systemd/system/react-app.service && rm /home/ubuntu/react-app.service",
+		"if [ -d /run/systemd/system ]; then sudo systemctl daemon-reload && sudo systemctl enable react-app && sudo systemctl restart react-app; else sudo mkdir -p /etc/systemd/system/multi-user.target.wants && sudo ln -sf /etc/systemd/system/react-app.service /etc/systemd/system/multi-user.target.wants/react-app.service && echo \"systemd is not running; react-app starts at next boot\"; fi",
+		"if [ -d /run/systemd/system ]; then for i in $(seq 30); do if curl -fsS -o /dev/null http://127.0.0.1:3000/; then break; fi; if [ $i -eq 30 ]; then echo \"react-app does not answer on http://127.0.0.1:3000/\" >&2; sudo journalctl -u react-app --no-pager -n 50 >&2; exit 1; fi; sleep 1; done; fi",
+	}
 
-		"sudo npm install -g yarn",
+	if !reflect.DeepEqual(expectedCommands, actualCommands) {
+		t.Errorf("Expected and actual commands do not match: %s\n\n%s", expectedCommands, actualCommands)
+	}
+}
+
+func Test_getStaticNginxConfig(t *testing.T) {
+	actualNginxConfig := getStaticNginxConfig("app.mycompany.com", Site{}.preset(""), true, true).Render()
 
-		"sudo npm install -g serve",
+	if actualNginxConfig != expectedStaticNginxConfig {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expectedStaticNginxConfig, actualNginxConfig)
+	}
+}
+
+func Test_getStaticCommands(t *testing.T) {
+	actualCommands := getStaticCommands("/home/ubuntu", "app.mycompany.com", false)
+
+	expectedCommands := []string{
+		"sudo mkdir -p /var/www && sudo rm -rf /var/www/app.mycompany.com",
+		"sudo mv /home/ubuntu/dist /var/www/app.mycompany.com",
+		"sudo chown -R root:root /var/www/app.mycompany.com && sudo chmod -R a+rX /var/www/app.mycompany.com",
+		"sudo find /var/www/app.mycompany.com -type f \\( -name '*.html' -o -name '*.js' -o -name '*.mjs' -o -name '*.css' -o -name '*.json' -o -name '*.map' -o -name '*.svg' -o -name '*.txt' -o -name '*.xml' -o -name '*.wasm' \\) -exec sudo gzip -k -f -9 {} \\;",
 	}
 
 	if !reflect.DeepEqual(expectedCommands, actualCommands) {
 		t.Errorf("Expected and actual commands do not match: %s\n\n%s", expectedCommands, actualCommands)
 	}
+
+	if withBrotli := getStaticCommands("/home/ubuntu", "app.mycompany.com", true); len(withBrotli) != len(actualCommands)+2 {
+		t.Errorf("Expected brotli to be installed and applied: %s", withBrotli)
+	}
+}
+
+func TestPrepareStaticMode(t *testing.T) {
+	data := []struct {
+		name   string
+		config map[string]interface{}
+		error  string
+	}{
+		{"static mode", map[string]interface{}{"staticMode": true, "brotli": true}, ""},
+		{"brotli without static mode", map[string]interface{}{"brotli": true}, "brotli requires staticMode"},
+		{"caddy", map[string]interface{}{"staticMode": true, "proxyBackend": "caddy"}, "staticMode is only supported by the 'nginx' proxyBackend"},
+		{"invalid asset path", map[string]interface{}{"staticMode": true, "hashedAssetPaths": []string{"/static"}}, "must start and end with '/'"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			d.config["appDomain"] = "app.mycompany.com"
+			d.config["distSource"] = "dist"
+			err := (&Provisioner{}).Prepare(d.config)
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func Test_getCommands(t *testing.T) {
+	static, err := Config{HomeDir: "/home/ubuntu", AppDomain: "app.mycompany.com", StaticMode: true}.getCommands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range static {
+		if strings.Contains(command, "node") {
+			t.Errorf("Expected no Node installation in staticMode: %s", command)
+		}
+	}
+
+	sourceDir := t.TempDir()
+	writeFiles(t, sourceDir, map[string]string{"package.json": "{}", "yarn.lock": ""})
+
+	fromSource, err := Config{HomeDir: "/home/ubuntu", AppDomain: "app.mycompany.com", StaticMode: true, SourceDir: sourceDir, BuildOutputDir: "build"}.getCommands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := strings.Join(fromSource, "\n")
+	for _, expected := range []string{
+		"curl -fsSLO https://nodejs.org/dist/latest-v18.x/SHASUMS256.txt",
+		"yarn install --frozen-lockfile",
+		"\nyarn build\n",
+		"rm -rf /home/ubuntu/dist && mv /home/ubuntu/source/build /home/ubuntu/dist",
+		"sudo mv /home/ubuntu/dist /var/www/app.mycompany.com",
+	} {
+		if !strings.Contains(commands, expected) {
+			t.Errorf("Expected %q in commands: %s", expected, commands)
+		}
+	}
 }
@@ -0,0 +1,298 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package react
+
+import (
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"regexp"
+	"strings"
+)
+
+// The frameworks whose static build output has a preset
+const (
+	ReactFramework      string = "react"
+	ViteFramework       string = "vite"
+	VueFramework        string = "vue"
+	AngularFramework    string = "angular"
+	SvelteFramework     string = "svelte"
+	DocusaurusFramework string = "docusaurus"
+)
+
+// How Nginx maps paths to the files of a static site
+const (
+	// SpaRouting answers unknown paths with index.html, which routes them on the client
+	SpaRouting string = "spa"
+
+	// DirectoryRouting answers a path with its file, the index.html of its directory, or its .html file, in this order,
+	// as generated by static site generators
+	DirectoryRouting string = "directory"
+)
+
+// How Nginx redirects paths with or without a trailing slash
+const (
+	AlwaysTrailingSlash string = "always"
+	NeverTrailingSlash  string = "never"
+)
+
+// DEFAULT_ASSET_CACHE_CONTROL Default Cache-Control of the content-hashed assets, which never change
+const DEFAULT_ASSET_CACHE_CONTROL string = "public, max-age=31536000, immutable"
+
+// DEFAULT_PAGE_CACHE_CONTROL Default Cache-Control of the pages, which are revalidated on every request
+const DEFAULT_PAGE_CACHE_CONTROL string = "no-cache"
+
+// StaticSiteProvisioner deploys the static build of any single-page app or static site generator, e.g. Vue, Angular,
+// Svelte or Docusaurus, to Nginx. It is the React provisioner that is always in staticMode, which is therefore not one
+// of its options
+type StaticSiteProvisioner struct {
+	Provisioner
+}
+
+func (p *StaticSiteProvisioner) ConfigSpec() hcldec.ObjectSpec {
+	spec := p.Provisioner.ConfigSpec()
+	delete(spec, "staticMode")
+	return spec
+}
+
+func (p *StaticSiteProvisioner) Prepare(raws ...interface{}) error {
+	return p.prepare(true, raws...)
+}
+
+// Site contains the options of how Nginx serves a static site, which the app of appDomain and every app block share
+type Site struct {
+	Framework         string   `mapstructure:"framework" required:"false"`
+	Routing           string   `mapstructure:"routing" required:"false"`
+	TrailingSlash     string   `mapstructure:"trailingSlash" required:"false"`
+	NotFoundPage      string   `mapstructure:"notFoundPage" required:"false"`
+	HashedAssetPaths  []string `mapstructure:"hashedAssetPaths" required:"false"`
+	AssetCacheControl string   `mapstructure:"assetCacheControl" required:"false"`
+	PageCacheControl  string   `mapstructure:"pageCacheControl" required:"false"`
+}
+
+// How the static build output of a framework is built and served
+type sitePreset struct {
+	// The build output, relative to sourceDir; empty if it depends on the project
+	buildOutputDir string
+
+	routing       string
+	trailingSlash string
+	notFoundPage  string
+
+	hashedAssetPaths  []string
+	assetCacheControl string
+	pageCacheControl  string
+}
+
+// The preset without a framework, which covers create-react-app and Vite
+var defaultSitePreset = sitePreset{
+	buildOutputDir:   DEFAULT_BUILD_OUTPUT_DIR,
+	routing:          SpaRouting,
+	hashedAssetPaths: DEFAULT_HASHED_ASSET_PATHS,
+}
+
+var sitePresets = map[string]sitePreset{
+	// https://create-react-app.dev/docs/production-build
+	ReactFramework: {
+		buildOutputDir:   "build",
+		routing:          SpaRouting,
+		hashedAssetPaths: []string{"/static/"},
+	},
+	// https://vitejs.dev/guide/build
+	ViteFramework: {
+		buildOutputDir:   "dist",
+		routing:          SpaRouting,
+		hashedAssetPaths: []string{"/assets/"},
+	},
+	// https://cli.vuejs.org/guide/deployment.html
+	VueFramework: {
+		buildOutputDir:   "dist",
+		routing:          SpaRouting,
+		hashedAssetPaths: []string{"/assets/", "/js/", "/css/"},
+	},
+	// https://angular.dev/tools/cli/deployment; the build output is dist/<project>/browser and the hashed assets are at
+	// the root
+	AngularFramework: {
+		routing:          SpaRouting,
+		hashedAssetPaths: []string{},
+	},
+	// https://kit.svelte.dev/docs/adapter-static
+	SvelteFramework: {
+		buildOutputDir:   "build",
+		routing:          DirectoryRouting,
+		hashedAssetPaths: []string{"/_app/immutable/"},
+	},
+	// https://docusaurus.io/docs/deployment
+	DocusaurusFramework: {
+		buildOutputDir:   "build",
+		routing:          DirectoryRouting,
+		notFoundPage:     "/404.html",
+		hashedAssetPaths: []string{"/assets/"},
+	},
+}
+
+// Returns an error if the framework or the routing options are unknown or malformed
+func (s Site) validate() error {
+	if _, ok := sitePresets[s.Framework]; s.Framework != "" && !ok {
+		return fmt.Errorf(
+			"unknown framework '%s'; supported frameworks are '%s', '%s', '%s', '%s', '%s' and '%s'",
+			s.Framework, ReactFramework, ViteFramework, VueFramework, AngularFramework, SvelteFramework, DocusaurusFramework,
+		)
+	}
+
+	switch s.Routing {
+	case "", SpaRouting, DirectoryRouting:
+	default:
+		return fmt.Errorf("unknown routing '%s'; supported routings are '%s' and '%s'", s.Routing, SpaRouting, DirectoryRouting)
+	}
+
+	switch s.TrailingSlash {
+	case "", AlwaysTrailingSlash, NeverTrailingSlash:
+	default:
+		return fmt.Errorf(
+			"unknown trailingSlash '%s'; supported values are '%s' and '%s'", s.TrailingSlash, AlwaysTrailingSlash, NeverTrailingSlash,
+		)
+	}
+
+	if s.NotFoundPage != "" && !strings.HasPrefix(s.NotFoundPage, "/") {
+		return fmt.Errorf("notFoundPage '%s' must start with '/'", s.NotFoundPage)
+	}
+
+	for _, path := range s.HashedAssetPaths {
+		if !strings.HasPrefix(path, "/") || !strings.HasSuffix(path, "/") {
+			return fmt.Errorf("hashedAssetPath '%s' must start and end with '/'", path)
+		}
+	}
+
+	if strings.Contains(s.AssetCacheControl, "\"") || strings.Contains(s.PageCacheControl, "\"") {
+		return fmt.Errorf("assetCacheControl and pageCacheControl must not contain '\"'")
+	}
+
+	return nil
+}
+
+// Returns an error if the options of the static site are invalid, or are used outside staticMode
+func (c Config) validateSite() error {
+	if err := c.Site.validate(); err != nil {
+		return err
+	}
+
+	if preset, ok := sitePresets[c.Framework]; ok && preset.buildOutputDir == "" && c.SourceDir != "" && c.BuildOutputDir == "" {
+		return fmt.Errorf("framework '%s' requires buildOutputDir, e.g. 'dist/<project>/browser'", c.Framework)
+	}
+
+	if !c.StaticMode && (c.Framework != "" || c.Routing != "" || c.TrailingSlash != "" || c.NotFoundPage != "" ||
+		c.AssetCacheControl != "" || c.PageCacheControl != "") {
+		return fmt.Errorf("framework, routing, trailingSlash, notFoundPage, assetCacheControl and pageCacheControl require staticMode")
+	}
+
+	return nil
+}
+
+// Returns the preset of the framework overridden by the configured options
+func (s Site) preset(buildOutputDir string) sitePreset {
+	site, ok := sitePresets[s.Framework]
+	if !ok {
+		site = defaultSitePreset
+	}
+
+	if buildOutputDir != "" {
+		site.buildOutputDir = buildOutputDir
+	}
+	if s.Routing != "" {
+		site.routing = s.Routing
+	}
+	if s.TrailingSlash != "" {
+		site.trailingSlash = s.TrailingSlash
+	}
+	if s.NotFoundPage != "" {
+		site.notFoundPage = s.NotFoundPage
+	}
+	if s.HashedAssetPaths != nil {
+		site.hashedAssetPaths = s.HashedAssetPaths
+	}
+
+	site.assetCacheControl = DEFAULT_ASSET_CACHE_CONTROL
+	if s.AssetCacheControl != "" {
+		site.assetCacheControl = s.AssetCacheControl
+	}
+	site.pageCacheControl = DEFAULT_PAGE_CACHE_CONTROL
+	if s.PageCacheControl != "" {
+		site.pageCacheControl = s.PageCacheControl
+	}
+
+	return site
+}
+
+// Returns the preset of the app of appDomain
+func (c Config) site() sitePreset {
+	return c.Site.preset(c.BuildOutputDir)
+}
+
+// Returns the locations serving a site under a path prefix, e.g. "/" or "/docs/", from a web root. If the root is empty,
+// the root of the server applies, otherwise the prefix is a directory of the root.
+//
+// Trailing slashes are redirected before any file is looked up. Without a trailing slash, a directory is never looked up
+// by "$uri/", since Nginx would redirect it to the path with a trailing slash. The pages, i.e. index.html with
+// SpaRouting and every page with DirectoryRouting, are revalidated on every request by default, while the content-hashed
+// assets are cached for a year and answered with 404 if missing. The runtime environment, if any, is revalidated as well
+func (site sitePreset) locations(prefix string, root string, envConfig bool) []nginx.Location {
+	var common []nginx.Directive
+	if root != "" {
+		common = append(common, nginx.NewDirective("root", root))
+	}
+	pageCacheControl := nginx.NewDirective("add_header", "Cache-Control", "\""+site.pageCacheControl+"\"")
+
+	directives := append([]nginx.Directive{}, common...)
+	switch site.trailingSlash {
+	case AlwaysTrailingSlash:
+		// Only paths whose last segment has no file extension are pages
+		directives = append(directives, nginx.NewDirective("rewrite", "^(.*/[^/.]+)$", "$1/", "permanent"))
+	case NeverTrailingSlash:
+		directives = append(directives, nginx.NewDirective("rewrite", "^("+regexp.QuoteMeta(prefix)+".+)/$", "$1", "permanent"))
+	}
+	if site.notFoundPage != "" {
+		directives = append(directives, nginx.NewDirective("error_page", "404", prefix+strings.TrimPrefix(site.notFoundPage, "/")))
+	}
+
+	tryFiles := []string{"$uri", "$uri/", prefix + "index.html"}
+	if site.trailingSlash == NeverTrailingSlash {
+		tryFiles = []string{"$uri", prefix + "index.html"}
+	}
+	if site.routing == DirectoryRouting {
+		directives = append(directives, pageCacheControl)
+		tryFiles = []string{"$uri", "$uri/index.html", "$uri.html", "=404"}
+	}
+
+	var locations []nginx.Location
+	if prefix != "/" {
+		locations = append(locations, nginx.Location{
+			Path:       "= " + strings.TrimSuffix(prefix, "/"),
+			Directives: []nginx.Directive{nginx.NewDirective("return", "301", prefix)},
+		})
+	}
+	locations = append(
+		locations,
+		nginx.Location{Path: prefix, TryFiles: tryFiles, Directives: directives},
+		nginx.Location{Path: "= " + prefix + "index.html", Directives: append(append([]nginx.Directive{}, common...), pageCacheControl)},
+	)
+	if envConfig {
+		locations = append(locations, nginx.Location{
+			Path:       "= " + prefix + ENV_CONFIG_FILENAME,
+			Directives: append(append([]nginx.Directive{}, common...), pageCacheControl),
+		})
+	}
+	for _, path := range site.hashedAssetPaths {
+		locations = append(locations, nginx.Location{
+			Path:     prefix + strings.TrimPrefix(path, "/"),
+			TryFiles: []string{"$uri", "=404"},
+			Directives: append(
+				append([]nginx.Directive{}, common...),
+				nginx.NewDirective("add_header", "Cache-Control", "\""+site.assetCacheControl+"\""),
+			),
+		})
+	}
+
+	return locations
+}
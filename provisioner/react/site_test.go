@@ -0,0 +1,179 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package react
+
+import (
+	_ "embed"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//go:embed test-fixtures/nginx-directory.conf
+var expectedDirectoryNginxConfig string
+
+func TestPrepareSite(t *testing.T) {
+	data := []struct {
+		name   string
+		config map[string]interface{}
+		error  string
+	}{
+		{"docusaurus", map[string]interface{}{"staticMode": true, "framework": "docusaurus", "trailingSlash": "always"}, ""},
+		{"unknown framework", map[string]interface{}{"staticMode": true, "framework": "ember"}, "unknown framework 'ember'"},
+		{"unknown routing", map[string]interface{}{"staticMode": true, "routing": "hash"}, "unknown routing 'hash'"},
+		{"unknown trailing slash", map[string]interface{}{"staticMode": true, "trailingSlash": "sometimes"}, "unknown trailingSlash 'sometimes'"},
+		{"relative not found page", map[string]interface{}{"staticMode": true, "notFoundPage": "404.html"}, "must start with '/'"},
+		{"without static mode", map[string]interface{}{"framework": "vue"}, "require staticMode"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			d.config["appDomain"] = "app.mycompany.com"
+			d.config["distSource"] = "dist"
+			err := (&Provisioner{}).Prepare(d.config)
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func TestStaticSiteProvisionerPrepare(t *testing.T) {
+	provisioner := &StaticSiteProvisioner{}
+	err := provisioner.Prepare(map[string]interface{}{"appDomain": "app.mycompany.com", "distSource": "dist", "framework": "vue"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if !provisioner.config.StaticMode {
+		t.Errorf("Expected staticMode to be on")
+	}
+}
+
+// Decodes the config through the spec of the provisioner, as Packer does with HCL2 templates
+func TestStaticSiteProvisionerPrepareHcl2(t *testing.T) {
+	provisioner := &StaticSiteProvisioner{}
+
+	file, diags := hclsyntax.ParseConfig(
+		[]byte("appDomain = \"app.mycompany.com\"\ndistSource = \"dist\"\nframework = \"vue\"\n"), "static-site.pkr.hcl", hcl.InitialPos,
+	)
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	value, diags := hcldec.Decode(file.Body, provisioner.ConfigSpec(), nil)
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+
+	if err := provisioner.Prepare(value); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if !provisioner.config.StaticMode || provisioner.config.Framework != VueFramework {
+		t.Errorf("Expected staticMode to be on after decoding: %v", provisioner.config)
+	}
+
+	file, _ = hclsyntax.ParseConfig([]byte("staticMode = false\n"), "static-site.pkr.hcl", hcl.InitialPos)
+	if _, diags = hcldec.Decode(file.Body, provisioner.ConfigSpec(), nil); !diags.HasErrors() {
+		t.Errorf("Expected staticMode not to be an option of the static site provisioner")
+	}
+}
+
+func Test_getStaticNginxConfigDirectory(t *testing.T) {
+	site := Site{Framework: DocusaurusFramework, TrailingSlash: AlwaysTrailingSlash}.preset("")
+	actualNginxConfig := getStaticNginxConfig("docs.mycompany.com", site, false, false).Render()
+
+	if actualNginxConfig != expectedDirectoryNginxConfig {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expectedDirectoryNginxConfig, actualNginxConfig)
+	}
+}
+
+func TestSitePreset_locations(t *testing.T) {
+	data := []struct {
+		routing       string
+		trailingSlash string
+		expected      string
+	}{
+		{SpaRouting, "", "    location / {\n        try_files $uri $uri/ /index.html;\n    }\n"},
+		{SpaRouting, NeverTrailingSlash, "    location / {\n        rewrite ^(/.+)/$ $1 permanent;\n        try_files $uri /index.html;\n    }\n"},
+		{DirectoryRouting, NeverTrailingSlash, "    location / {\n        rewrite ^(/.+)/$ $1 permanent;\n        add_header Cache-Control \"no-cache\";\n        try_files $uri $uri/index.html $uri.html =404;\n    }\n"},
+	}
+
+	for _, d := range data {
+		site := Site{Routing: d.routing, TrailingSlash: d.trailingSlash, HashedAssetPaths: []string{}}.preset("")
+		actual := getStaticNginxConfig("app.mycompany.com", site, false, false).Render()
+		if !strings.Contains(actual, d.expected) {
+			t.Errorf("Expected %q in Nginx config: %s", d.expected, actual)
+		}
+	}
+}
+
+func TestSite_preset(t *testing.T) {
+	data := []struct {
+		site           Site
+		buildOutputDir string
+		expected       sitePreset
+	}{
+		{
+			Site{},
+			"",
+			sitePreset{
+				buildOutputDir:    DEFAULT_BUILD_OUTPUT_DIR,
+				routing:           SpaRouting,
+				hashedAssetPaths:  DEFAULT_HASHED_ASSET_PATHS,
+				assetCacheControl: DEFAULT_ASSET_CACHE_CONTROL,
+				pageCacheControl:  DEFAULT_PAGE_CACHE_CONTROL,
+			},
+		},
+		{
+			Site{Framework: ReactFramework, PageCacheControl: "public, max-age=60"},
+			"",
+			sitePreset{
+				buildOutputDir:    "build",
+				routing:           SpaRouting,
+				hashedAssetPaths:  []string{"/static/"},
+				assetCacheControl: DEFAULT_ASSET_CACHE_CONTROL,
+				pageCacheControl:  "public, max-age=60",
+			},
+		},
+		{
+			Site{Framework: DocusaurusFramework, NotFoundPage: "/not-found.html", HashedAssetPaths: []string{}},
+			"website/build",
+			sitePreset{
+				buildOutputDir:    "website/build",
+				routing:           DirectoryRouting,
+				notFoundPage:      "/not-found.html",
+				hashedAssetPaths:  []string{},
+				assetCacheControl: DEFAULT_ASSET_CACHE_CONTROL,
+				pageCacheControl:  DEFAULT_PAGE_CACHE_CONTROL,
+			},
+		},
+	}
+
+	for _, d := range data {
+		if actual := d.site.preset(d.buildOutputDir); !reflect.DeepEqual(d.expected, actual) {
+			t.Errorf("Expected and actual site do not match: %v\n\n%v", d.expected, actual)
+		}
+	}
+}
+
+func TestPrepareAngularBuildOutputDir(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeFiles(t, sourceDir, map[string]string{"package.json": "{}", "package-lock.json": "{}"})
+
+	config := map[string]interface{}{"appDomain": "app.mycompany.com", "sourceDir": sourceDir, "framework": "angular"}
+	err := (&StaticSiteProvisioner{}).Prepare(config)
+	if err == nil || !strings.Contains(err.Error(), "framework 'angular' requires buildOutputDir") {
+		t.Errorf("Expected buildOutputDir to be required, got %v", err)
+	}
+
+	config["buildOutputDir"] = "dist/app/browser"
+	if err = (&StaticSiteProvisioner{}).Prepare(config); err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package react
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The package managers installing the dependencies of the React app before it is built from source
+const (
+	Yarn string = "yarn"
+	Npm  string = "npm"
+)
+
+// DEFAULT_BUILD_OUTPUT_DIR Default directory, relative to sourceDir, that the build command writes the dist into, as
+// with Vite
+const DEFAULT_BUILD_OUTPUT_DIR string = "dist"
+
+const sourceArchiveFilename string = "source.tar.gz"
+
+// The directories that are never uploaded, whatever the .gitignore files say
+var alwaysIgnored = []string{"node_modules", ".git"}
+
+// An ignore rule of a .gitignore file, which applies to the paths under the directory of the file
+type ignoreRule struct {
+	base    string
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Returns the rules of the content of a .gitignore file in a directory, relative to the source root, e.g. "" or
+// "packages/web". Blank lines and comments are skipped
+func parseGitignore(base string, content string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " ")
+
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+
+		// A pattern with a slash at the beginning or in the middle is relative to the directory of the .gitignore file;
+		// any other pattern matches a name at any depth
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		prefix := "^(.*/)?"
+		if anchored {
+			prefix = "^"
+		}
+		rule.pattern = regexp.MustCompile(prefix + globToRegexp(line) + "$")
+
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Converts a gitignore glob into a regular expression, where "*" and "?" never match a "/" and "**" matches any number
+// of directories
+func globToRegexp(glob string) string {
+	var builder strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "/**/"):
+			builder.WriteString("/(.*/)?")
+			i += 3
+		case strings.HasPrefix(glob[i:], "**/"):
+			builder.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**"):
+			builder.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			builder.WriteString(".*")
+			i++
+		case c == '*':
+			builder.WriteString("[^/]*")
+		case c == '?':
+			builder.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				builder.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			builder.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(glob):
+			builder.WriteString(regexp.QuoteMeta(string(glob[i+1])))
+			i++
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return builder.String()
+}
+
+// Returns whether a path relative to the source root is ignored. As with git, the last matching rule wins
+func ignored(relPath string, isDir bool, rules []ignoreRule) bool {
+	if isDir {
+		for _, name := range alwaysIgnored {
+			if path.Base(relPath) == name {
+				return true
+			}
+		}
+	}
+
+	result := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		rel := relPath
+		if rule.base != "" {
+			if !strings.HasPrefix(relPath, rule.base+"/") {
+				continue
+			}
+			rel = strings.TrimPrefix(relPath, rule.base+"/")
+		}
+
+		if rule.pattern.MatchString(rel) {
+			result = !rule.negate
+		}
+	}
+	return result
+}
+
+// Writes the files of a source directory into a gzipped tarball, leaving out node_modules, .git and everything ignored
+// by the .gitignore files of the directory. Like git, an ignored directory is skipped as a whole. Returns the path of
+// the tarball, which the caller removes
+func archiveSource(sourceDir string) (string, error) {
+	archive, err := os.CreateTemp("", "packer-react-source-*.tar.gz")
+	if err != nil {
+		return "", fmt.Errorf("error creating source archive: %s", err)
+	}
+	defer archive.Close()
+
+	gzipWriter := gzip.NewWriter(archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	var rules []ignoreRule
+	err = filepath.WalkDir(sourceDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(sourceDir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel != "." && ignored(rel, entry.IsDir(), rules) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.IsDir() {
+			if content, err := os.ReadFile(filepath.Join(file, ".gitignore")); err == nil {
+				base := rel
+				if base == "." {
+					base = ""
+				}
+				rules = append(rules, parseGitignore(base, string(content))...)
+			}
+			if rel == "." {
+				return nil
+			}
+		}
+
+		return addToArchive(tarWriter, file, rel, entry)
+	})
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if err != nil {
+		os.Remove(archive.Name())
+		return "", fmt.Errorf("error archiving sourceDir '%s': %s", sourceDir, err)
+	}
+
+	return archive.Name(), nil
+}
+
+func addToArchive(tarWriter *tar.Writer, file string, rel string, entry fs.DirEntry) error {
+	info, err := entry.Info()
+	if err != nil {
+		return err
+	}
+
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(file); err != nil {
+			return err
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	if entry.IsDir() {
+		header.Name += "/"
+	}
+	if err = tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tarWriter, f)
+	return err
+}
+
+// Returns the package manager of a source directory by its lockfile. A lockfile is required, because dependencies are
+// always installed exactly as locked
+func packageManager(sourceDir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(sourceDir, "package.json")); err != nil {
+		return "", fmt.Errorf("sourceDir '%s' has no package.json", sourceDir)
+	}
+	if _, err := os.Stat(filepath.Join(sourceDir, "yarn.lock")); err == nil {
+		return Yarn, nil
+	}
+	if _, err := os.Stat(filepath.Join(sourceDir, "package-lock.json")); err == nil {
+		return Npm, nil
+	}
+	return "", fmt.Errorf("sourceDir '%s' has neither yarn.lock nor package-lock.json", sourceDir)
+}
+
+// Returns the default build command of a package manager
+func defaultBuildCommand(packageManager string) string {
+	if packageManager == Yarn {
+		return "yarn build"
+	}
+	return "npm run build"
+}
+
+// Returns the commands extracting the uploaded source, installing its dependencies exactly as locked, building it,
+// completing the build output with the prepare commands, and moving it to where a dist is uploaded to otherwise. The
+// output of the package manager is streamed to the build log; if it fails because the lockfile is out of sync with
+// package.json, the build says so explicitly
+func getCommandsBuildingSource(homeDir string, packageManager string, buildCommand string, prepareCommands []string, outputDir string) []string {
+	sourceDir := filepath.Join(homeDir, "source")
+	archive := filepath.Join(homeDir, sourceArchiveFilename)
+	installLog := filepath.Join(homeDir, "install.log")
+
+	installCommand := "npm ci"
+	lockfile := "package-lock.json"
+	outOfSync := "are in sync|Missing: .* from lock file"
+	if packageManager == Yarn {
+		installCommand = "yarn install --frozen-lockfile"
+		lockfile = "yarn.lock"
+		outOfSync = "lockfile needs to be updated"
+	}
+
+	commands := []string{
+		fmt.Sprintf("rm -rf %s && mkdir -p %s", sourceDir, sourceDir),
+		fmt.Sprintf("tar -xzf %s -C %s && rm %s", archive, sourceDir, archive),
+		fmt.Sprintf("cd %s", sourceDir),
+		fmt.Sprintf(
+			"if ! (set -o pipefail; %s 2>&1 | tee %s); then if grep -q -E '%s' %s; then echo \"%s is out of sync with package.json; run '%s install' and commit the updated %s\" >&2; fi; exit 1; fi",
+			installCommand, installLog, outOfSync, installLog, lockfile, packageManager, lockfile,
+		),
+		fmt.Sprintf("rm %s", installLog),
+		buildCommand,
+	}
+	commands = append(commands, prepareCommands...)
+
+	return append(
+		commands,
+		fmt.Sprintf("if [ ! -d %s ]; then echo \"Build output '%s' not found in sourceDir; check buildOutputDir\" >&2; exit 1; fi", outputDir, outputDir),
+		fmt.Sprintf("rm -rf %s/dist && mv %s %s/dist", homeDir, filepath.Join(sourceDir, outputDir), homeDir),
+		fmt.Sprintf("cd %s", homeDir),
+		fmt.Sprintf("rm -rf %s", sourceDir),
+	)
+}
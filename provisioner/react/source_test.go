@@ -0,0 +1,234 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package react
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_ignored(t *testing.T) {
+	rules := append(
+		parseGitignore("", "# comment\n\n/build\n*.log\n!important.log\n.env*\ncoverage/\ndocs/**/*.tmp\n"),
+		parseGitignore("packages/web", "dist/\n/local.json\n")...,
+	)
+
+	data := []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"build", true, true},
+		{"src/build", true, false},
+		{"debug.log", false, true},
+		{"src/debug.log", false, true},
+		{"important.log", false, false},
+		{".env.local", false, true},
+		{"coverage", true, true},
+		{"coverage", false, false},
+		{"docs/a/b/c.tmp", false, true},
+		{"docs/c.tmp", false, true},
+		{"src/c.tmp", false, false},
+		{"packages/web/dist", true, true},
+		{"packages/web/local.json", false, true},
+		{"packages/web/src/local.json", false, false},
+		{"packages/api/dist", true, false},
+		{"packages/web/node_modules", true, true},
+		{".git", true, true},
+		{"src/App.js", false, false},
+	}
+
+	for _, d := range data {
+		if actual := ignored(d.path, d.isDir, rules); actual != d.expected {
+			t.Errorf("Expected ignored(%q, %t) to be %t", d.path, d.isDir, d.expected)
+		}
+	}
+}
+
+func Test_archiveSource(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeFiles(t, sourceDir, map[string]string{
+		".gitignore":                  "/build\n*.log\n",
+		"package.json":                "{}",
+		"yarn.lock":                   "",
+		"src/App.js":                  "export default App",
+		"src/debug.log":               "",
+		"build/index.html":            "",
+		"node_modules/react/index.js": "",
+		"packages/web/.gitignore":     "generated/\n",
+		"packages/web/generated/a.js": "",
+		"packages/web/src/index.js":   "",
+		"packages/web/node_modules/x": "",
+		"packages/api/generated/b.js": "",
+		".git/HEAD":                   "",
+	})
+
+	archive, err := archiveSource(sourceDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(archive)
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			break
+		}
+		if header.Typeflag == tar.TypeReg {
+			files = append(files, header.Name)
+		}
+	}
+	sort.Strings(files)
+
+	expected := []string{
+		".gitignore",
+		"package.json",
+		"packages/api/generated/b.js",
+		"packages/web/.gitignore",
+		"packages/web/src/index.js",
+		"src/App.js",
+		"yarn.lock",
+	}
+	if !reflect.DeepEqual(expected, files) {
+		t.Errorf("Expected and actual archived files do not match: %s\n\n%s", expected, files)
+	}
+}
+
+func Test_packageManager(t *testing.T) {
+	yarnDir := t.TempDir()
+	writeFiles(t, yarnDir, map[string]string{"package.json": "{}", "yarn.lock": "", "package-lock.json": "{}"})
+	npmDir := t.TempDir()
+	writeFiles(t, npmDir, map[string]string{"package.json": "{}", "package-lock.json": "{}"})
+	unlockedDir := t.TempDir()
+	writeFiles(t, unlockedDir, map[string]string{"package.json": "{}"})
+
+	if manager, err := packageManager(yarnDir); err != nil || manager != Yarn {
+		t.Errorf("Expected yarn, got %s (%v)", manager, err)
+	}
+	if manager, err := packageManager(npmDir); err != nil || manager != Npm {
+		t.Errorf("Expected npm, got %s (%v)", manager, err)
+	}
+	if _, err := packageManager(unlockedDir); err == nil || !strings.Contains(err.Error(), "neither yarn.lock nor package-lock.json") {
+		t.Errorf("Expected an error on a source without lockfile, got %v", err)
+	}
+	if _, err := packageManager(t.TempDir()); err == nil || !strings.Contains(err.Error(), "has no package.json") {
+		t.Errorf("Expected an error on a source without package.json, got %v", err)
+	}
+}
+
+func Test_getCommandsBuildingSource(t *testing.T) {
+	actualCommands := getCommandsBuildingSource("/home/ubuntu", Npm, "npm run build", nil, "dist")
+
+	expectedCommands := []string{
+		"rm -rf /home/ubuntu/source && mkdir -p /home/ubuntu/source",
+		"tar -xzf /home/ubuntu/source.tar.gz -C /home/ubuntu/source && rm /home/ubuntu/source.tar.gz",
+		"cd /home/ubuntu/source",
+		"if ! (set -o pipefail; npm ci 2>&1 | tee /home/ubuntu/install.log); then if grep -q -E 'are in sync|Missing: .* from lock file' /home/ubuntu/install.log; then echo \"package-lock.json is out of sync with package.json; run 'npm install' and commit the updated package-lock.json\" >&2; fi; exit 1; fi",
+		"rm /home/ubuntu/install.log",
+		"npm run build",
+		"if [ ! -d dist ]; then echo \"Build output 'dist' not found in sourceDir; check buildOutputDir\" >&2; exit 1; fi",
+		"rm -rf /home/ubuntu/dist && mv /home/ubuntu/source/dist /home/ubuntu/dist",
+		"cd /home/ubuntu",
+		"rm -rf /home/ubuntu/source",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, actualCommands) {
+		t.Errorf("Expected and actual commands do not match: %s\n\n%s", expectedCommands, actualCommands)
+	}
+}
+
+// Runs the commands with stubs of tar and the package managers, whose install and build steps fail as configured
+func Test_getCommandsBuildingSourceFailures(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	data := []struct {
+		name           string
+		packageManager string
+		buildCommand   string
+		install        string
+		build          string
+		error          string
+	}{
+		{"success", Yarn, "yarn build", ":", "mkdir dist", ""},
+		{"npm lockfile out of sync", Npm, "npm run build", "echo 'npm ERR! `npm ci` can only install packages when your package.json and package-lock.json or npm-shrinkwrap.json are in sync.'; return 1", "mkdir dist", "package-lock.json is out of sync with package.json"},
+		{"npm lockfile missing a package", Npm, "npm run build", "echo 'npm ERR! Missing: react@18.2.0 from lock file'; return 1", "mkdir dist", "package-lock.json is out of sync with package.json"},
+		{"yarn lockfile out of sync", Yarn, "yarn build", "echo 'error Your lockfile needs to be updated, but yarn was run with `--frozen-lockfile`.'; return 1", "mkdir dist", "yarn.lock is out of sync with package.json"},
+		{"install failure", Npm, "npm run build", "echo 'npm ERR! network request failed'; return 1", "mkdir dist", "exit status 1"},
+		{"build failure", Yarn, "yarn build", ":", "echo 'error Command failed with exit code 2.' >&2; return 2", "error Command failed with exit code 2."},
+		{"missing build output", Yarn, "yarn build", ":", "mkdir build", "Build output 'dist' not found in sourceDir"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			homeDir := t.TempDir()
+			writeFiles(t, homeDir, map[string]string{sourceArchiveFilename: ""})
+			script := strings.Join(
+				append(
+					[]string{
+						"set -e",
+						"tar() { :; }",
+						"npm() { if [ \"$1\" = ci ]; then " + d.install + "; else " + d.build + "; fi; }",
+						"yarn() { if [ \"$1\" = install ]; then " + d.install + "; else " + d.build + "; fi; }",
+					},
+					getCommandsBuildingSource(homeDir, d.packageManager, d.buildCommand, nil, "dist")...,
+				),
+				"\n",
+			)
+
+			var stderr strings.Builder
+			cmd := exec.Command("bash", "-c", script)
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+
+			_, statErr := os.Stat(filepath.Join(homeDir, "dist"))
+			if d.error == "" && (err != nil || statErr != nil) {
+				t.Errorf("Expected the source to be built into dist, got %v, %v: %s", err, statErr, stderr.String())
+			}
+			if d.error != "" {
+				if err == nil || statErr == nil {
+					t.Errorf("Expected the build to fail without dist")
+				}
+				if !strings.Contains(err.Error()+stderr.String(), d.error) {
+					t.Errorf("Expected error containing %q, got %v: %s", d.error, err, stderr.String())
+				}
+				if !strings.Contains(d.error, "out of sync") && strings.Contains(stderr.String(), "out of sync") {
+					t.Errorf("Expected no lockfile hint for other failures: %s", stderr.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package react
+
+import (
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"path/filepath"
+)
+
+// The server-side rendering frameworks whose server runs as the service of the React app
+const (
+	NextFramework  string = "next"
+	NuxtFramework  string = "nuxt"
+	RemixFramework string = "remix"
+)
+
+// How the production build of a server-side rendering framework is deployed and run
+type ssrFramework struct {
+	// The server command, relative to the deployed app
+	execStart string
+
+	// The environment variable, next to PORT, that binds the server to the loopback interface
+	hostVariable string
+
+	// The content-hashed assets that Nginx serves directly from the deployed app instead of proxying them
+	assetPath string
+	assetDir  string
+
+	// The build output, relative to sourceDir, and the commands completing it in sourceDir after the build
+	buildOutputDir  string
+	prepareCommands []string
+
+	// Whether the build output needs its production dependencies installed, i.e. does not bundle them
+	productionDependencies bool
+}
+
+var ssrFrameworks = map[string]ssrFramework{
+	// https://nextjs.org/docs/app/api-reference/next-config-js/output#automatically-copying-traced-files
+	NextFramework: {
+		execStart:      "/usr/bin/env node server.js",
+		hostVariable:   "HOSTNAME",
+		assetPath:      "/_next/static/",
+		assetDir:       ".next/static",
+		buildOutputDir: ".next/standalone",
+		prepareCommands: []string{
+			"if [ -d .next/standalone ]; then if [ -d public ]; then cp -r public .next/standalone/; fi; mkdir -p .next/standalone/.next && cp -r .next/static .next/standalone/.next/; fi",
+		},
+	},
+	// https://nuxt.com/docs/getting-started/deployment#nodejs-server
+	NuxtFramework: {
+		execStart:      "/usr/bin/env node server/index.mjs",
+		hostVariable:   "NITRO_HOST",
+		assetPath:      "/_nuxt/",
+		assetDir:       "public/_nuxt",
+		buildOutputDir: ".output",
+	},
+	// https://remix.run/docs/en/main/other-api/serve
+	RemixFramework: {
+		execStart:              filepath.Join(APP_DIR, "dist", "node_modules/.bin/remix-serve") + " build/server/index.js",
+		hostVariable:           "HOST",
+		assetPath:              "/assets/",
+		assetDir:               "build/client/assets",
+		buildOutputDir:         ".",
+		productionDependencies: true,
+	},
+}
+
+// Returns an error if a framework is unknown or combined with the options of the static dist
+func (c Config) validateSsr() error {
+	if c.SsrFramework == "" {
+		return nil
+	}
+
+	if _, ok := ssrFrameworks[c.SsrFramework]; !ok {
+		return fmt.Errorf(
+			"unknown ssrFramework '%s'; supported frameworks are '%s', '%s' and '%s'",
+			c.SsrFramework, NextFramework, NuxtFramework, RemixFramework,
+		)
+	}
+	if c.StaticMode {
+		return fmt.Errorf("ssrFramework cannot be combined with staticMode")
+	}
+	if len(c.RuntimeEnv) > 0 {
+		return fmt.Errorf("runtimeEnv is not supported with ssrFramework; the server reads environment instead")
+	}
+
+	return nil
+}
+
+// Returns the Nginx location serving the assets of a framework directly from the deployed app, cached for a year.
+// Missing assets are answered with 404 by Nginx rather than by the server
+func ssrAssetLocation(framework ssrFramework) nginx.Location {
+	return nginx.Location{
+		Path: framework.assetPath,
+		Directives: []nginx.Directive{
+			nginx.NewDirective("alias", filepath.Join(APP_DIR, "dist", framework.assetDir)+"/"),
+			nginx.NewDirective("add_header", "Cache-Control", "\"public, max-age=31536000, immutable\""),
+		},
+	}
+}
+
+// Returns the commands installing the production dependencies of the deployed app with the package manager of its
+// lockfile
+func getCommandsInstallingProductionDependencies() []string {
+	return []string{
+		fmt.Sprintf(
+			"cd %s && if [ -f yarn.lock ]; then sudo yarn install --production --frozen-lockfile; else sudo npm ci --omit=dev; fi && cd -",
+			filepath.Join(APP_DIR, "dist"),
+		),
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package react
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrepareSsr(t *testing.T) {
+	data := []struct {
+		name   string
+		config map[string]interface{}
+		error  string
+	}{
+		{"next", map[string]interface{}{"ssrFramework": "next"}, ""},
+		{"unknown framework", map[string]interface{}{"ssrFramework": "gatsby"}, "unknown ssrFramework 'gatsby'"},
+		{"static mode", map[string]interface{}{"ssrFramework": "nuxt", "staticMode": true}, "ssrFramework cannot be combined with staticMode"},
+		{"runtime env", map[string]interface{}{"ssrFramework": "remix", "runtimeEnv": map[string]string{"API_URL": "https://api.mycompany.com"}}, "runtimeEnv is not supported with ssrFramework"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			d.config["appDomain"] = "app.mycompany.com"
+			d.config["distSource"] = "dist"
+			err := (&Provisioner{}).Prepare(d.config)
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func Test_getServiceSsr(t *testing.T) {
+	unit := getService("3000", NextFramework).Render()
+
+	for _, expected := range []string{
+		"WorkingDirectory=/opt/react-app/dist\n",
+		"EnvironmentFile=-/etc/default/react-app\nEnvironment=NODE_ENV=production\nEnvironment=PORT=3000\nEnvironment=HOSTNAME=127.0.0.1\n",
+		"ExecStart=/usr/bin/env node server.js\n",
+	} {
+		if !strings.Contains(unit, expected) {
+			t.Errorf("Expected %q in unit: %s", expected, unit)
+		}
+	}
+}
+
+func Test_builtInNginxConfigSsr(t *testing.T) {
+	assetLocation := "    location /_nuxt/ {\n" +
+		"        alias /opt/react-app/dist/public/_nuxt/;\n" +
+		"        add_header Cache-Control \"public, max-age=31536000, immutable\";\n" +
+		"    }\n"
+
+	nginxConfig := Config{AppDomain: "app.mycompany.com", SsrFramework: NuxtFramework}.builtInNginxConfig().Render()
+	if !strings.Contains(nginxConfig, assetLocation) || !strings.Contains(nginxConfig, "proxy_pass http://localhost:3000;") {
+		t.Errorf("Expected assets served by Nginx and the rest proxied: %s", nginxConfig)
+	}
+
+	withoutSsr := Config{AppDomain: "app.mycompany.com"}.builtInNginxConfig().Render()
+	if strings.Contains(withoutSsr, "alias") {
+		t.Errorf("Expected no asset location without ssrFramework: %s", withoutSsr)
+	}
+}
+
+func Test_getCommandsSsr(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeFiles(t, sourceDir, map[string]string{"package.json": "{}", "package-lock.json": "{}"})
+
+	next, err := Config{HomeDir: "/home/ubuntu", AppDomain: "app.mycompany.com", SourceDir: sourceDir, SsrFramework: NextFramework}.getCommands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := strings.Join(next, "\n")
+	for _, expected := range []string{
+		"\nnpm run build\n" + ssrFrameworks[NextFramework].prepareCommands[0] + "\n",
+		"rm -rf /home/ubuntu/dist && mv /home/ubuntu/source/.next/standalone /home/ubuntu/dist",
+	} {
+		if !strings.Contains(commands, expected) {
+			t.Errorf("Expected %q in commands: %s", expected, commands)
+		}
+	}
+	if strings.Contains(commands, "--omit=dev") {
+		t.Errorf("Expected no production dependencies installed for a standalone build: %s", commands)
+	}
+
+	remix, err := Config{HomeDir: "/home/ubuntu", AppDomain: "app.mycompany.com", SourceDir: sourceDir, SsrFramework: RemixFramework}.getCommands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands = strings.Join(remix, "\n")
+	for _, expected := range []string{
+		"rm -rf /home/ubuntu/dist && mv /home/ubuntu/source /home/ubuntu/dist",
+		"sudo mv /home/ubuntu/dist /opt/react-app/dist\n" + getCommandsInstallingProductionDependencies()[0] + "\nsudo chown -R root:root /opt/react-app",
+	} {
+		if !strings.Contains(commands, expected) {
+			t.Errorf("Expected %q in commands: %s", expected, commands)
+		}
+	}
+}
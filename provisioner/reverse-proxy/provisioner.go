@@ -0,0 +1,247 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,Route
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DEFAULT_LISTEN_PORT Default port that a route is served on
+const DEFAULT_LISTEN_PORT string = "443"
+
+// DEFAULT_PATH_PREFIX Default path prefix of a route
+const DEFAULT_PATH_PREFIX string = "/"
+
+// Route puts an upstream service behind a path prefix of an SSL-enabled domain
+type Route struct {
+	Domain     string `mapstructure:"domain" required:"true"`
+	ListenPort string `mapstructure:"listenPort" required:"false"`
+	PathPrefix string `mapstructure:"pathPrefix" required:"false"`
+	Upstream   string `mapstructure:"upstream" required:"true"`
+
+	SslCertBase64    string `mapstructure:"sslCertBase64" required:"false"`
+	SslCertKeyBase64 string `mapstructure:"sslCertKeyBase64" required:"false"`
+
+	StripPrefix       bool   `mapstructure:"stripPrefix" required:"false"`
+	WebSocket         *bool  `mapstructure:"webSocket" required:"false"`
+	ProxyReadTimeout  string `mapstructure:"proxyReadTimeout" required:"false"`
+	ClientMaxBodySize string `mapstructure:"clientMaxBodySize" required:"false"`
+}
+
+type Config struct {
+	Routes           []Route `mapstructure:"route" required:"true"`
+	SslCertBase64    string  `mapstructure:"sslCertBase64" required:"false"`
+	SslCertKeyBase64 string  `mapstructure:"sslCertKeyBase64" required:"false"`
+	HomeDir          string  `mapstructure:"homeDir" required:"false"`
+
+	ssl.Config `mapstructure:",squash"`
+
+	ctx interpolate.Context
+}
+
+// A domain with all of its routes and the certificate serving them
+type site struct {
+	domain           string
+	sslCertBase64    string
+	sslCertKeyBase64 string
+	routes           []Route
+}
+
+type Provisioner struct {
+	config Config
+}
+
+func (p *Provisioner) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+func (p *Provisioner) Prepare(raws ...interface{}) error {
+	err := config.Decode(&p.config, nil, raws...)
+	if err != nil {
+		return err
+	}
+
+	err = p.config.Config.Validate()
+	if err != nil {
+		return err
+	}
+	if p.config.NginxTemplate != "" {
+		return fmt.Errorf("nginxTemplate is not supported by the reverse proxy provisioner; configure the routes instead")
+	}
+
+	sites, err := getSites(p.config)
+	if err != nil {
+		return err
+	}
+
+	for _, site := range sites {
+		_, err = p.config.NginxConfig(site.domain, "", getNginxConfig(site, p.config.Config))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, communicator packersdk.Communicator, generatedData map[string]interface{}) error {
+	p.config.HomeDir = ssl.GetHomeDir(p.config.HomeDir)
+
+	sites, err := getSites(p.config)
+	if err != nil {
+		return err
+	}
+
+	for _, site := range sites {
+		err = ssl.Provision(
+			ctx,
+			p.config.ctx,
+			ui,
+			communicator,
+			p.config.HomeDir,
+			ssl.Owner("reverse-proxy-provisioner", generatedData),
+			site.domain,
+			site.sslCertBase64,
+			site.sslCertKeyBase64,
+			p.config.WithoutProxySettings(),
+			getNginxConfig(site, p.config.Config),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Groups the routes by domain in the order the domains first appear and validates them. Every domain is served with
+// the certificate of its routes, or with the top-level certificate, e.g. a wildcard one, if its routes have none
+func getSites(config Config) ([]site, error) {
+	if len(config.Routes) == 0 {
+		return nil, fmt.Errorf("at least one route is required")
+	}
+
+	var sites []site
+	indices := map[string]int{}
+	bindings := map[string]int{}
+	for i, route := range config.Routes {
+		route = withDefaults(route)
+
+		if route.Domain == "" {
+			return nil, fmt.Errorf("route #%d has no domain", i+1)
+		}
+		if _, port, err := net.SplitHostPort(route.Upstream); err != nil || port == "" {
+			return nil, fmt.Errorf("route #%d has an invalid upstream '%s'; expected 'host:port'", i+1, route.Upstream)
+		}
+		if port, err := strconv.Atoi(route.ListenPort); err != nil || port < 1 || port > 65535 || route.ListenPort == "80" {
+			return nil, fmt.Errorf("route #%d has an invalid listenPort '%s'; port 80 is reserved for redirecting to HTTPS", i+1, route.ListenPort)
+		}
+		if !strings.HasPrefix(route.PathPrefix, "/") {
+			return nil, fmt.Errorf("route #%d has an invalid pathPrefix '%s'; it must start with '/'", i+1, route.PathPrefix)
+		}
+		// Otherwise "/api/users" would be passed to the upstream as "//users"
+		if route.StripPrefix && !strings.HasSuffix(route.PathPrefix, "/") {
+			return nil, fmt.Errorf("route #%d strips the pathPrefix '%s', which must therefore end with '/', e.g. '%s/'", i+1, route.PathPrefix, route.PathPrefix)
+		}
+
+		binding := fmt.Sprintf("%s:%s%s", route.Domain, route.ListenPort, route.PathPrefix)
+		if previous, ok := bindings[binding]; ok {
+			return nil, fmt.Errorf("routes #%d and #%d both serve '%s'", previous+1, i+1, binding)
+		}
+		bindings[binding] = i
+
+		sslCertBase64, sslCertKeyBase64 := route.SslCertBase64, route.SslCertKeyBase64
+		if sslCertBase64 == "" && sslCertKeyBase64 == "" {
+			sslCertBase64, sslCertKeyBase64 = config.SslCertBase64, config.SslCertKeyBase64
+		}
+		if sslCertBase64 == "" || sslCertKeyBase64 == "" {
+			return nil, fmt.Errorf("route #%d has no SSL certificate and key for '%s'", i+1, route.Domain)
+		}
+
+		index, ok := indices[route.Domain]
+		if !ok {
+			indices[route.Domain] = len(sites)
+			sites = append(sites, site{domain: route.Domain, sslCertBase64: sslCertBase64, sslCertKeyBase64: sslCertKeyBase64})
+			index = len(sites) - 1
+		} else if sites[index].sslCertBase64 != sslCertBase64 || sites[index].sslCertKeyBase64 != sslCertKeyBase64 {
+			return nil, fmt.Errorf("route #%d has a different SSL certificate than the other routes of '%s'", i+1, route.Domain)
+		}
+		sites[index].routes = append(sites[index].routes, route)
+	}
+
+	return sites, nil
+}
+
+func withDefaults(route Route) Route {
+	if route.ListenPort == "" {
+		route.ListenPort = DEFAULT_LISTEN_PORT
+	}
+	if route.PathPrefix == "" {
+		route.PathPrefix = DEFAULT_PATH_PREFIX
+	}
+	return route
+}
+
+// Returns one SSL-enabled server per listen port of a domain, with one location per route, and the server redirecting
+// HTTP to HTTPS if the domain is served on the default HTTPS port
+func getNginxConfig(site site, sslConfig ssl.Config) nginx.Config {
+	var servers []nginx.Server
+	ports := map[string]int{}
+	for _, route := range site.routes {
+		index, ok := ports[route.ListenPort]
+		if !ok {
+			ports[route.ListenPort] = len(servers)
+			servers = append(servers, nginx.Server{
+				Listens:     nginx.SslListens(route.ListenPort),
+				ServerNames: []string{site.domain},
+				TLS:         ssl.NginxTls(site.domain),
+			})
+			index = len(servers) - 1
+		}
+
+		proxyPass := "http://" + route.Upstream
+		if route.StripPrefix {
+			proxyPass += "/"
+		}
+		servers[index].Locations = append(servers[index].Locations, nginx.Location{
+			Path:      route.PathPrefix,
+			Proxy:     getRouteProxy(route, sslConfig),
+			ProxyPass: proxyPass,
+		})
+	}
+
+	if _, ok := ports[DEFAULT_LISTEN_PORT]; ok {
+		servers = append(servers, nginx.RedirectServer(site.domain))
+	}
+
+	return nginx.Config{Servers: servers}
+}
+
+// Returns the proxy settings of a route, where the options of the route take precedence over the proxy settings of the
+// SSL layer, which are therefore not applied again by ssl.Provision()
+func getRouteProxy(route Route, sslConfig ssl.Config) *nginx.Proxy {
+	proxy := sslConfig.ProxyWithDefaults(nginx.Proxy{})
+	if route.ProxyReadTimeout != "" {
+		proxy.ReadTimeout = route.ProxyReadTimeout
+	}
+	if route.ClientMaxBodySize != "" {
+		proxy.ClientMaxBodySize = route.ClientMaxBodySize
+	}
+	if route.WebSocket != nil {
+		proxy.WebSocket = route.WebSocket
+	}
+	return proxy
+}
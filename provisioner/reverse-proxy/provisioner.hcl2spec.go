@@ -0,0 +1,115 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package proxy
+
+import (
+	ssl "github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatConfig struct {
+	Routes              []FlatRoute          `mapstructure:"route" required:"true" cty:"route" hcl:"route"`
+	SslCertBase64       *string              `mapstructure:"sslCertBase64" required:"false" cty:"sslCertBase64" hcl:"sslCertBase64"`
+	SslCertKeyBase64    *string              `mapstructure:"sslCertKeyBase64" required:"false" cty:"sslCertKeyBase64" hcl:"sslCertKeyBase64"`
+	HomeDir             *string              `mapstructure:"homeDir" required:"false" cty:"homeDir" hcl:"homeDir"`
+	ProxyBackend        *string              `mapstructure:"proxyBackend" required:"false" cty:"proxyBackend" hcl:"proxyBackend"`
+	TlsProfile          *string              `mapstructure:"tlsProfile" required:"false" cty:"tlsProfile" hcl:"tlsProfile"`
+	HstsPreload         *bool                `mapstructure:"hstsPreload" required:"false" cty:"hstsPreload" hcl:"hstsPreload"`
+	OcspStapling        *bool                `mapstructure:"ocspStapling" required:"false" cty:"ocspStapling" hcl:"ocspStapling"`
+	Resolver            *string              `mapstructure:"resolver" required:"false" cty:"resolver" hcl:"resolver"`
+	NginxTemplate       *string              `mapstructure:"nginxTemplate" required:"false" cty:"nginxTemplate" hcl:"nginxTemplate"`
+	NginxTemplateVars   map[string]string    `mapstructure:"nginxTemplateVars" required:"false" cty:"nginxTemplateVars" hcl:"nginxTemplateVars"`
+	ProxyConnectTimeout *string              `mapstructure:"proxyConnectTimeout" required:"false" cty:"proxyConnectTimeout" hcl:"proxyConnectTimeout"`
+	ProxySendTimeout    *string              `mapstructure:"proxySendTimeout" required:"false" cty:"proxySendTimeout" hcl:"proxySendTimeout"`
+	ProxyReadTimeout    *string              `mapstructure:"proxyReadTimeout" required:"false" cty:"proxyReadTimeout" hcl:"proxyReadTimeout"`
+	ProxyBuffering      *bool                `mapstructure:"proxyBuffering" required:"false" cty:"proxyBuffering" hcl:"proxyBuffering"`
+	ProxyWebSocket      *bool                `mapstructure:"proxyWebSocket" required:"false" cty:"proxyWebSocket" hcl:"proxyWebSocket"`
+	ClientMaxBodySize   *string              `mapstructure:"clientMaxBodySize" required:"false" cty:"clientMaxBodySize" hcl:"clientMaxBodySize"`
+	SecurityHeaders     map[string]string    `mapstructure:"securityHeaders" required:"false" cty:"securityHeaders" hcl:"securityHeaders"`
+	RateLimit           *string              `mapstructure:"rateLimit" required:"false" cty:"rateLimit" hcl:"rateLimit"`
+	RateLimitBurst      *string              `mapstructure:"rateLimitBurst" required:"false" cty:"rateLimitBurst" hcl:"rateLimitBurst"`
+	AccessRules         []ssl.FlatAccessRule `mapstructure:"accessRule" required:"false" cty:"accessRule" hcl:"accessRule"`
+	ClientCaBase64      *string              `mapstructure:"clientCaBase64" required:"false" cty:"clientCaBase64" hcl:"clientCaBase64"`
+}
+
+// FlatMapstructure returns a new FlatConfig.
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatConfig)
+}
+
+// HCL2Spec returns the hcl spec of a Config.
+// This spec is used by HCL to read the fields of Config.
+// The decoded values from this spec will then be applied to a FlatConfig.
+func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"route":               &hcldec.BlockListSpec{TypeName: "route", Nested: hcldec.ObjectSpec((*FlatRoute)(nil).HCL2Spec())},
+		"sslCertBase64":       &hcldec.AttrSpec{Name: "sslCertBase64", Type: cty.String, Required: false},
+		"sslCertKeyBase64":    &hcldec.AttrSpec{Name: "sslCertKeyBase64", Type: cty.String, Required: false},
+		"homeDir":             &hcldec.AttrSpec{Name: "homeDir", Type: cty.String, Required: false},
+		"proxyBackend":        &hcldec.AttrSpec{Name: "proxyBackend", Type: cty.String, Required: false},
+		"tlsProfile":          &hcldec.AttrSpec{Name: "tlsProfile", Type: cty.String, Required: false},
+		"hstsPreload":         &hcldec.AttrSpec{Name: "hstsPreload", Type: cty.Bool, Required: false},
+		"ocspStapling":        &hcldec.AttrSpec{Name: "ocspStapling", Type: cty.Bool, Required: false},
+		"resolver":            &hcldec.AttrSpec{Name: "resolver", Type: cty.String, Required: false},
+		"nginxTemplate":       &hcldec.AttrSpec{Name: "nginxTemplate", Type: cty.String, Required: false},
+		"nginxTemplateVars":   &hcldec.AttrSpec{Name: "nginxTemplateVars", Type: cty.Map(cty.String), Required: false},
+		"proxyConnectTimeout": &hcldec.AttrSpec{Name: "proxyConnectTimeout", Type: cty.String, Required: false},
+		"proxySendTimeout":    &hcldec.AttrSpec{Name: "proxySendTimeout", Type: cty.String, Required: false},
+		"proxyReadTimeout":    &hcldec.AttrSpec{Name: "proxyReadTimeout", Type: cty.String, Required: false},
+		"proxyBuffering":      &hcldec.AttrSpec{Name: "proxyBuffering", Type: cty.Bool, Required: false},
+		"proxyWebSocket":      &hcldec.AttrSpec{Name: "proxyWebSocket", Type: cty.Bool, Required: false},
+		"clientMaxBodySize":   &hcldec.AttrSpec{Name: "clientMaxBodySize", Type: cty.String, Required: false},
+		"securityHeaders":     &hcldec.AttrSpec{Name: "securityHeaders", Type: cty.Map(cty.String), Required: false},
+		"rateLimit":           &hcldec.AttrSpec{Name: "rateLimit", Type: cty.String, Required: false},
+		"rateLimitBurst":      &hcldec.AttrSpec{Name: "rateLimitBurst", Type: cty.String, Required: false},
+		"accessRule":          &hcldec.BlockListSpec{TypeName: "accessRule", Nested: hcldec.ObjectSpec((*ssl.FlatAccessRule)(nil).HCL2Spec())},
+		"clientCaBase64":      &hcldec.AttrSpec{Name: "clientCaBase64", Type: cty.String, Required: false},
+	}
+	return s
+}
+
+// FlatRoute is an auto-generated flat version of Route.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatRoute struct {
+	Domain            *string `mapstructure:"domain" required:"true" cty:"domain" hcl:"domain"`
+	ListenPort        *string `mapstructure:"listenPort" required:"false" cty:"listenPort" hcl:"listenPort"`
+	PathPrefix        *string `mapstructure:"pathPrefix" required:"false" cty:"pathPrefix" hcl:"pathPrefix"`
+	Upstream          *string `mapstructure:"upstream" required:"true" cty:"upstream" hcl:"upstream"`
+	SslCertBase64     *string `mapstructure:"sslCertBase64" required:"false" cty:"sslCertBase64" hcl:"sslCertBase64"`
+	SslCertKeyBase64  *string `mapstructure:"sslCertKeyBase64" required:"false" cty:"sslCertKeyBase64" hcl:"sslCertKeyBase64"`
+	StripPrefix       *bool   `mapstructure:"stripPrefix" required:"false" cty:"stripPrefix" hcl:"stripPrefix"`
+	WebSocket         *bool   `mapstructure:"webSocket" required:"false" cty:"webSocket" hcl:"webSocket"`
+	ProxyReadTimeout  *string `mapstructure:"proxyReadTimeout" required:"false" cty:"proxyReadTimeout" hcl:"proxyReadTimeout"`
+	ClientMaxBodySize *string `mapstructure:"clientMaxBodySize" required:"false" cty:"clientMaxBodySize" hcl:"clientMaxBodySize"`
+}
+
+// FlatMapstructure returns a new FlatRoute.
+// FlatRoute is an auto-generated flat version of Route.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Route) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatRoute)
+}
+
+// HCL2Spec returns the hcl spec of a Route.
+// This spec is used by HCL to read the fields of Route.
+// The decoded values from this spec will then be applied to a FlatRoute.
+func (*FlatRoute) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"domain":            &hcldec.AttrSpec{Name: "domain", Type: cty.String, Required: false},
+		"listenPort":        &hcldec.AttrSpec{Name: "listenPort", Type: cty.String, Required: false},
+		"pathPrefix":        &hcldec.AttrSpec{Name: "pathPrefix", Type: cty.String, Required: false},
+		"upstream":          &hcldec.AttrSpec{Name: "upstream", Type: cty.String, Required: false},
+		"sslCertBase64":     &hcldec.AttrSpec{Name: "sslCertBase64", Type: cty.String, Required: false},
+		"sslCertKeyBase64":  &hcldec.AttrSpec{Name: "sslCertKeyBase64", Type: cty.String, Required: false},
+		"stripPrefix":       &hcldec.AttrSpec{Name: "stripPrefix", Type: cty.Bool, Required: false},
+		"webSocket":         &hcldec.AttrSpec{Name: "webSocket", Type: cty.Bool, Required: false},
+		"proxyReadTimeout":  &hcldec.AttrSpec{Name: "proxyReadTimeout", Type: cty.String, Required: false},
+		"clientMaxBodySize": &hcldec.AttrSpec{Name: "clientMaxBodySize", Type: cty.String, Required: false},
+	}
+	return s
+}
@@ -0,0 +1,132 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package proxy
+
+import (
+	_ "embed"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//go:embed test-fixtures/nginx-ssl.conf
+var expectedNginxConfig string
+
+func Test_getNginxConfig(t *testing.T) {
+	webSocket := true
+	sites, err := getSites(Config{
+		SslCertBase64:    "Y2VydA==",
+		SslCertKeyBase64: "a2V5",
+		Routes: []Route{
+			{Domain: "app.mycompany.com", Upstream: "localhost:3000", WebSocket: &webSocket},
+			{Domain: "app.mycompany.com", PathPrefix: "/api/", Upstream: "10.0.0.5:8080", StripPrefix: true, ProxyReadTimeout: "300s"},
+			{Domain: "app.mycompany.com", ListenPort: "8443", Upstream: "localhost:9090", ClientMaxBodySize: "1G"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actualNginxConfig := getNginxConfig(sites[0], ssl.Config{}).Render()
+	if actualNginxConfig != expectedNginxConfig {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expectedNginxConfig, actualNginxConfig)
+	}
+}
+
+func Test_getRouteProxy(t *testing.T) {
+	enabled := true
+	disabled := false
+	sslConfig := ssl.Config{ProxyReadTimeout: "60s", ProxyWebSocket: &enabled, ClientMaxBodySize: "10m"}
+
+	data := []struct {
+		name     string
+		route    Route
+		expected *nginx.Proxy
+	}{
+		{"route without options", Route{}, &nginx.Proxy{ReadTimeout: "60s", ClientMaxBodySize: "10m", WebSocket: &enabled}},
+		{
+			"route with options",
+			Route{ProxyReadTimeout: "300s", ClientMaxBodySize: "1G", WebSocket: &disabled},
+			&nginx.Proxy{ReadTimeout: "300s", ClientMaxBodySize: "1G", WebSocket: &disabled},
+		},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if actual := getRouteProxy(d.route, sslConfig); !reflect.DeepEqual(d.expected, actual) {
+				t.Errorf("Expected %v, got %v", d.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_getSites(t *testing.T) {
+	sites, err := getSites(Config{
+		SslCertBase64:    "d2lsZGNhcmQ=",
+		SslCertKeyBase64: "d2lsZGNhcmQta2V5",
+		Routes: []Route{
+			{Domain: "b.mycompany.com", Upstream: "localhost:8080"},
+			{Domain: "a.mycompany.com", Upstream: "localhost:8081", SslCertBase64: "YQ==", SslCertKeyBase64: "YS1rZXk="},
+			{Domain: "b.mycompany.com", PathPrefix: "/admin", Upstream: "localhost:8082"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sites) != 2 || sites[0].domain != "b.mycompany.com" || sites[1].domain != "a.mycompany.com" {
+		t.Fatalf("Expected the sites in the order their domains first appear, got %v", sites)
+	}
+	if len(sites[0].routes) != 2 || sites[0].sslCertBase64 != "d2lsZGNhcmQ=" {
+		t.Errorf("Expected both routes of b.mycompany.com with the top-level certificate, got %v", sites[0])
+	}
+	if sites[1].sslCertBase64 != "YQ==" || sites[1].sslCertKeyBase64 != "YS1rZXk=" {
+		t.Errorf("Expected the certificate of the route of a.mycompany.com, got %v", sites[1])
+	}
+}
+
+func Test_getSitesWithInvalidRoutes(t *testing.T) {
+	data := []struct {
+		name   string
+		routes []Route
+		error  string
+	}{
+		{"no route", nil, "at least one route is required"},
+		{"no domain", []Route{{Upstream: "localhost:8080"}}, "route #1 has no domain"},
+		{"upstream without port", []Route{{Domain: "a.com", Upstream: "localhost"}}, "invalid upstream 'localhost'"},
+		{"port 80", []Route{{Domain: "a.com", ListenPort: "80", Upstream: "localhost:8080"}}, "invalid listenPort '80'"},
+		{"relative path prefix", []Route{{Domain: "a.com", PathPrefix: "api", Upstream: "localhost:8080"}}, "invalid pathPrefix 'api'"},
+		{
+			"stripped path prefix without trailing slash",
+			[]Route{{Domain: "a.com", PathPrefix: "/api", Upstream: "localhost:8080", StripPrefix: true}},
+			"route #1 strips the pathPrefix '/api', which must therefore end with '/', e.g. '/api/'",
+		},
+		{
+			"duplicate route",
+			[]Route{{Domain: "a.com", Upstream: "localhost:8080"}, {Domain: "a.com", ListenPort: "443", Upstream: "localhost:8081"}},
+			"routes #1 and #2 both serve 'a.com:443/'",
+		},
+		{
+			"different certificates of a domain",
+			[]Route{{Domain: "a.com", Upstream: "localhost:8080"}, {Domain: "a.com", PathPrefix: "/api", Upstream: "localhost:8081", SslCertBase64: "YQ==", SslCertKeyBase64: "YQ=="}},
+			"route #2 has a different SSL certificate than the other routes of 'a.com'",
+		},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			_, err := getSites(Config{SslCertBase64: "Y2VydA==", SslCertKeyBase64: "a2V5", Routes: d.routes})
+			if err == nil || !strings.Contains(err.Error(), d.error) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+
+	_, err := getSites(Config{Routes: []Route{{Domain: "a.com", Upstream: "localhost:8080"}}})
+	if err == nil || !strings.Contains(err.Error(), "route #1 has no SSL certificate and key for 'a.com'") {
+		t.Errorf("Expected an error on missing certificate, got %v", err)
+	}
+}
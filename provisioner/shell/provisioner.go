@@ -42,7 +42,10 @@ import (
 // each command is executed in a separate shell, meaning their state is not preserved unless the state is flushed to the
 // hard disk of the remote machine. For example, the regular env variable export like "export JAVA_HOME=..." won't carry
 // over to the next command's execution context. The only way to preserve all in-memory states is to run everything in a
-// one-time script, which is how this function is implemented
+// one-time script, which is how this function is implemented.
+//
+// The script runs with "set -e", so it stops at the first failing command. Any non-zero exit status of the script,
+// including the ones of explicit "exit 1" checks, is returned as an error, which fails the build
 func Provision(ctx context.Context, ui packersdk.Ui, communicator packersdk.Communicator, commands []string) error {
 	scriptFile, err := loadCommandsIntoScript(commands)
 	if err != nil {
@@ -68,6 +71,28 @@ func CommandsInstallingSudoLessDocker() []string {
 	}
 }
 
+// CommandsStartingService returns an ordered list of commands that enables a system service at boot and (re)loads it
+// so that it picks up the latest configuration.
+//
+// Machines without systemd, such as the Docker containers used in acceptance tests, fall back to the SysV "service"
+// command, which starts the service if it is not running yet
+func CommandsStartingService(service string) []string {
+	return []string{
+		fmt.Sprintf(
+			"if [ -d /run/systemd/system ]; then sudo systemctl enable %s && sudo systemctl reload-or-restart %s; else sudo service %s reload || sudo service %s start; fi",
+			service, service, service, service,
+		),
+	}
+}
+
+// CommandCleaningUpOnExit returns the command that runs a cleanup command when the script exits, whether it succeeds or
+// fails. A plain "trap '...' EXIT" replaces the EXIT trap set before, e.g. the one shredding the uploaded SSL files, so
+// the cleanups of a script are chained instead and all of them run in the order they were registered, even if one of
+// them fails. The cleanup command must not contain single quotes
+func CommandCleaningUpOnExit(cleanup string) string {
+	return fmt.Sprintf(`EXIT_CLEANUPS="${EXIT_CLEANUPS:+$EXIT_CLEANUPS; }"'{ %s; } || true'; trap 'eval "$EXIT_CLEANUPS"' EXIT`, cleanup)
+}
+
 func loadCommandsIntoScript(commands []string) (*os.File, error) {
 	scriptFile, err := tmp.File("packer-shell")
 	if err != nil {
@@ -130,5 +155,10 @@ func executeScript(ctx context.Context, ui packersdk.Ui, communicator packersdk.
 		return err
 	}
 
+	// RunWithUi() only reports errors of the communicator, not the exit status of the command
+	if cmd.ExitStatus() != 0 {
+		return fmt.Errorf("shell script exited with non-zero exit status: %d", cmd.ExitStatus())
+	}
+
 	return nil
 }
@@ -4,7 +4,11 @@
 package shell
 
 import (
+	"context"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"os"
+	"os/exec"
+	"strings"
 	"testing"
 )
 
@@ -35,3 +39,56 @@ sudo apt install software-properties-common -y
 		t.Errorf("Expected and actual scripts do not match: %s\n\n%s", expectedScript, string(b))
 	}
 }
+
+func TestProvision(t *testing.T) {
+	data := []struct {
+		name       string
+		exitStatus int
+		error      string
+	}{
+		{"success", 0, ""},
+		{"failure", 1, "non-zero exit status: 1"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			communicator := &packersdk.MockCommunicator{StartExitStatus: d.exitStatus}
+
+			err := Provision(context.Background(), packersdk.TestUi(t), communicator, []string{"sudo nginx -t || exit 1"})
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+
+			if !strings.Contains(communicator.UploadData, "sudo nginx -t || exit 1\n") {
+				t.Errorf("Expected the commands in uploaded script: %s", communicator.UploadData)
+			}
+		})
+	}
+}
+
+func TestCommandCleaningUpOnExit(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	script := strings.Join(
+		[]string{
+			"set -e",
+			CommandCleaningUpOnExit("echo first; false"),
+			CommandCleaningUpOnExit(`for FILE in a b; do echo "second $FILE"; done`),
+			"exit 3",
+		},
+		"\n",
+	)
+
+	output, err := exec.Command("bash", "-c", script).Output()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Errorf("Expected the exit status of the script, got %v", err)
+	}
+	if expected := "first\nsecond a\nsecond b\n"; string(output) != expected {
+		t.Errorf("Expected all cleanups to run in order: %q, got %q", expected, string(output))
+	}
+}
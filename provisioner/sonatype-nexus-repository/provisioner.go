@@ -6,15 +6,14 @@
 package artifactory
 
 import (
-	"bytes"
 	"context"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/shell"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
-	"text/template"
 )
 
 // PORT Default port of Sonatype Nexus
@@ -26,6 +25,8 @@ type Config struct {
 	SonatypeNexusRepositoryDomain string `mapstructure:"sonatypeNexusRepositoryDomain" required:"true"`
 	HomeDir                       string `mapstructure:"homeDir" required:"false"`
 
+	ssl.Config `mapstructure:",squash"`
+
 	ctx interpolate.Context
 }
 
@@ -43,7 +44,13 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		return err
 	}
 
-	return nil
+	err = p.config.Config.Validate()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.config.NginxConfig(p.config.SonatypeNexusRepositoryDomain, PORT, getNginxConfig(p.config.SonatypeNexusRepositoryDomain, p.config.Config))
+	return err
 }
 
 func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, communicator packersdk.Communicator, generatedData map[string]interface{}) error {
@@ -52,15 +59,24 @@ func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, communicat
 	if err != nil {
 		return err
 	}
+
+	nginxConfig, err := p.config.NginxConfig(p.config.SonatypeNexusRepositoryDomain, PORT, getNginxConfig(p.config.SonatypeNexusRepositoryDomain, p.config.Config))
+	if err != nil {
+		return err
+	}
+
 	return ssl.Provision(
 		ctx,
 		p.config.ctx,
 		ui,
 		communicator,
 		p.config.HomeDir,
+		ssl.Owner("sonatype-nexus-repository-provisioner", generatedData),
+		p.config.SonatypeNexusRepositoryDomain,
 		p.config.SslCertBase64,
 		p.config.SslCertKeyBase64,
-		getNginxConfig(p.config.SonatypeNexusRepositoryDomain),
+		p.config.Config,
+		nginxConfig,
 	)
 }
 
@@ -68,62 +84,29 @@ func getCommands() []string {
 	return append(shell.CommandsInstallingSudoLessDocker(), []string{"docker volume create --name nexus-data"}...)
 }
 
-func getNginxConfig(domain string) string {
-	var sslConfigs = struct {
-		Domain        string
-		SslCertDst    string
-		SslCertKeyDst string
-		Port          string
-	}{domain, ssl.SslCertDst, ssl.SslCertKeyDst, PORT}
-	var buf bytes.Buffer
-	t := template.Must(template.New("Nginx Config").Parse(`
-server {
-	listen 80 default_server;
-	listen [::]:80 default_server;
-
-	root /var/www/html;
-
-	index index.html index.htm index.nginx-debian.html;
-
-	server_name _;
-
-	location / {
-		try_files $uri $uri/ =404;
-	}
-}
-
-server {
-	root /var/www/html;
-
-	index index.html index.htm index.nginx-debian.html;
-    server_name {{.Domain}};
-
-
-	location / {
-		proxy_pass http://localhost:{{.Port}};
-	}
-
-    listen [::]:443 ssl ipv6only=on;
-    listen 443 ssl;
-    ssl_certificate {{.SslCertDst}};
-    ssl_certificate_key {{.SslCertKeyDst}};
-}
-server {
-    if ($host = {{.Domain}}) {
-        return 301 https://$host$request_uri;
-    }
-
-
-	listen 80 ;
-	listen [::]:80 ;
-    server_name {{.Domain}};
-    return 404;
+// Allows uploading large artifacts and streams downloads instead of buffering them on disk, unless the proxy settings in
+// HCL say otherwise
+var defaultProxy = nginx.Proxy{
+	SendTimeout:       "300s",
+	ReadTimeout:       "300s",
+	Buffering:         "off",
+	ClientMaxBodySize: "1G",
 }
-	`))
 
-	if err := t.Execute(&buf, sslConfigs); err != nil {
-		panic(err)
+func getNginxConfig(domain string, sslConfig ssl.Config) nginx.Config {
+	return nginx.Config{
+		Servers: []nginx.Server{
+			{
+				Listens:     nginx.SslListens("443"),
+				ServerNames: []string{domain},
+				Root:        nginx.DefaultRoot,
+				Index:       nginx.DefaultIndex,
+				TLS:         ssl.NginxTls(domain),
+				Locations: []nginx.Location{
+					{Path: "/", Proxy: sslConfig.ProxyWithDefaults(defaultProxy), ProxyPass: "http://localhost:" + PORT},
+				},
+			},
+			nginx.RedirectServer(domain),
+		},
 	}
-
-	return buf.String()
 }
@@ -0,0 +1,21 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package artifactory
+
+import (
+	_ "embed"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"testing"
+)
+
+//go:embed test-fixtures/nginx-ssl.conf
+var expectedNginxConfig string
+
+func Test_getNginxConfig(t *testing.T) {
+	actualNginxConfig := getNginxConfig("nexus.mycompany.com", ssl.Config{}).Render()
+
+	if actualNginxConfig != expectedNginxConfig {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expectedNginxConfig, actualNginxConfig)
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The proxy servers that can be put in front of the apps as the TLS front end
+const (
+	NginxBackend   string = "nginx"
+	CaddyBackend   string = "caddy"
+	TraefikBackend string = "traefik"
+)
+
+// DefaultBackend is the proxy server used when none is configured
+const DefaultBackend string = NginxBackend
+
+// The cipher suites of the TLS profiles in the names used by Go, and therefore by Caddy and Traefik. Go does not
+// implement the DHE suites of Mozilla's lists, so they are left out
+var goCipherSuites = map[string][]string{
+	IntermediateTlsProfile: {
+		"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+		"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+		"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+		"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	},
+	LegacyTlsProfile: {
+		"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+		"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+		"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+		"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+		"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+		"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+		"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+		"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+		"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+		"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+		"TLS_RSA_WITH_AES_128_GCM_SHA256",
+		"TLS_RSA_WITH_AES_256_GCM_SHA384",
+		"TLS_RSA_WITH_AES_128_CBC_SHA256",
+		"TLS_RSA_WITH_AES_128_CBC_SHA",
+		"TLS_RSA_WITH_AES_256_CBC_SHA",
+		"TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	},
+}
+
+// Where a proxy backend expects the files of the sites, and the group it reads the files that are not world-readable
+// with
+type backendLayout struct {
+	bindingsDir       string
+	htpasswdDir       string
+	htpasswdSeparator string
+	group             string
+}
+
+var backendLayouts = map[string]backendLayout{
+	NginxBackend:   {bindingsDir: nginxBindingsDir, htpasswdDir: HtpasswdDir, htpasswdSeparator: ":", group: "www-data"},
+	CaddyBackend:   {bindingsDir: caddyBindingsDir, htpasswdDir: caddyHtpasswdDir, htpasswdSeparator: " ", group: "caddy"},
+	TraefikBackend: {bindingsDir: traefikBindingsDir, htpasswdDir: traefikHtpasswdDir, htpasswdSeparator: ":", group: "traefik"},
+}
+
+var nginxTimePattern = regexp.MustCompile(`^([0-9]+)(ms|s|m|h|d)?$`)
+var nginxSizePattern = regexp.MustCompile(`^([0-9]+)([kKmMgG])?$`)
+
+// A server of the site of a domain in the terms shared by all proxy backends. It is derived from the typed Nginx config
+// model of a provisioner, so that every backend serves the same routes
+type proxyServer struct {
+	port        string
+	serverNames []string
+	routes      []proxyRoute
+
+	// clientCert is true if an access rule requires client certificates on the whole server
+	clientCert bool
+}
+
+// A location of a server, which either proxies to upstreams or serves static files
+type proxyRoute struct {
+	path string
+
+	upstreams []string
+	stripPath bool
+	proxy     nginx.Proxy
+
+	root     string
+	tryFiles []string
+
+	// accessRules are the indices of the access rules applying to this route
+	accessRules []int
+}
+
+func (c Config) proxyBackend() string {
+	if c.ProxyBackend == "" {
+		return DefaultBackend
+	}
+	return c.ProxyBackend
+}
+
+// Returns an error if the configured proxy backend is unknown or does not support the configured settings
+func (c Config) validateBackend() error {
+	switch c.proxyBackend() {
+	case NginxBackend:
+		return nil
+	case CaddyBackend, TraefikBackend:
+	default:
+		return fmt.Errorf(
+			"unknown proxyBackend '%s'; supported backends are '%s', '%s', and '%s'",
+			c.ProxyBackend,
+			NginxBackend,
+			CaddyBackend,
+			TraefikBackend,
+		)
+	}
+
+	if c.NginxTemplate != "" {
+		return fmt.Errorf("nginxTemplate is only supported by the '%s' proxyBackend", NginxBackend)
+	}
+	if c.tlsProfileName() == LegacyTlsProfile && c.proxyBackend() == CaddyBackend {
+		return fmt.Errorf("the '%s' tlsProfile is not supported by the '%s' proxyBackend, which accepts TLS 1.2 and later only", LegacyTlsProfile, CaddyBackend)
+	}
+	if c.RateLimit != "" && c.proxyBackend() == CaddyBackend {
+		return fmt.Errorf("rateLimit is not supported by the '%s' proxyBackend", CaddyBackend)
+	}
+	for i, rule := range c.AccessRules {
+		if rule.ClientSubjectHeader != "" && c.proxyBackend() == TraefikBackend {
+			return fmt.Errorf(
+				"accessRule #%d: clientSubjectHeader is not supported by the '%s' proxyBackend",
+				i+1,
+				TraefikBackend,
+			)
+		}
+	}
+
+	return nil
+}
+
+// Derives the servers of the site of a domain from the typed Nginx config model of a provisioner, with the proxy
+// settings and access rules applied. The settings that only Nginx understands, i.e. raw directives, plain HTTP servers
+// other than the redirect to HTTPS, and locations other than path prefixes, are errors
+func (c Config) proxyServers(domain string, nginxConfig nginx.Config) ([]proxyServer, error) {
+	backend := c.proxyBackend()
+	nginxConfig = c.applyProxySettings(nginxConfig)
+
+	if len(nginxConfig.Directives) > 0 || len(nginxConfig.HttpDirectives) > 0 {
+		return nil, fmt.Errorf("the Nginx config of '%s' has custom directives, which the '%s' proxyBackend cannot serve", domain, backend)
+	}
+
+	upstreams := map[string][]string{}
+	for _, upstream := range nginxConfig.Upstreams {
+		upstreams[upstream.Name] = upstream.Servers
+	}
+
+	matched := make([]bool, len(c.AccessRules))
+	var servers []proxyServer
+	for _, server := range nginxConfig.Servers {
+		if server.TLS == nil {
+			if len(server.ServerNames) == 1 && isRedirectServer(server) {
+				// every backend redirects HTTP to HTTPS on its own
+				continue
+			}
+			return nil, fmt.Errorf("the Nginx config of '%s' has a plain HTTP server, which the '%s' proxyBackend cannot serve", domain, backend)
+		}
+		if len(server.Directives) > 0 {
+			return nil, fmt.Errorf(
+				"the Nginx config of '%s' has a custom '%s' directive, which the '%s' proxyBackend cannot serve",
+				domain,
+				server.Directives[0].Name,
+				backend,
+			)
+		}
+
+		proxyServer := proxyServer{port: server.Listens[0].Port, serverNames: server.ServerNames}
+		for i, rule := range c.AccessRules {
+			if rule.appliesTo(domain) && rule.Path == "" && listensOn(server, rule.Port) {
+				matched[i] = true
+				proxyServer.clientCert = proxyServer.clientCert || rule.ClientCert
+			}
+		}
+
+		for _, location := range server.Locations {
+			route, err := newProxyRoute(domain, backend, server, location, upstreams)
+			if err != nil {
+				return nil, err
+			}
+
+			for i, rule := range c.AccessRules {
+				if !rule.appliesTo(domain) || !listensOn(server, rule.Port) || (rule.Path != "" && rule.Path != location.Path) {
+					continue
+				}
+				if rule.Path != "" && rule.ClientCert {
+					return nil, fmt.Errorf(
+						"accessRule #%d requires client certificates on a single location, which the '%s' proxyBackend does not support; remove its path to require them on the whole server",
+						i+1,
+						backend,
+					)
+				}
+				matched[i] = true
+				route.accessRules = append(route.accessRules, i)
+			}
+
+			proxyServer.routes = append(proxyServer.routes, route)
+		}
+
+		servers = append(servers, proxyServer)
+	}
+
+	for i, rule := range c.AccessRules {
+		if rule.appliesTo(domain) && !matched[i] {
+			return nil, fmt.Errorf("accessRule #%d matches no SSL-enabled location '%s' on port '%s'", i+1, rule.Path, rule.Port)
+		}
+	}
+
+	return servers, nil
+}
+
+func isRedirectServer(server nginx.Server) bool {
+	redirect := nginx.Config{Servers: []nginx.Server{nginx.RedirectServer(server.ServerNames[0])}}
+	return nginx.Config{Servers: []nginx.Server{server}}.Render() == redirect.Render()
+}
+
+func newProxyRoute(domain string, backend string, server nginx.Server, location nginx.Location, upstreams map[string][]string) (proxyRoute, error) {
+	if len(location.Directives) > 0 {
+		return proxyRoute{}, fmt.Errorf(
+			"location '%s' of '%s' has a custom '%s' directive, which the '%s' proxyBackend cannot serve",
+			location.Path,
+			domain,
+			location.Directives[0].Name,
+			backend,
+		)
+	}
+	if !strings.HasPrefix(location.Path, "/") || strings.Contains(location.Path, " ") {
+		return proxyRoute{}, fmt.Errorf("location '%s' of '%s' is not a path prefix, which the '%s' proxyBackend cannot serve", location.Path, domain, backend)
+	}
+
+	route := proxyRoute{path: location.Path}
+	if location.ProxyPass == "" {
+		route.root = server.Root
+		route.tryFiles = location.TryFiles
+		return route, nil
+	}
+
+	if !strings.HasPrefix(location.ProxyPass, "http://") {
+		return proxyRoute{}, fmt.Errorf("location '%s' of '%s' proxies to '%s', which the '%s' proxyBackend cannot serve", location.Path, domain, location.ProxyPass, backend)
+	}
+	host, uri, _ := strings.Cut(strings.TrimPrefix(location.ProxyPass, "http://"), "/")
+	if uri != "" {
+		return proxyRoute{}, fmt.Errorf("location '%s' of '%s' proxies to '%s', which the '%s' proxyBackend cannot serve", location.Path, domain, location.ProxyPass, backend)
+	}
+	route.stripPath = strings.HasSuffix(location.ProxyPass, "/")
+
+	if servers, ok := upstreams[host]; ok {
+		route.upstreams = servers
+	} else {
+		route.upstreams = []string{host}
+	}
+	if location.Proxy != nil {
+		route.proxy = *location.Proxy
+	}
+
+	return route, nil
+}
+
+// Converts an Nginx time, e.g. "60s" or "1d", into a Go duration, e.g. "60s" or "24h"
+func goDuration(nginxTime string) (string, error) {
+	match := nginxTimePattern.FindStringSubmatch(nginxTime)
+	if match == nil {
+		return "", fmt.Errorf("unsupported time '%s'; expected a number with an optional unit of ms, s, m, h, or d", nginxTime)
+	}
+
+	switch match[2] {
+	case "":
+		return match[1] + "s", nil
+	case "d":
+		days, _ := strconv.Atoi(match[1])
+		return fmt.Sprintf("%dh", days*24), nil
+	default:
+		return nginxTime, nil
+	}
+}
+
+// Converts an Nginx size, e.g. "1G" or "100m", into a number of bytes
+func byteSize(nginxSize string) (int64, error) {
+	match := nginxSizePattern.FindStringSubmatch(nginxSize)
+	if match == nil {
+		return 0, fmt.Errorf("unsupported size '%s'; expected a number with an optional unit of k, m, or g", nginxSize)
+	}
+
+	size, _ := strconv.ParseInt(match[1], 10, 64)
+	switch strings.ToLower(match[2]) {
+	case "k":
+		size *= 1 << 10
+	case "m":
+		size *= 1 << 20
+	case "g":
+		size *= 1 << 30
+	}
+
+	return size, nil
+}
@@ -0,0 +1,330 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//go:embed test-fixtures/caddy.caddy
+var expectedCaddySite string
+
+//go:embed test-fixtures/traefik.yml
+var expectedTraefikSite string
+
+func backendTestConfig() nginx.Config {
+	tls := NginxTls("app.mycompany.com")
+	webSocket := true
+
+	return nginx.Config{
+		Servers: []nginx.Server{
+			{
+				Listens:     nginx.SslListens("443"),
+				ServerNames: []string{"app.mycompany.com"},
+				Root:        nginx.DefaultRoot,
+				Index:       nginx.DefaultIndex,
+				TLS:         tls,
+				Locations: []nginx.Location{
+					{
+						Path:      "/",
+						Proxy:     &nginx.Proxy{ReadTimeout: "300s", Buffering: "off", ClientMaxBodySize: "1G", WebSocket: &webSocket},
+						ProxyPass: "http://localhost:3000",
+					},
+					{Path: "/api/", Proxy: &nginx.Proxy{}, ProxyPass: "http://localhost:8080/"},
+				},
+			},
+			nginx.RedirectServer("app.mycompany.com"),
+			{
+				Listens:     nginx.SslListens("8444"),
+				ServerNames: []string{"app.mycompany.com"},
+				TLS:         tls,
+				Locations:   []nginx.Location{{Path: "/", Proxy: &nginx.Proxy{ConnectTimeout: "60s"}, ProxyPass: "http://localhost:8001"}},
+			},
+		},
+	}
+}
+
+func backendTestAccessRules() []AccessRule {
+	return []AccessRule{
+		{Port: "8444", Allow: []string{"10.0.0.0/8"}, BasicAuthUsers: map[string]string{"admin": "secret"}},
+		{Port: "8444", ClientCert: true},
+	}
+}
+
+func Test_caddySite(t *testing.T) {
+	config := Config{
+		ProxyBackend:    CaddyBackend,
+		SecurityHeaders: map[string]string{"Content-Security-Policy": "default-src 'self'"},
+		AccessRules:     append(backendTestAccessRules(), AccessRule{Port: "8444", ClientCert: true, ClientSubjectHeader: "X-Client-Subject"}),
+		ClientCaBase64:  testClientCaBase64,
+	}
+
+	actual, err := config.caddySite("app.mycompany.com", backendTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual != expectedCaddySite {
+		t.Errorf("Expected and actual Caddyfile do not match: %s\n\n%s", expectedCaddySite, actual)
+	}
+}
+
+func Test_traefikSite(t *testing.T) {
+	config := Config{
+		ProxyBackend:   TraefikBackend,
+		RateLimit:      "10r/s",
+		AccessRules:    backendTestAccessRules(),
+		ClientCaBase64: testClientCaBase64,
+	}
+
+	actual, routers, err := config.traefikSite("app.mycompany.com", backendTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual != expectedTraefikSite {
+		t.Errorf("Expected and actual Traefik config do not match: %s\n\n%s", expectedTraefikSite, actual)
+	}
+
+	if strings.Join(routers, " ") != "app-mycompany-com-443-0 app-mycompany-com-443-1 app-mycompany-com-8444-0" {
+		t.Errorf("Unexpected routers: %v", routers)
+	}
+}
+
+func Test_proxyServersUnsupported(t *testing.T) {
+	withDirective := backendTestConfig()
+	withDirective.Servers[0].Locations[0].Directives = []nginx.Directive{nginx.NewDirective("add_header", "X-Custom", "1")}
+
+	withRegex := backendTestConfig()
+	withRegex.Servers[0].Locations[1].Path = "~ ^/api"
+
+	data := []struct {
+		name        string
+		config      Config
+		nginxConfig nginx.Config
+		error       string
+	}{
+		{"raw location directive", Config{ProxyBackend: CaddyBackend}, withDirective, "has a custom 'add_header' directive"},
+		{"regex location", Config{ProxyBackend: CaddyBackend}, withRegex, "is not a path prefix"},
+		{
+			"client cert on location",
+			Config{ProxyBackend: TraefikBackend, ClientCaBase64: testClientCaBase64, AccessRules: []AccessRule{{Port: "8444", Path: "/", ClientCert: true}}},
+			backendTestConfig(),
+			"requires client certificates on a single location",
+		},
+		{
+			"unmatched access rule",
+			Config{ProxyBackend: TraefikBackend, AccessRules: []AccessRule{{Path: "/admin", Allow: []string{"10.0.0.0/8"}}}},
+			backendTestConfig(),
+			"accessRule #1 matches no SSL-enabled location '/admin'",
+		},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			_, err := d.config.proxyServers("app.mycompany.com", d.nginxConfig)
+			if err == nil || !strings.Contains(err.Error(), d.error) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func TestValidateBackend(t *testing.T) {
+	data := []struct {
+		name   string
+		config Config
+		error  string
+	}{
+		{"default backend", Config{}, ""},
+		{"caddy", Config{ProxyBackend: CaddyBackend}, ""},
+		{"traefik with rate limit", Config{ProxyBackend: TraefikBackend, RateLimit: "10r/s"}, ""},
+		{"unknown backend", Config{ProxyBackend: "haproxy"}, "unknown proxyBackend 'haproxy'"},
+		{"template with caddy", Config{ProxyBackend: CaddyBackend, NginxTemplate: "nginx.conf.tmpl"}, "nginxTemplate is only supported by the 'nginx' proxyBackend"},
+		{"caddy with rate limit", Config{ProxyBackend: CaddyBackend, RateLimit: "10r/s"}, "rateLimit is not supported by the 'caddy' proxyBackend"},
+		{"caddy with legacy profile", Config{ProxyBackend: CaddyBackend, TlsProfile: LegacyTlsProfile}, "accepts TLS 1.2 and later only"},
+		{
+			"traefik with client subject header",
+			Config{ProxyBackend: TraefikBackend, ClientCaBase64: testClientCaBase64, AccessRules: []AccessRule{{ClientCert: true, ClientSubjectHeader: "X-Client-Subject"}}},
+			"clientSubjectHeader is not supported by the 'traefik' proxyBackend",
+		},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			err := d.config.Validate()
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func Test_htpasswdFilesOfBackend(t *testing.T) {
+	config := Config{ProxyBackend: CaddyBackend, AccessRules: []AccessRule{{BasicAuthUsers: map[string]string{"admin": "secret"}}}}
+
+	files, err := config.htpasswdFiles("app.mycompany.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].destination != "/etc/caddy/htpasswd/app.mycompany.com.0" || files[0].group != "caddy" || !strings.HasPrefix(files[0].content, "admin $2a$") {
+		t.Errorf("Expected a Caddy password file, got %v", files)
+	}
+}
+
+func Test_conversions(t *testing.T) {
+	for nginxTime, expected := range map[string]string{"60": "60s", "300s": "300s", "500ms": "500ms", "1d": "24h"} {
+		if actual, err := goDuration(nginxTime); err != nil || actual != expected {
+			t.Errorf("Expected '%s' to be converted to '%s', got '%s' (%v)", nginxTime, expected, actual, err)
+		}
+	}
+	for nginxSize, expected := range map[string]int64{"1024": 1024, "8k": 8192, "100m": 104857600, "1G": 1073741824} {
+		if actual, err := byteSize(nginxSize); err != nil || actual != expected {
+			t.Errorf("Expected '%s' to be converted to %d, got %d (%v)", nginxSize, expected, actual, err)
+		}
+	}
+	if _, err := goDuration("1w"); err == nil {
+		t.Errorf("Expected an error on an unsupported time unit")
+	}
+}
+
+func Test_getBackendSetupCommands(t *testing.T) {
+	files := []siteFile{{filename: sslCertKeyFilename, destination: SslCertKeyDst("app.mycompany.com"), mode: "640", group: "ssl-cert"}}
+
+	caddy := strings.Join(getCaddySetupCommands("/home/ubuntu", "react-provisioner", "app.mycompany.com", files), "\n")
+	for _, expected := range []string{
+		"sudo apt update && sudo apt install -y caddy",
+		`if OWNER=$(sudo cat /etc/qubitpi/site-owners/app.mycompany.com.owner 2>/dev/null) && { [ "${OWNER%% *}" != "react-provisioner" ]; }; then echo "Caddy site app.mycompany.com is already owned by $OWNER" >&2; exit 1; fi`,
+		"sudo install -o root -g ssl-cert -m 640 /run/qubitpi-private/ssl.key /etc/ssl/private/app.mycompany.com.key && sudo shred -u /run/qubitpi-private/ssl.key",
+		`if [ "$(sudo stat -c '%U:%G %a' /etc/ssl/private/app.mycompany.com.key)" != "root:ssl-cert 640" ]`,
+		"sudo caddy validate --config /etc/caddy/Caddyfile --adapter caddyfile",
+		"sudo systemctl enable caddy && sudo systemctl reload-or-restart caddy",
+	} {
+		if !strings.Contains(caddy, expected) {
+			t.Errorf("Expected %q in Caddy setup commands: %s", expected, caddy)
+		}
+	}
+
+	traefik := strings.Join(getTraefikSetupCommands("/home/ubuntu", "react-provisioner", "app.mycompany.com", []string{"app-mycompany-com-443-0"}, files), "\n")
+	for _, expected := range []string{
+		"grep \" traefik_v" + TraefikVersion + "_linux_$(dpkg --print-architecture).tar.gz$\" traefik_v" + TraefikVersion + "_checksums.txt | sha256sum -c -",
+		`echo "Traefik site app.mycompany.com is already owned by $OWNER" >&2`,
+		"for ROUTER in app-mycompany-com-443-0; do",
+		"http://127.0.0.1:8099/api/http/routers/$ROUTER@file",
+	} {
+		if !strings.Contains(traefik, expected) {
+			t.Errorf("Expected %q in Traefik setup commands: %s", expected, traefik)
+		}
+	}
+}
+
+// Runs the router check of Traefik without systemd, where Traefik is stubbed with a process that the check must stop, and
+// curl with the local API reporting the status of the routers
+func Test_getTraefikSetupCommandsWithoutSystemd(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	data := []struct {
+		name   string
+		status string
+		error  string
+	}{
+		{"enabled router", "enabled", ""},
+		{"disabled router", "disabled", "Traefik config validation failed; restoring previous config: router app-mycompany-com-443-0 is not enabled"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			log := filepath.Join(t.TempDir(), "sudo.log")
+			stubs := []string{
+				"sudo() { echo \"$*\" >> " + log + "; case \"$1\" in /usr/local/bin/traefik) exec sleep 30;; kill) \"$@\";; esac; }",
+				"curl() { echo '{\"status\":\"" + d.status + "\"}'; }",
+			}
+
+			var check []string
+			for _, command := range getTraefikSetupCommands("/home/ubuntu", "react-provisioner", "app.mycompany.com", []string{"app-mycompany-com-443-0"}, nil) {
+				if strings.Contains(command, "TRAEFIK_PID") {
+					command = strings.ReplaceAll(command, "/run/systemd/system", filepath.Join(t.TempDir(), "systemd"))
+					check = append(check, strings.ReplaceAll(command, "$(seq 30)", "$(seq 1)"))
+				}
+			}
+
+			var stderr strings.Builder
+			cmd := exec.Command("bash", "-c", strings.Join(append(append([]string{"set -e"}, stubs...), check...), "\n"))
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+
+			if d.error == "" && err != nil {
+				t.Errorf("Expected the check to pass, got %s: %s", err, stderr.String())
+			}
+			if d.error != "" && (err == nil || !strings.Contains(stderr.String(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v: %s", d.error, err, stderr.String())
+			}
+
+			calls, err := os.ReadFile(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, expected := range []string{"/usr/local/bin/traefik --configFile=/etc/traefik/traefik.yml", "kill "} {
+				if !strings.Contains(string(calls), expected) {
+					t.Errorf("Expected %q among the commands run with sudo: %s", expected, calls)
+				}
+			}
+		})
+	}
+}
+
+func TestProvisionFailsOnInvalidBackendConfig(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte("test"))
+
+	data := []struct {
+		backend    string
+		validation string
+	}{
+		{CaddyBackend, "Caddy config validation failed"},
+		{TraefikBackend, "Traefik config validation failed"},
+	}
+
+	for _, d := range data {
+		t.Run(d.backend, func(t *testing.T) {
+			// "caddy validate" and the router check of Traefik exit with 1 after restoring the previous config
+			communicator := &recordingCommunicator{failingCommand: "/tmp/script_"}
+			err := Provision(
+				context.Background(),
+				interpolate.Context{},
+				packersdk.TestUi(t),
+				communicator,
+				"/home/ubuntu",
+				"react-provisioner",
+				"app.mycompany.com",
+				encoded,
+				encoded,
+				Config{ProxyBackend: d.backend},
+				backendTestConfig(),
+			)
+			if err == nil {
+				t.Errorf("Expected an invalid %s config to fail the build", d.backend)
+			}
+
+			if !strings.Contains(communicator.script(), d.validation) {
+				t.Errorf("Expected the validation in the setup script: %s", communicator.script())
+			}
+		})
+	}
+}
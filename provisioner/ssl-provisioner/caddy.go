@@ -0,0 +1,267 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"path/filepath"
+	"strings"
+)
+
+const caddyConfigDst string = "/etc/caddy/Caddyfile"
+const caddySitesDir string = "/etc/caddy/sites"
+const caddyBindingsDir string = "/etc/caddy/server-bindings"
+const caddyHtpasswdDir string = "/etc/caddy/htpasswd"
+const caddyConfigFilename string = "Caddyfile"
+const caddySiteFilename string = "caddy-ssl.caddy"
+
+// The main Caddyfile imports the sites of all provisioners. Certificates are provided by the provisioners, so Caddy only
+// redirects HTTP to HTTPS and never requests certificates on its own
+const caddyConfig string = `{
+	auto_https disable_certs
+}
+
+import ` + caddySitesDir + `/*.caddy
+`
+
+// Writes a Caddyfile with tab indentation
+type caddyfile struct {
+	builder strings.Builder
+	depth   int
+}
+
+func (f *caddyfile) line(format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	if line != "" {
+		line = strings.Repeat("\t", f.depth) + line
+	}
+	f.builder.WriteString(line + "\n")
+}
+
+func (f *caddyfile) open(format string, args ...interface{}) {
+	f.line(format+" {", args...)
+	f.depth++
+}
+
+func (f *caddyfile) close() {
+	f.depth--
+	f.line("}")
+}
+
+// Returns the files of the site of a domain served by Caddy, i.e. its certificate, its Caddyfile, and the
+// "listen"/"server_name" pairs of its Nginx config, together with the shared main Caddyfile
+func (c Config) caddySiteFiles(domain string, sslCert string, sslCertKey string, nginxConfig nginx.Config) ([]siteFile, error) {
+	site, err := c.caddySite(domain, nginxConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return []siteFile{
+		{filename: caddySiteFilename, destination: filepath.Join(caddySitesDir, domain+".caddy"), content: site},
+		{filename: caddyConfigFilename, destination: caddyConfigDst, content: caddyConfig},
+		{filename: nginxBindingsFilename, destination: filepath.Join(caddyBindingsDir, domain), content: strings.Join(nginxConfig.Bindings(), "\n") + "\n"},
+		{filename: sslCertFilename, destination: SslCertDst(domain), content: sslCert},
+		{filename: sslCertKeyFilename, destination: SslCertKeyDst(domain), content: sslCertKey, mode: "640", group: "ssl-cert"},
+	}, nil
+}
+
+// Renders the Nginx config of a domain, with the settings of the SSL layer applied, into an equivalent Caddyfile with
+// one site block per listen port
+func (c Config) caddySite(domain string, nginxConfig nginx.Config) (string, error) {
+	servers, err := c.proxyServers(domain, nginxConfig)
+	if err != nil {
+		return "", err
+	}
+
+	profile := tlsProfiles[c.tlsProfileName()]
+	headers := append(c.securityHeaderValues(), [2]string{"Strict-Transport-Security", c.hsts()})
+
+	var f caddyfile
+	for i, server := range servers {
+		if i > 0 {
+			f.line("")
+		}
+
+		addresses := make([]string, 0, len(server.serverNames))
+		for _, serverName := range server.serverNames {
+			addresses = append(addresses, serverName+":"+server.port)
+		}
+		f.open(strings.Join(addresses, ", "))
+
+		f.open("tls %s %s", SslCertDst(domain), SslCertKeyDst(domain))
+		f.line("protocols %s %s", caddyProtocol(profile.protocols[0]), caddyProtocol(profile.protocols[len(profile.protocols)-1]))
+		if ciphers := goCipherSuites[c.tlsProfileName()]; len(ciphers) > 0 {
+			f.line("ciphers %s", strings.Join(ciphers, " "))
+		}
+		if server.clientCert {
+			f.open("client_auth")
+			f.line("mode require_and_verify")
+			f.line("trust_pool file %s", ClientCaDst(domain))
+			f.close()
+		}
+		f.close()
+
+		f.open("header")
+		for _, header := range headers {
+			f.line("%s %s", header[0], caddyQuote(header[1]))
+		}
+		f.close()
+
+		for _, route := range server.routes {
+			if err := c.caddyRoute(&f, domain, route); err != nil {
+				return "", err
+			}
+		}
+
+		f.close()
+	}
+
+	return f.builder.String(), nil
+}
+
+// Renders a route as a "handle" block, or as a "handle_path" block if the path prefix is stripped. Caddy tries the
+// blocks with the longest path first, just like Nginx picks the location with the longest prefix
+func (c Config) caddyRoute(f *caddyfile, domain string, route proxyRoute) error {
+	directive := "handle"
+	if route.stripPath {
+		directive = "handle_path"
+	}
+	f.open("%s %s*", directive, route.path)
+
+	var subjectHeaders []string
+	for _, i := range route.accessRules {
+		rule := c.AccessRules[i]
+		if len(rule.Allow) > 0 {
+			f.line("@denied%d not remote_ip %s", i, strings.Join(rule.Allow, " "))
+			f.line("respond @denied%d 403", i)
+		}
+		if len(rule.BasicAuthUsers) > 0 {
+			f.open("basic_auth")
+			f.line("import %s", backendHtpasswdDst(caddyHtpasswdDir, domain, i))
+			f.close()
+		}
+		if rule.ClientSubjectHeader != "" {
+			subjectHeaders = append(subjectHeaders, rule.ClientSubjectHeader)
+		}
+	}
+
+	if route.upstreams == nil {
+		f.line("root * %s", route.root)
+		if tryFiles := caddyTryFiles(route.tryFiles); len(tryFiles) > 0 {
+			f.line("try_files %s", strings.Join(tryFiles, " "))
+		}
+		f.line("file_server")
+		f.close()
+		return nil
+	}
+
+	if route.proxy.ClientMaxBodySize != "" {
+		size, err := byteSize(route.proxy.ClientMaxBodySize)
+		if err != nil {
+			return fmt.Errorf("invalid clientMaxBodySize of location '%s' of '%s': %s", route.path, domain, err)
+		}
+		f.open("request_body")
+		f.line("max_size %d", size)
+		f.close()
+	}
+
+	f.open("reverse_proxy %s", strings.Join(route.upstreams, " "))
+	f.line("header_up X-Real-IP {remote_host}")
+	for _, subjectHeader := range subjectHeaders {
+		f.line("header_up %s {http.request.tls.client.subject}", subjectHeader)
+	}
+
+	timeouts := [][2]string{
+		{"dial_timeout", route.proxy.ConnectTimeout},
+		{"write_timeout", route.proxy.SendTimeout},
+		{"read_timeout", route.proxy.ReadTimeout},
+	}
+	if route.proxy.ConnectTimeout != "" || route.proxy.SendTimeout != "" || route.proxy.ReadTimeout != "" {
+		f.open("transport http")
+		for _, timeout := range timeouts {
+			if timeout[1] == "" {
+				continue
+			}
+			duration, err := goDuration(timeout[1])
+			if err != nil {
+				return fmt.Errorf("invalid proxy timeout of location '%s' of '%s': %s", route.path, domain, err)
+			}
+			f.line("%s %s", timeout[0], duration)
+		}
+		f.close()
+	}
+	if route.proxy.Buffering == "off" {
+		f.line("flush_interval -1")
+	}
+	f.close()
+
+	f.close()
+	return nil
+}
+
+// Return all commands for installing Caddy and loading the files of the site of a domain to the proper location in
+// remote machine.
+//
+// Just like with Nginx, the build fails if the domain is owned by someone else or the site conflicts with the sites of
+// other domains, and the previous files are restored if the new config does not pass "caddy validate". Caddy is
+// installed from its official Debian repository, which comes with a systemd unit, so the service is started only if
+// systemd is running
+func getCaddySetupCommands(homeDir string, owner string, domain string, files []siteFile) []string {
+	commands := []string{
+		getCleanupCommand(homeDir, files),
+		"sudo apt update && sudo apt upgrade -y",
+
+		"sudo apt install -y debian-keyring debian-archive-keyring apt-transport-https curl gnupg ssl-cert",
+		"curl -1sLf 'https://dl.cloudsmith.io/public/caddy/stable/gpg.key' | sudo gpg --dearmor --yes -o /usr/share/keyrings/caddy-stable-archive-keyring.gpg",
+		"curl -1sLf 'https://dl.cloudsmith.io/public/caddy/stable/debian.deb.txt' | sudo tee /etc/apt/sources.list.d/caddy-stable.list",
+		"sudo apt update && sudo apt install -y caddy",
+		"sudo usermod -aG ssl-cert caddy",
+		fmt.Sprintf("sudo mkdir -p %s %s %s %s", caddySitesDir, caddyBindingsDir, caddyHtpasswdDir, siteOwnersDir),
+		getOwnerCheckCommand("Caddy", owner, domain),
+		getConflictCheckCommand("Caddy", filepath.Join(homeDir, nginxBindingsFilename), caddyBindingsDir, domain),
+		fmt.Sprintf("sudo rm -rf %s && sudo mkdir -m 700 -p %s", backupDir, backupDir),
+	}
+
+	installCommands, restoreCommands := getInstallCommands(homeDir, files)
+	commands = append(commands, installCommands...)
+
+	commands = append(
+		commands,
+		fmt.Sprintf(
+			"if ! CADDY_VALIDATE_OUTPUT=$(sudo caddy validate --config %s --adapter caddyfile 2>&1); then echo \"Caddy config validation failed; restoring previous config: $CADDY_VALIDATE_OUTPUT\" >&2; %s; exit 1; fi",
+			caddyConfigDst,
+			strings.Join(restoreCommands, "; "),
+		),
+		fmt.Sprintf("sudo rm -rf %s", backupDir),
+		"if [ -d /run/systemd/system ]; then sudo systemctl enable caddy && sudo systemctl reload-or-restart caddy; else echo \"systemd is not running; Caddy starts at next boot\"; fi",
+	)
+
+	return append(commands, getPermissionCheckCommands(files)...)
+}
+
+// Converts an Nginx protocol name, e.g. "TLSv1.2", into the one of Caddy, e.g. "tls1.2"
+func caddyProtocol(protocol string) string {
+	return strings.Replace(protocol, "TLSv", "tls", 1)
+}
+
+func caddyQuote(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+// Converts the "try_files" arguments of Nginx into the ones of Caddy. A final "=<code>" of Nginx is left out, because
+// Caddy falls back to the file server, which responds 404 on missing files
+func caddyTryFiles(tryFiles []string) []string {
+	replacer := strings.NewReplacer("$uri", "{path}", "$args", "{query}")
+
+	var result []string
+	for _, file := range tryFiles {
+		if strings.HasPrefix(file, "=") {
+			continue
+		}
+		result = append(result, replacer.Replace(file))
+	}
+
+	return result
+}
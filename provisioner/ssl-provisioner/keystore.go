@@ -0,0 +1,115 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	"encoding/pem"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// The Java keystore formats that a PEM certificate and key can be converted into
+const (
+	Pkcs12Keystore string = "PKCS12"
+	JksKeystore    string = "JKS"
+)
+
+// DefaultKeystoreType is the keystore format used when none is configured. It is the default of Java since JDK 9
+const DefaultKeystoreType string = Pkcs12Keystore
+
+// The password of the JDK truststore as shipped by every JDK distribution
+const jdkTruststorePassword string = "changeit"
+
+// keytool refuses keystore passwords shorter than this
+const minKeystorePasswordLength int = 6
+
+// ValidateKeystore returns an error if a keystore type is not supported or a keystore password would be refused by
+// keytool. An empty type stands for DefaultKeystoreType
+func ValidateKeystore(keystoreType string, password string) error {
+	if keystoreType != "" && keystoreType != Pkcs12Keystore && keystoreType != JksKeystore {
+		return fmt.Errorf("unknown keystoreType '%s'; supported types are '%s' and '%s'", keystoreType, Pkcs12Keystore, JksKeystore)
+	}
+	if len(password) < minKeystorePasswordLength {
+		return fmt.Errorf("keystorePassword must be at least %d characters long", minKeystorePasswordLength)
+	}
+	return nil
+}
+
+// KeystoreExtension returns the file extension of a keystore type, i.e. "p12" or "jks"
+func KeystoreExtension(keystoreType string) string {
+	if keystoreType == JksKeystore {
+		return "jks"
+	}
+	return "p12"
+}
+
+// CommandsCreatingKeystore returns the commands converting a PEM certificate and key in remote machine into a Java
+// keystore of a type, e.g. Pkcs12Keystore, under an alias. The keystore is only readable by the current user.
+//
+// The password is read from a file in remote machine, so that it never shows up in the build log or in the process
+// list. The key pair is converted by OpenSSL, and then by keytool for JKS keystores; the intermediate PKCS#12 file of
+// the latter is shredded afterwards
+func CommandsCreatingKeystore(keystoreType string, certPath string, keyPath string, passwordPath string, keystorePath string, alias string) []string {
+	pkcs12Path := keystorePath
+	if keystoreType == JksKeystore {
+		pkcs12Path = strings.TrimSuffix(keystorePath, filepath.Ext(keystorePath)) + ".p12"
+	}
+
+	commands := []string{
+		fmt.Sprintf("mkdir -p %s", filepath.Dir(keystorePath)),
+		fmt.Sprintf("rm -f %s", keystorePath),
+		fmt.Sprintf(
+			"(umask 077 && openssl pkcs12 -export -in %s -inkey %s -name %s -out %s -passout file:%s)",
+			certPath, keyPath, alias, pkcs12Path, passwordPath,
+		),
+	}
+
+	if keystoreType == JksKeystore {
+		commands = append(
+			commands,
+			fmt.Sprintf(
+				"(umask 077 && keytool -importkeystore -noprompt -srckeystore %s -srcstoretype PKCS12 -srcstorepass:file %s -destkeystore %s -deststoretype JKS -deststorepass:file %s -destkeypass:file %s)",
+				pkcs12Path, passwordPath, keystorePath, passwordPath, passwordPath,
+			),
+			fmt.Sprintf("shred -u %s", pkcs12Path),
+		)
+	}
+
+	return append(commands, fmt.Sprintf("chmod 600 %s", keystorePath))
+}
+
+// SplitCertificates splits a PEM bundle into its certificates, since keytool only imports the first certificate of a
+// file into a truststore
+func SplitCertificates(bundle string) ([]string, error) {
+	var certificates []string
+
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected '%s' block in certificate bundle", block.Type)
+		}
+		certificates = append(certificates, string(pem.EncodeToMemory(block)))
+	}
+
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("not a PEM encoded certificate bundle")
+	}
+
+	return certificates, nil
+}
+
+// CommandsImportingTrustedCa returns the commands importing a CA certificate in remote machine into the truststore of
+// the JDK under an alias, replacing any certificate of the same alias from a previous build
+func CommandsImportingTrustedCa(certPath string, alias string) []string {
+	return []string{
+		fmt.Sprintf("sudo keytool -delete -noprompt -cacerts -storepass %s -alias %s 2>/dev/null || true", jdkTruststorePassword, alias),
+		fmt.Sprintf("sudo keytool -importcert -noprompt -cacerts -storepass %s -alias %s -file %s", jdkTruststorePassword, alias, certPath),
+	}
+}
@@ -8,70 +8,237 @@ import (
 	"encoding/base64"
 	"fmt"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/file-provisioner"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/shell"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"github.com/hashicorp/packer-plugin-sdk/tmp"
+	"os"
 	"path/filepath"
+	"strings"
 )
 
 const defaultHomeDir string = "/home/ubuntu"
-const nginxConfigDst string = "/etc/nginx/sites-enabled/default"
+const nginxSitesAvailableDir string = "/etc/nginx/sites-available"
+const nginxSitesEnabledDir string = "/etc/nginx/sites-enabled"
+const nginxBindingsDir string = "/etc/nginx/server-bindings"
+
+// The directory in remote machine recording the owner of every domain, i.e. the provisioner and Packer run that
+// installed its site, whichever proxy serves it
+const siteOwnersDir string = "/etc/qubitpi/site-owners"
+
+// The Nginx config defining the "Connection" header of WebSocket proxying for all servers, see nginx.ConnectionUpgradeMap()
+const nginxConnectionUpgradeDst string = "/etc/nginx/conf.d/connection-upgrade.conf"
+
 const nginxConfigFilename string = "nginx-ssl.conf"
+const nginxDefaultConfigFilename string = "nginx-default.conf"
+const nginxBindingsFilename string = "nginx-ssl.bindings"
+const nginxConnectionUpgradeFilename string = "nginx-connection-upgrade.conf"
+const siteOwnerFilename string = "site.owner"
 const sslCertFilename string = "ssl.crt"
 const sslCertKeyFilename string = "ssl.key"
+const backupDir string = "/var/backups/nginx-ssl"
+
+const dhParamFilename string = "dhparam.pem"
+
+// PrivateStagingDir is the directory in remote machine that UploadPrivate() streams private files, such as keys, into
+// before they are installed to their destinations. It is owned by root with mode 700 and lives on the tmpfs of /run, so
+// that private files never touch the disk outside of their destinations
+const PrivateStagingDir string = "/run/qubitpi-private"
+
+// StagedSslCertKeyFilename is the name of the SSL certificate key in PrivateStagingDir. A provisioner that needs the key
+// itself, e.g. for a Java keystore, streams it there with UploadPrivate() under this name, keeps it, and then passes an
+// empty key to Provision(), which installs the staged key instead of streaming it again
+const StagedSslCertKeyFilename string = sslCertKeyFilename
+
+// Config contains the settings of the SSL layer that are shared by all provisioners putting a proxy, Nginx by default, in
+// front of their apps. Provisioners embed it into their own Config with `mapstructure:",squash"`
+type Config struct {
+	ProxyBackend string `mapstructure:"proxyBackend" required:"false"`
 
-const SslCertDst string = "/etc/ssl/certs/server.crt"
-const SslCertKeyDst string = "/etc/ssl/private/server.key"
+	TlsProfile   string `mapstructure:"tlsProfile" required:"false"`
+	HstsPreload  bool   `mapstructure:"hstsPreload" required:"false"`
+	OcspStapling *bool  `mapstructure:"ocspStapling" required:"false"`
+	Resolver     string `mapstructure:"resolver" required:"false"`
 
+	NginxTemplate     string            `mapstructure:"nginxTemplate" required:"false"`
+	NginxTemplateVars map[string]string `mapstructure:"nginxTemplateVars" required:"false"`
+
+	ProxyConnectTimeout string `mapstructure:"proxyConnectTimeout" required:"false"`
+	ProxySendTimeout    string `mapstructure:"proxySendTimeout" required:"false"`
+	ProxyReadTimeout    string `mapstructure:"proxyReadTimeout" required:"false"`
+	ProxyBuffering      *bool  `mapstructure:"proxyBuffering" required:"false"`
+	ProxyWebSocket      *bool  `mapstructure:"proxyWebSocket" required:"false"`
+	ClientMaxBodySize   string `mapstructure:"clientMaxBodySize" required:"false"`
+
+	SecurityHeaders map[string]string `mapstructure:"securityHeaders" required:"false"`
+	RateLimit       string            `mapstructure:"rateLimit" required:"false"`
+	RateLimitBurst  string            `mapstructure:"rateLimitBurst" required:"false"`
+	AccessRules     []AccessRule      `mapstructure:"accessRule" required:"false"`
+	ClientCaBase64  string            `mapstructure:"clientCaBase64" required:"false"`
+}
+
+// A file of a site that is uploaded to the home directory, or to PrivateStagingDir if it has a mode, and then moved to
+// its destination in remote machine
+type siteFile struct {
+	filename    string
+	destination string
+	content     string
+
+	// If set, the file is installed as owned by root:<group> with this mode, e.g. "640" for files that only the proxy may
+	// read, and the build fails if it does not end up like this
+	mode  string
+	group string
+}
+
+// Provision installs Nginx together with the SSL certificate of a domain and the Nginx config of that domain as a
+// separate site, i.e. /etc/nginx/sites-available/<domain>.conf, which is enabled through a symlink in sites-enabled.
+// This allows multiple provisioners to put their domains behind the same Nginx instance.
+//
+// The catch-all default server is managed by this function as the "default" site, so the provided Nginx config must
+// not contain a default server. Before anything is installed, the "listen"/"server_name" pairs of the Nginx config are
+// checked against the ones of the sites installed by previous provisioners and the build fails on any conflict. The
+// build also fails if the domain itself is owned by another provisioner, or has already been claimed in the same Packer
+// run; "owner" is recorded for the domain otherwise, see Owner().
+//
+// An empty "sslCertKeyBase64" means that the key has already been staged, see StagedSslCertKeyFilename.
+//
+// If "proxyBackend" is Caddy or Traefik, the Nginx config is rendered into an equivalent site of that proxy instead,
+// which is installed, checked, and validated the same way
 func Provision(
 	ctx context.Context,
 	interCtx interpolate.Context,
 	ui packersdk.Ui,
 	communicator packersdk.Communicator,
 	homeDir string,
+	owner string,
+	domain string,
 	sslCertBase64 string,
 	sslCertKeyBase64 string,
-	nginxConfig string,
+	config Config,
+	nginxConfig nginx.Config,
 ) error {
 	sslCert, err := DecodeBase64(sslCertBase64)
 	if err != nil {
 		ui.Say(fmt.Sprintf("Error decoding SSL cert base64: %s", err))
 		panic(err)
 	}
-	sslCertSource, err := WriteToFile(sslCert)
-	sslCertDestination := fmt.Sprintf(filepath.Join(homeDir, sslCertFilename))
-	err = file.Provision(interCtx, ui, communicator, sslCertSource, sslCertDestination)
-	if err != nil {
-		ui.Say(fmt.Sprintf("error uploading '%s' to '%s': %s", sslCertSource, sslCertDestination, err))
-		panic(err)
-	}
 
 	sslCertKey, err := DecodeBase64(sslCertKeyBase64)
 	if err != nil {
 		ui.Say(fmt.Sprintf("Error decoding SSL cert key base64: %s", err))
 		panic(err)
 	}
-	sslCertKeySource, err := WriteToFile(sslCertKey)
-	sslCertKeyDestination := fmt.Sprintf(filepath.Join(homeDir, sslCertKeyFilename))
-	err = file.Provision(interCtx, ui, communicator, sslCertKeySource, sslCertKeyDestination)
+
+	htpasswdFiles, err := config.htpasswdFiles(domain)
 	if err != nil {
-		ui.Say(fmt.Sprintf("error uploading '%s' to '%s': %s", sslCertKeySource, sslCertKeyDestination, err))
-		panic(err)
+		return err
+	}
+
+	clientCaFiles, err := config.clientCaFiles(domain)
+	if err != nil {
+		return err
 	}
 
-	if nginxConfig != "" {
-		nginxSource, err := WriteToFile(nginxConfig)
-		nginxDst := fmt.Sprintf(filepath.Join(homeDir, nginxConfigFilename))
-		err = file.Provision(interCtx, ui, communicator, nginxSource, nginxDst)
+	var files []siteFile
+	var routers []string
+	switch config.proxyBackend() {
+	case CaddyBackend:
+		files, err = config.caddySiteFiles(domain, sslCert, sslCertKey, nginxConfig)
+	case TraefikBackend:
+		files, routers, err = config.traefikSiteFiles(domain, sslCert, sslCertKey, nginxConfig)
+	default:
+		var siteConfig nginx.Config
+		siteConfig, err = config.apply(domain, nginxConfig)
+		files = getSiteFiles(domain, sslCert, sslCertKey, siteConfig)
+	}
+	if err != nil {
+		return err
+	}
 
+	files = append(append(files, htpasswdFiles...), clientCaFiles...)
+	files = append(files, siteFile{filename: siteOwnerFilename, destination: siteOwnerDst(domain), content: owner + "\n"})
+	for _, file := range files {
+		if file.filename == sslCertKeyFilename && sslCertKeyBase64 == "" {
+			continue
+		}
+
+		if file.mode == "" {
+			err = Upload(interCtx, ui, communicator, file.content, file.source(homeDir))
+		} else {
+			err = UploadPrivate(ctx, ui, communicator, file.content, file.filename)
+		}
 		if err != nil {
-			ui.Say(fmt.Sprintf("error uploading '%s' to '%s': %s", nginxSource, nginxDst, err))
-			panic(err)
+			return err
 		}
 	}
 
-	return shell.Provision(ctx, ui, communicator, getSslSetupCommands(homeDir))
+	switch config.proxyBackend() {
+	case CaddyBackend:
+		return shell.Provision(ctx, ui, communicator, getCaddySetupCommands(homeDir, owner, domain, files))
+	case TraefikBackend:
+		return shell.Provision(ctx, ui, communicator, getTraefikSetupCommands(homeDir, owner, domain, routers, files))
+	default:
+		return shell.Provision(ctx, ui, communicator, getSslSetupCommands(homeDir, owner, domain, files))
+	}
+}
+
+// Applies the settings of the SSL layer, such as the TLS profile, to the built-in Nginx config of a provisioner
+func (c Config) apply(domain string, nginxConfig nginx.Config) (nginx.Config, error) {
+	return c.applySecurity(domain, c.applyProxySettings(c.applyTlsProfile(nginxConfig)))
+}
+
+// Returns the path in remote machine that a site file is uploaded to
+func (f siteFile) source(homeDir string) string {
+	if f.mode != "" {
+		return PrivateStagingPath(f.filename)
+	}
+	return filepath.Join(homeDir, f.filename)
+}
+
+// Returns the files of the site of a domain, i.e. its certificate, Nginx config, and the "listen"/"server_name" pairs
+// of the config, together with the shared default site and Diffie-Hellman parameters
+func getSiteFiles(domain string, sslCert string, sslCertKey string, nginxConfig nginx.Config) []siteFile {
+	return []siteFile{
+		{filename: nginxConfigFilename, destination: filepath.Join(nginxSitesAvailableDir, domain+".conf"), content: nginxConfig.Render()},
+		{filename: nginxDefaultConfigFilename, destination: filepath.Join(nginxSitesAvailableDir, "default"), content: nginx.Config{Servers: []nginx.Server{nginx.DefaultServer()}}.Render()},
+		{filename: nginxBindingsFilename, destination: filepath.Join(nginxBindingsDir, domain), content: strings.Join(nginxConfig.Bindings(), "\n") + "\n"},
+		{filename: sslCertFilename, destination: SslCertDst(domain), content: sslCert},
+		{filename: sslCertKeyFilename, destination: SslCertKeyDst(domain), content: sslCertKey, mode: "600", group: "root"},
+		{filename: dhParamFilename, destination: DhParamDst, content: ffdhe2048},
+		{filename: nginxConnectionUpgradeFilename, destination: nginxConnectionUpgradeDst, content: nginx.Config{HttpDirectives: []nginx.Directive{nginx.ConnectionUpgradeMap()}}.Render()},
+	}
+}
+
+// Owner returns the owner that a provisioner records for the domains it installs, i.e. its name, such as
+// "react-provisioner", followed by the UUID of the Packer run, if any.
+//
+// A later run of the same provisioner, e.g. one that rebuilds an image from a previous one, may therefore take over the
+// domain, while another provisioner, or a second site of the same run, may not
+func Owner(provisioner string, generatedData map[string]interface{}) string {
+	runUuid, _ := generatedData["PackerRunUUID"].(string)
+	return strings.TrimSpace(provisioner + " " + runUuid)
+}
+
+// Returns the file recording the owner of a domain in remote machine. Unlike the bindings of the domain, it has an
+// extension, so that the two do not overwrite each other in the backup directory
+func siteOwnerDst(domain string) string {
+	return filepath.Join(siteOwnersDir, domain+".owner")
+}
+
+// SslCertDst returns the location of the SSL certificate of a domain in remote machine
+func SslCertDst(domain string) string {
+	return fmt.Sprintf("/etc/ssl/certs/%s.crt", domain)
+}
+
+// SslCertKeyDst returns the location of the SSL certificate key of a domain in remote machine
+func SslCertKeyDst(domain string) string {
+	return fmt.Sprintf("/etc/ssl/private/%s.key", domain)
+}
+
+// NginxTls returns the certificate settings of an SSL-enabled Nginx server that serves a domain
+func NginxTls(domain string) *nginx.TLS {
+	return &nginx.TLS{Certificate: SslCertDst(domain), CertificateKey: SslCertKeyDst(domain)}
 }
 
 // GetHomeDir Returns the home directory in Packer image builder. If a directory is specified, it is returned as it;
@@ -89,7 +256,8 @@ func GetHomeDir(configValue string) string {
 	return configValue
 }
 
-// WriteToFile Flushes a specified string into a temporary file and returns the path of that file.
+// WriteToFile Flushes a specified string into a temporary file and returns the path of that file. The file is only
+// readable by the current user and it is up to the caller to remove it; Upload() does both in one go.
 //
 // content: The provided file content
 //
@@ -117,15 +285,190 @@ func DecodeBase64(encoded string) (string, error) {
 	return string(data), nil
 }
 
-// Return all commmnds for installing Nginx and loading SSL & Nginx config files to the proper location in remote
-// machine
-func getSslSetupCommands(homeDir string) []string {
-	return []string{
+// Upload flushes a specified content into a temporary file, uploads it to a specified destination in remote machine,
+// and removes the temporary file. The uploaded file keeps the mode of the temporary file, i.e. it is only readable by
+// the SSH user, until it is moved to its final destination. Private files, such as keys, go through UploadPrivate()
+// instead
+func Upload(interCtx interpolate.Context, ui packersdk.Ui, communicator packersdk.Communicator, content string, destination string) error {
+	source, err := WriteToFile(content)
+	if err != nil {
+		return fmt.Errorf("error writing content of '%s' into a file: %s", destination, err)
+	}
+	defer os.Remove(source)
+
+	err = file.Provision(interCtx, ui, communicator, source, destination)
+	if err != nil {
+		return fmt.Errorf("error uploading '%s' to '%s': %s", source, destination, err)
+	}
+
+	return nil
+}
+
+// PrivateStagingPath returns the path of a file in PrivateStagingDir
+func PrivateStagingPath(filename string) string {
+	return filepath.Join(PrivateStagingDir, filename)
+}
+
+// UploadPrivate streams a content through "sudo" into a file of PrivateStagingDir, which is created beforehand. The file
+// is owned by root with mode 600 from the start, and the content is written to no other file on either end, so that it
+// is never readable by the SSH user. The returned error covers the exit status of the remote command as well
+func UploadPrivate(ctx context.Context, ui packersdk.Ui, communicator packersdk.Communicator, content string, filename string) error {
+	destination := PrivateStagingPath(filename)
+
+	cmd := &packersdk.RemoteCmd{
+		Command: fmt.Sprintf(
+			"sudo install -d -o root -g root -m 700 %s && sudo sh -c 'umask 077 && cat > %s'",
+			PrivateStagingDir,
+			destination,
+		),
+		Stdin: strings.NewReader(content),
+	}
+	if err := cmd.RunWithUi(ctx, communicator, ui); err != nil {
+		return fmt.Errorf("error streaming private file to '%s': %s", destination, err)
+	}
+	if cmd.ExitStatus() != 0 {
+		return fmt.Errorf("error streaming private file to '%s': exit status %d", destination, cmd.ExitStatus())
+	}
+
+	return nil
+}
+
+// CommandInstallingPrivateFile returns the command moving an uploaded file into a destination owned by root:<group>
+// with a mode, e.g. "600". The destination is created with that owner and mode right away and the uploaded copy is
+// shredded afterwards, so the content is never readable by anyone else on the way
+func CommandInstallingPrivateFile(source string, destination string, group string, mode string) string {
+	return fmt.Sprintf("sudo install -o root -g %s -m %s %s %s && sudo shred -u %s", group, mode, source, destination, source)
+}
+
+// CommandCheckingPermissions returns the command failing the build unless a file in remote machine is owned by
+// root:<group> and has exactly a mode, e.g. "600"
+func CommandCheckingPermissions(path string, group string, mode string) string {
+	return fmt.Sprintf(
+		"if [ \"$(sudo stat -c '%%U:%%G %%a' %s)\" != \"root:%s %s\" ]; then echo \"%s must be owned by root:%s with mode %s, got $(sudo stat -c '%%U:%%G %%a' %s)\" >&2; exit 1; fi",
+		path, group, mode, path, group, mode, path,
+	)
+}
+
+// Returns the command shredding the uploaded files of a site that are still in the home directory or PrivateStagingDir
+// when the setup script exits, e.g. because of a conflict with another site
+func getCleanupCommand(homeDir string, files []siteFile) string {
+	var uploaded []string
+	for _, file := range files {
+		uploaded = append(uploaded, file.source(homeDir))
+	}
+
+	return shell.CommandCleaningUpOnExit(
+		fmt.Sprintf("for FILE in %s; do if [ -e $FILE ]; then sudo shred -u $FILE; fi; done", strings.Join(uploaded, " ")),
+	)
+}
+
+// Returns the commands failing the build unless the private files of a site, e.g. the certificate key, end up with
+// their owner and mode
+func getPermissionCheckCommands(files []siteFile) []string {
+	var commands []string
+	for _, file := range files {
+		if file.mode != "" {
+			commands = append(commands, CommandCheckingPermissions(file.destination, file.group, file.mode))
+		}
+	}
+	return commands
+}
+
+// Return all commmnds for installing Nginx and loading SSL & Nginx config files of a domain to the proper location in
+// remote machine.
+//
+// The build fails right away if the domain is owned by someone else, see Owner(), or if any "listen"/"server_name"
+// pair of the new site is already taken by another site. The previous config and certificate files are backed up before
+// being replaced. If the new files do not pass "nginx -t", the validation output is printed, the backup is restored,
+// and the script exits with failure, which fails the build. Otherwise Nginx is enabled at boot and reloaded with the
+// new config
+func getSslSetupCommands(homeDir string, owner string, domain string, files []siteFile) []string {
+	siteConfig := filepath.Join(nginxSitesAvailableDir, domain+".conf")
+	siteLink := filepath.Join(nginxSitesEnabledDir, domain+".conf")
+
+	commands := []string{
+		getCleanupCommand(homeDir, files),
 		"sudo apt update && sudo apt upgrade -y",
 
 		"sudo apt install -y nginx",
-		fmt.Sprintf("sudo mv %s/%s %s", homeDir, nginxConfigFilename, nginxConfigDst),
-		fmt.Sprintf("sudo mv %s/%s %s", homeDir, sslCertFilename, SslCertDst),
-		fmt.Sprintf("sudo mv %s/%s %s", homeDir, sslCertKeyFilename, SslCertKeyDst),
+		fmt.Sprintf("sudo mkdir -p %s %s %s", nginxBindingsDir, HtpasswdDir, siteOwnersDir),
+		getSystemResolverCommand(),
+		getOwnerCheckCommand("Nginx", owner, domain),
+		getConflictCheckCommand("Nginx", filepath.Join(homeDir, nginxBindingsFilename), nginxBindingsDir, domain),
+		fmt.Sprintf("sudo rm -rf %s && sudo mkdir -m 700 -p %s", backupDir, backupDir),
 	}
+
+	installCommands, restoreCommands := getInstallCommands(homeDir, files)
+	commands = append(commands, installCommands...)
+	restoreCommands = append(restoreCommands, fmt.Sprintf("if [ ! -e %s ]; then sudo rm -f %s; fi", siteConfig, siteLink))
+
+	commands = append(
+		commands,
+		fmt.Sprintf("sudo ln -sf %s %s", siteConfig, siteLink),
+		fmt.Sprintf("sudo ln -sf %s %s", filepath.Join(nginxSitesAvailableDir, "default"), filepath.Join(nginxSitesEnabledDir, "default")),
+	)
+
+	commands = append(
+		commands,
+		fmt.Sprintf(
+			"if ! NGINX_TEST_OUTPUT=$(sudo nginx -t 2>&1); then echo \"Nginx config validation failed; restoring previous config: $NGINX_TEST_OUTPUT\" >&2; %s; exit 1; fi",
+			strings.Join(restoreCommands, "; "),
+		),
+		fmt.Sprintf("sudo rm -rf %s", backupDir),
+	)
+
+	commands = append(commands, shell.CommandsStartingService("nginx")...)
+
+	return append(commands, getPermissionCheckCommands(files)...)
+}
+
+// Returns the command failing the build if the domain is owned by another provisioner, or has already been claimed by
+// the same provisioner in the same Packer run, see Owner()
+func getOwnerCheckCommand(proxy string, owner string, domain string) string {
+	provisioner, runUuid, _ := strings.Cut(owner, " ")
+	condition := fmt.Sprintf("[ \"${OWNER%%%% *}\" != \"%s\" ]", provisioner)
+	if runUuid != "" {
+		condition += fmt.Sprintf(" || [ \"$OWNER\" = \"%s\" ]", owner)
+	}
+
+	return fmt.Sprintf(
+		"if OWNER=$(sudo cat %s 2>/dev/null) && { %s; }; then echo \"%s site %s is already owned by $OWNER\" >&2; exit 1; fi",
+		siteOwnerDst(domain), condition, proxy, domain,
+	)
+}
+
+// Returns the command failing the build if any "<port> <server name>" pair of the new site of a domain is already taken
+// by the site of another domain
+func getConflictCheckCommand(proxy string, newBindings string, bindingsDir string, domain string) string {
+	return fmt.Sprintf(
+		"if CONFLICTS=$(sudo grep -r -F -x -f %s %s --exclude=%s); then echo \"%s site %s conflicts with the listen/server_name pairs of other sites: $CONFLICTS\" >&2; exit 1; fi",
+		newBindings, bindingsDir, domain, proxy, domain,
+	)
+}
+
+// Returns the commands backing up the current destinations of the site files to the backup directory and then moving
+// the uploaded files into place, as well as the commands restoring the backups. Files with a mode are installed from
+// PrivateStagingDir with their owner and mode right away
+func getInstallCommands(homeDir string, files []siteFile) ([]string, []string) {
+	var commands []string
+	var restoreCommands []string
+	for _, file := range files {
+		backup := filepath.Join(backupDir, filepath.Base(file.destination))
+		commands = append(commands, fmt.Sprintf("if [ -e %s ]; then sudo cp -p %s %s; fi", file.destination, file.destination, backup))
+		restoreCommands = append(
+			restoreCommands,
+			fmt.Sprintf("if [ -e %s ]; then sudo mv %s %s; else sudo rm -f %s; fi", backup, backup, file.destination, file.destination),
+		)
+	}
+
+	for _, file := range files {
+		source := file.source(homeDir)
+		if file.mode == "" {
+			commands = append(commands, fmt.Sprintf("sudo mv %s %s", source, file.destination))
+		} else {
+			commands = append(commands, CommandInstallingPrivateFile(source, file.destination, file.group, file.mode))
+		}
+	}
+
+	return commands, restoreCommands
 }
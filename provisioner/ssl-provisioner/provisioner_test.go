@@ -3,7 +3,71 @@
 
 package ssl
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A MockCommunicator that keeps all uploads and commands, together with their standard input, and lets the commands
+// containing failingCommand exit with 1
+type recordingCommunicator struct {
+	packersdk.MockCommunicator
+
+	failingCommand string
+	uploads        map[string]string
+	commands       []string
+	stdins         map[string]string
+}
+
+func (c *recordingCommunicator) Upload(path string, r io.Reader, fi *os.FileInfo) error {
+	if err := c.MockCommunicator.Upload(path, r, fi); err != nil {
+		return err
+	}
+	if c.uploads == nil {
+		c.uploads = map[string]string{}
+	}
+	c.uploads[path] = c.UploadData
+	return nil
+}
+
+func (c *recordingCommunicator) Start(ctx context.Context, rc *packersdk.RemoteCmd) error {
+	c.commands = append(c.commands, rc.Command)
+	if rc.Stdin != nil {
+		stdin, _ := io.ReadAll(rc.Stdin)
+		if c.stdins == nil {
+			c.stdins = map[string]string{}
+		}
+		c.stdins[rc.Command] = string(stdin)
+		rc.Stdin = bytes.NewReader(stdin)
+	}
+
+	c.StartExitStatus = 0
+	if c.failingCommand != "" && strings.Contains(rc.Command, c.failingCommand) {
+		c.StartExitStatus = 1
+	}
+	return c.MockCommunicator.Start(ctx, rc)
+}
+
+// Returns the shell script uploaded by shell.Provision()
+func (c *recordingCommunicator) script() string {
+	for path, data := range c.uploads {
+		if strings.HasPrefix(path, "/tmp/script_") {
+			return data
+		}
+	}
+	return ""
+}
 
 func TestWriteToFile(t *testing.T) {
 	filename1, err := WriteToFile("foo")
@@ -16,12 +80,34 @@ func TestWriteToFile(t *testing.T) {
 		t.Error(err)
 	}
 
+	defer os.Remove(filename1)
+	defer os.Remove(filename2)
+
 	t.Logf("filename 1: %s; filename 2: %s", filename1, filename2)
 	if filename1 == filename2 {
 		t.Errorf("WritingToFile on the same content should generate different file names across invocations. But 2 function calls generate a same filename of %s", filename1)
 	}
 }
 
+func TestUpload(t *testing.T) {
+	before, _ := filepath.Glob(filepath.Join(os.TempDir(), "ssl-provisioner*"))
+
+	communicator := &packersdk.MockCommunicator{}
+	err := Upload(interpolate.Context{}, packersdk.TestUi(t), communicator, "private key", "/home/ubuntu/ssl.key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if communicator.UploadPath != "/home/ubuntu/ssl.key" || communicator.UploadData != "private key" {
+		t.Errorf("Expected the content to be uploaded to '/home/ubuntu/ssl.key', got '%s' at '%s'", communicator.UploadData, communicator.UploadPath)
+	}
+
+	after, _ := filepath.Glob(filepath.Join(os.TempDir(), "ssl-provisioner*"))
+	if len(after) != len(before) {
+		t.Errorf("Expected the local temporary file to be removed after upload, got %v", after)
+	}
+}
+
 func TestGetHomeDir(t *testing.T) {
 	data := []struct {
 		name        string
@@ -54,3 +140,209 @@ func TestDecodeBase64(t *testing.T) {
 		t.Errorf("Wrong decode: '%s'. Should be '%s'", actual, decoded)
 	}
 }
+
+func Test_getSslSetupCommands(t *testing.T) {
+	actualCommands := getSslSetupCommands(
+		"/home/ubuntu",
+		"react-provisioner 6f1c9e2a",
+		"app.mycompany.com",
+		append(
+			getSiteFiles("app.mycompany.com", "", "", nginx.Config{}),
+			siteFile{filename: "htpasswd.0", destination: htpasswdDst("app.mycompany.com", 0), mode: "640", group: "www-data"},
+		),
+	)
+
+	expectedCommands := []string{
+		`EXIT_CLEANUPS="${EXIT_CLEANUPS:+$EXIT_CLEANUPS; }"'{ for FILE in /home/ubuntu/nginx-ssl.conf /home/ubuntu/nginx-default.conf /home/ubuntu/nginx-ssl.bindings /home/ubuntu/ssl.crt /run/qubitpi-private/ssl.key /home/ubuntu/dhparam.pem /home/ubuntu/nginx-connection-upgrade.conf /run/qubitpi-private/htpasswd.0; do if [ -e $FILE ]; then sudo shred -u $FILE; fi; done; } || true'; trap 'eval "$EXIT_CLEANUPS"' EXIT`,
+		"sudo apt update && sudo apt upgrade -y",
+		"sudo apt install -y nginx",
+		"sudo mkdir -p /etc/nginx/server-bindings /etc/nginx/htpasswd /etc/qubitpi/site-owners",
+		`NAMESERVERS=$(awk '$1 == "nameserver" && $2 !~ /%/ { print ($2 ~ /:/ ? "[" $2 "]" : $2) }' /etc/resolv.conf | xargs); if [ -n "$NAMESERVERS" ]; then echo "resolver $NAMESERVERS;" | sudo tee /etc/nginx/conf.d/system-resolver.conf > /dev/null; fi`,
+		`if OWNER=$(sudo cat /etc/qubitpi/site-owners/app.mycompany.com.owner 2>/dev/null) && { [ "${OWNER%% *}" != "react-provisioner" ] || [ "$OWNER" = "react-provisioner 6f1c9e2a" ]; }; then echo "Nginx site app.mycompany.com is already owned by $OWNER" >&2; exit 1; fi`,
+		`if CONFLICTS=$(sudo grep -r -F -x -f /home/ubuntu/nginx-ssl.bindings /etc/nginx/server-bindings --exclude=app.mycompany.com); then echo "Nginx site app.mycompany.com conflicts with the listen/server_name pairs of other sites: $CONFLICTS" >&2; exit 1; fi`,
+		"sudo rm -rf /var/backups/nginx-ssl && sudo mkdir -m 700 -p /var/backups/nginx-ssl",
+		"if [ -e /etc/nginx/sites-available/app.mycompany.com.conf ]; then sudo cp -p /etc/nginx/sites-available/app.mycompany.com.conf /var/backups/nginx-ssl/app.mycompany.com.conf; fi",
+		"if [ -e /etc/nginx/sites-available/default ]; then sudo cp -p /etc/nginx/sites-available/default /var/backups/nginx-ssl/default; fi",
+		"if [ -e /etc/nginx/server-bindings/app.mycompany.com ]; then sudo cp -p /etc/nginx/server-bindings/app.mycompany.com /var/backups/nginx-ssl/app.mycompany.com; fi",
+		"if [ -e /etc/ssl/certs/app.mycompany.com.crt ]; then sudo cp -p /etc/ssl/certs/app.mycompany.com.crt /var/backups/nginx-ssl/app.mycompany.com.crt; fi",
+		"if [ -e /etc/ssl/private/app.mycompany.com.key ]; then sudo cp -p /etc/ssl/private/app.mycompany.com.key /var/backups/nginx-ssl/app.mycompany.com.key; fi",
+		"if [ -e /etc/nginx/dhparam.pem ]; then sudo cp -p /etc/nginx/dhparam.pem /var/backups/nginx-ssl/dhparam.pem; fi",
+		"if [ -e /etc/nginx/conf.d/connection-upgrade.conf ]; then sudo cp -p /etc/nginx/conf.d/connection-upgrade.conf /var/backups/nginx-ssl/connection-upgrade.conf; fi",
+		"if [ -e /etc/nginx/htpasswd/app.mycompany.com.0 ]; then sudo cp -p /etc/nginx/htpasswd/app.mycompany.com.0 /var/backups/nginx-ssl/app.mycompany.com.0; fi",
+		"sudo mv /home/ubuntu/nginx-ssl.conf /etc/nginx/sites-available/app.mycompany.com.conf",
+		"sudo mv /home/ubuntu/nginx-default.conf /etc/nginx/sites-available/default",
+		"sudo mv /home/ubuntu/nginx-ssl.bindings /etc/nginx/server-bindings/app.mycompany.com",
+		"sudo mv /home/ubuntu/ssl.crt /etc/ssl/certs/app.mycompany.com.crt",
+		"sudo install -o root -g root -m 600 /run/qubitpi-private/ssl.key /etc/ssl/private/app.mycompany.com.key && sudo shred -u /run/qubitpi-private/ssl.key",
+		"sudo mv /home/ubuntu/dhparam.pem /etc/nginx/dhparam.pem",
+		"sudo mv /home/ubuntu/nginx-connection-upgrade.conf /etc/nginx/conf.d/connection-upgrade.conf",
+		"sudo install -o root -g www-data -m 640 /run/qubitpi-private/htpasswd.0 /etc/nginx/htpasswd/app.mycompany.com.0 && sudo shred -u /run/qubitpi-private/htpasswd.0",
+		"sudo ln -sf /etc/nginx/sites-available/app.mycompany.com.conf /etc/nginx/sites-enabled/app.mycompany.com.conf",
+		"sudo ln -sf /etc/nginx/sites-available/default /etc/nginx/sites-enabled/default",
+		`if ! NGINX_TEST_OUTPUT=$(sudo nginx -t 2>&1); then echo "Nginx config validation failed; restoring previous config: $NGINX_TEST_OUTPUT" >&2; if [ -e /var/backups/nginx-ssl/app.mycompany.com.conf ]; then sudo mv /var/backups/nginx-ssl/app.mycompany.com.conf /etc/nginx/sites-available/app.mycompany.com.conf; else sudo rm -f /etc/nginx/sites-available/app.mycompany.com.conf; fi; if [ -e /var/backups/nginx-ssl/default ]; then sudo mv /var/backups/nginx-ssl/default /etc/nginx/sites-available/default; else sudo rm -f /etc/nginx/sites-available/default; fi; if [ -e /var/backups/nginx-ssl/app.mycompany.com ]; then sudo mv /var/backups/nginx-ssl/app.mycompany.com /etc/nginx/server-bindings/app.mycompany.com; else sudo rm -f /etc/nginx/server-bindings/app.mycompany.com; fi; if [ -e /var/backups/nginx-ssl/app.mycompany.com.crt ]; then sudo mv /var/backups/nginx-ssl/app.mycompany.com.crt /etc/ssl/certs/app.mycompany.com.crt; else sudo rm -f /etc/ssl/certs/app.mycompany.com.crt; fi; if [ -e /var/backups/nginx-ssl/app.mycompany.com.key ]; then sudo mv /var/backups/nginx-ssl/app.mycompany.com.key /etc/ssl/private/app.mycompany.com.key; else sudo rm -f /etc/ssl/private/app.mycompany.com.key; fi; if [ -e /var/backups/nginx-ssl/dhparam.pem ]; then sudo mv /var/backups/nginx-ssl/dhparam.pem /etc/nginx/dhparam.pem; else sudo rm -f /etc/nginx/dhparam.pem; fi; if [ -e /var/backups/nginx-ssl/connection-upgrade.conf ]; then sudo mv /var/backups/nginx-ssl/connection-upgrade.conf /etc/nginx/conf.d/connection-upgrade.conf; else sudo rm -f /etc/nginx/conf.d/connection-upgrade.conf; fi; if [ -e /var/backups/nginx-ssl/app.mycompany.com.0 ]; then sudo mv /var/backups/nginx-ssl/app.mycompany.com.0 /etc/nginx/htpasswd/app.mycompany.com.0; else sudo rm -f /etc/nginx/htpasswd/app.mycompany.com.0; fi; if [ ! -e /etc/nginx/sites-available/app.mycompany.com.conf ]; then sudo rm -f /etc/nginx/sites-enabled/app.mycompany.com.conf; fi; exit 1; fi`,
+		"sudo rm -rf /var/backups/nginx-ssl",
+		"if [ -d /run/systemd/system ]; then sudo systemctl enable nginx && sudo systemctl reload-or-restart nginx; else sudo service nginx reload || sudo service nginx start; fi",
+		`if [ "$(sudo stat -c '%U:%G %a' /etc/ssl/private/app.mycompany.com.key)" != "root:root 600" ]; then echo "/etc/ssl/private/app.mycompany.com.key must be owned by root:root with mode 600, got $(sudo stat -c '%U:%G %a' /etc/ssl/private/app.mycompany.com.key)" >&2; exit 1; fi`,
+		`if [ "$(sudo stat -c '%U:%G %a' /etc/nginx/htpasswd/app.mycompany.com.0)" != "root:www-data 640" ]; then echo "/etc/nginx/htpasswd/app.mycompany.com.0 must be owned by root:www-data with mode 640, got $(sudo stat -c '%U:%G %a' /etc/nginx/htpasswd/app.mycompany.com.0)" >&2; exit 1; fi`,
+	}
+
+	if !reflect.DeepEqual(expectedCommands, actualCommands) {
+		t.Errorf("Expected and actual commands do not match: %s\n\n%s", expectedCommands, actualCommands)
+	}
+}
+
+func TestProvisionFailsOnConflict(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte("test"))
+
+	// The conflict check exits with 1 if another site already binds a "listen"/"server_name" pair of the new site
+	communicator := &recordingCommunicator{failingCommand: "/tmp/script_"}
+	err := Provision(
+		context.Background(),
+		interpolate.Context{},
+		packersdk.TestUi(t),
+		communicator,
+		"/home/ubuntu",
+		"react-provisioner",
+		"app.mycompany.com",
+		encoded,
+		encoded,
+		Config{},
+		backendTestConfig(),
+	)
+	if err == nil {
+		t.Errorf("Expected a conflicting site to fail the build")
+	}
+
+	if !strings.Contains(communicator.script(), "conflicts with the listen/server_name pairs of other sites") {
+		t.Errorf("Expected the conflict check in the setup script: %s", communicator.script())
+	}
+}
+
+// Runs the owner check of a domain that is already owned by "react-provisioner" in the Packer run "6f1c9e2a"
+func Test_getOwnerCheckCommand(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	ownersDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(ownersDir, "app.mycompany.com.owner"), []byte("react-provisioner 6f1c9e2a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []struct {
+		name   string
+		owner  string
+		domain string
+		error  string
+	}{
+		{"another provisioner", "reverse-proxy-provisioner 6f1c9e2a", "app.mycompany.com", "Nginx site app.mycompany.com is already owned by react-provisioner 6f1c9e2a"},
+		{"another provisioner without run", "reverse-proxy-provisioner", "app.mycompany.com", "is already owned by react-provisioner 6f1c9e2a"},
+		{"same provisioner in the same run", "react-provisioner 6f1c9e2a", "app.mycompany.com", "is already owned by react-provisioner 6f1c9e2a"},
+		{"same provisioner in a later run", "react-provisioner 0b7d4f18", "app.mycompany.com", ""},
+		{"unowned domain", "reverse-proxy-provisioner 6f1c9e2a", "api.mycompany.com", ""},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			check := strings.ReplaceAll(getOwnerCheckCommand("Nginx", d.owner, d.domain), siteOwnersDir, ownersDir)
+
+			var stderr strings.Builder
+			cmd := exec.Command("bash", "-c", "sudo() { \"$@\"; }\n"+check)
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+
+			if d.error == "" && err != nil {
+				t.Errorf("Expected the check to pass, got %s: %s", err, stderr.String())
+			}
+			if d.error != "" && (err == nil || !strings.Contains(stderr.String(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v: %s", d.error, err, stderr.String())
+			}
+		})
+	}
+}
+
+func TestOwner(t *testing.T) {
+	if owner := Owner("react-provisioner", map[string]interface{}{"PackerRunUUID": "6f1c9e2a"}); owner != "react-provisioner 6f1c9e2a" {
+		t.Errorf("Expected the owner to contain the Packer run, got '%s'", owner)
+	}
+	if owner := Owner("react-provisioner", nil); owner != "react-provisioner" {
+		t.Errorf("Expected the owner without a Packer run to be the provisioner, got '%s'", owner)
+	}
+}
+
+func TestProvisionStreamsPrivateFiles(t *testing.T) {
+	communicator := &recordingCommunicator{}
+	err := Provision(
+		context.Background(),
+		interpolate.Context{},
+		packersdk.TestUi(t),
+		communicator,
+		"/home/ubuntu",
+		"react-provisioner",
+		"app.mycompany.com",
+		base64.StdEncoding.EncodeToString([]byte("certificate")),
+		base64.StdEncoding.EncodeToString([]byte("private key")),
+		Config{AccessRules: []AccessRule{{BasicAuthUsers: map[string]string{"admin": "secret"}}}},
+		backendTestConfig(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if communicator.uploads["/home/ubuntu/site.owner"] != "react-provisioner\n" {
+		t.Errorf("Expected the owner of the domain to be uploaded, got uploads %v", communicator.uploads)
+	}
+	if !strings.Contains(communicator.script(), "sudo cp -p /etc/qubitpi/site-owners/app.mycompany.com.owner /var/backups/nginx-ssl/app.mycompany.com.owner") {
+		t.Errorf("Expected the owner of the domain to be backed up apart from its bindings: %s", communicator.script())
+	}
+
+	for path, data := range communicator.uploads {
+		if data == "private key" || strings.Contains(path, "htpasswd") {
+			t.Errorf("Expected no private file to be uploaded as the SSH user, got '%s'", path)
+		}
+	}
+
+	streamKey := "sudo install -d -o root -g root -m 700 /run/qubitpi-private && sudo sh -c 'umask 077 && cat > /run/qubitpi-private/ssl.key'"
+	if communicator.stdins[streamKey] != "private key" {
+		t.Errorf("Expected the key to be streamed into the staging directory, got commands %v", communicator.commands)
+	}
+	if !strings.Contains(communicator.stdins["sudo install -d -o root -g root -m 700 /run/qubitpi-private && sudo sh -c 'umask 077 && cat > /run/qubitpi-private/htpasswd.0'"], "admin:") {
+		t.Errorf("Expected the htpasswd file to be streamed into the staging directory, got commands %v", communicator.commands)
+	}
+}
+
+func TestProvisionReusesStagedKey(t *testing.T) {
+	communicator := &recordingCommunicator{}
+	err := Provision(
+		context.Background(),
+		interpolate.Context{},
+		packersdk.TestUi(t),
+		communicator,
+		"/home/ubuntu",
+		"webservice-provisioner",
+		"app.mycompany.com",
+		base64.StdEncoding.EncodeToString([]byte("certificate")),
+		"",
+		Config{},
+		backendTestConfig(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, command := range communicator.commands {
+		if strings.Contains(command, PrivateStagingPath(StagedSslCertKeyFilename)+"'") {
+			t.Errorf("Expected the staged key not to be streamed again, got '%s'", command)
+		}
+	}
+	if !strings.Contains(communicator.script(), "sudo install -o root -g root -m 600 /run/qubitpi-private/ssl.key /etc/ssl/private/app.mycompany.com.key") {
+		t.Errorf("Expected the staged key to be installed: %s", communicator.script())
+	}
+}
+
+func TestUploadPrivate(t *testing.T) {
+	communicator := &recordingCommunicator{failingCommand: "umask 077"}
+	if err := UploadPrivate(context.Background(), packersdk.TestUi(t), communicator, "private key", "ssl.key"); err == nil {
+		t.Errorf("Expected a failing stream to return an error")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+)
+
+// ProxyWithDefaults returns the proxy settings of a location with defaults of the provisioner, such as the body size
+// limit of the only location of Nexus, which the settings configured in HCL override
+func (c Config) ProxyWithDefaults(defaults nginx.Proxy) *nginx.Proxy {
+	proxy := defaults
+	override(&proxy.ConnectTimeout, c.ProxyConnectTimeout)
+	override(&proxy.SendTimeout, c.ProxySendTimeout)
+	override(&proxy.ReadTimeout, c.ProxyReadTimeout)
+	override(&proxy.ClientMaxBodySize, c.ClientMaxBodySize)
+	if c.ProxyBuffering != nil {
+		proxy.Buffering = onOff(*c.ProxyBuffering)
+	}
+	if c.ProxyWebSocket != nil {
+		proxy.WebSocket = c.ProxyWebSocket
+	}
+	return &proxy
+}
+
+// WithoutProxySettings returns the config without the proxy settings, for provisioners that apply them to their
+// locations with ProxyWithDefaults() together with more specific settings that must not be overridden, such as the
+// options of a route of the reverse proxy
+func (c Config) WithoutProxySettings() Config {
+	c.ProxyConnectTimeout = ""
+	c.ProxySendTimeout = ""
+	c.ProxyReadTimeout = ""
+	c.ProxyBuffering = nil
+	c.ProxyWebSocket = nil
+	c.ClientMaxBodySize = ""
+	return c
+}
+
+// Applies the proxy settings configured in HCL to every proxied location of an Nginx config, overriding the defaults of
+// the provisioner, e.g. the longer timeouts of the admin ports of Kong. Settings not configured in HCL keep these
+// defaults
+func (c Config) applyProxySettings(nginxConfig nginx.Config) nginx.Config {
+	servers := make([]nginx.Server, 0, len(nginxConfig.Servers))
+	for _, server := range nginxConfig.Servers {
+		locations := make([]nginx.Location, 0, len(server.Locations))
+		for _, location := range server.Locations {
+			if location.Proxy != nil {
+				location.Proxy = c.ProxyWithDefaults(*location.Proxy)
+			}
+			locations = append(locations, location)
+		}
+		server.Locations = locations
+		servers = append(servers, server)
+	}
+	nginxConfig.Servers = servers
+
+	return nginxConfig
+}
+
+func override(setting *string, value string) {
+	if value != "" {
+		*setting = value
+	}
+}
+
+func onOff(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,92 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"reflect"
+	"testing"
+)
+
+func TestProxyWithDefaults(t *testing.T) {
+	enabled := true
+	disabled := false
+	defaults := nginx.Proxy{ReadTimeout: "300s", Buffering: "off", ClientMaxBodySize: "1G", WebSocket: &enabled}
+
+	config := Config{ProxyReadTimeout: "60s", ClientMaxBodySize: "0", ProxyBuffering: &enabled, ProxyWebSocket: &disabled}
+
+	expected := &nginx.Proxy{ReadTimeout: "60s", Buffering: "on", ClientMaxBodySize: "0", WebSocket: &disabled}
+	if actual := config.ProxyWithDefaults(defaults); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+	if actual := (Config{}).ProxyWithDefaults(defaults); !reflect.DeepEqual(&defaults, actual) {
+		t.Errorf("Expected the defaults without settings in HCL, got %v", actual)
+	}
+}
+
+func Test_applyProxySettings(t *testing.T) {
+	enabled := true
+	disabled := false
+	defaults := &nginx.Proxy{SendTimeout: "600s", ReadTimeout: "600s", Buffering: "off", WebSocket: &enabled}
+	nginxConfig := nginx.Config{
+		Servers: []nginx.Server{
+			{
+				Locations: []nginx.Location{
+					{Path: "/", Proxy: &nginx.Proxy{}, ProxyPass: "http://localhost:8000"},
+					{Path: "/admin", Proxy: defaults, ProxyPass: "http://localhost:8001"},
+					{Path: "/static", TryFiles: []string{"$uri", "=404"}},
+				},
+			},
+		},
+	}
+
+	config := Config{ProxyConnectTimeout: "10s", ProxyReadTimeout: "60s", ClientMaxBodySize: "0", ProxyBuffering: &enabled, ProxyWebSocket: &disabled}
+	actual := config.applyProxySettings(nginxConfig)
+
+	expected := &nginx.Proxy{ConnectTimeout: "10s", ReadTimeout: "60s", Buffering: "on", ClientMaxBodySize: "0", WebSocket: &disabled}
+	if !reflect.DeepEqual(expected, actual.Servers[0].Locations[0].Proxy) {
+		t.Errorf("Expected %v, got %v", expected, actual.Servers[0].Locations[0].Proxy)
+	}
+
+	expected = &nginx.Proxy{ConnectTimeout: "10s", SendTimeout: "600s", ReadTimeout: "60s", Buffering: "on", ClientMaxBodySize: "0", WebSocket: &disabled}
+	if !reflect.DeepEqual(expected, actual.Servers[0].Locations[1].Proxy) {
+		t.Errorf("Expected the settings in HCL to override the defaults of the location: %v, got %v", expected, actual.Servers[0].Locations[1].Proxy)
+	}
+	if defaults.ConnectTimeout != "" || defaults.ReadTimeout != "600s" {
+		t.Errorf("Applying proxy settings should not modify the defaults of the provisioner")
+	}
+
+	if actual.Servers[0].Locations[2].Proxy != nil {
+		t.Errorf("Locations without proxy settings should not be touched")
+	}
+}
+
+func Test_applyProxySettingsKeepsDefaults(t *testing.T) {
+	enabled := true
+	defaults := &nginx.Proxy{ReadTimeout: "300s", WebSocket: &enabled}
+	nginxConfig := nginx.Config{Servers: []nginx.Server{{Locations: []nginx.Location{{Path: "/", Proxy: defaults}}}}}
+
+	actual := Config{}.applyProxySettings(nginxConfig)
+
+	if !reflect.DeepEqual(defaults, actual.Servers[0].Locations[0].Proxy) {
+		t.Errorf("Expected %v, got %v", defaults, actual.Servers[0].Locations[0].Proxy)
+	}
+}
+
+func TestWithoutProxySettings(t *testing.T) {
+	enabled := true
+	config := Config{
+		ProxyBackend:        CaddyBackend,
+		ProxyConnectTimeout: "10s",
+		ProxySendTimeout:    "60s",
+		ProxyReadTimeout:    "60s",
+		ProxyBuffering:      &enabled,
+		ProxyWebSocket:      &enabled,
+		ClientMaxBodySize:   "0",
+	}
+
+	if actual := config.WithoutProxySettings(); !reflect.DeepEqual(Config{ProxyBackend: CaddyBackend}, actual) {
+		t.Errorf("Expected only the proxy settings to be removed, got %v", actual)
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type AccessRule
+
+package ssl
+
+import (
+	"encoding/pem"
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"golang.org/x/crypto/bcrypt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// HtpasswdDir is where the password files of the basic auth access rules are placed in remote machine
+const HtpasswdDir string = "/etc/nginx/htpasswd"
+
+const defaultRateLimitBurst string = "20"
+
+// The headers sent on every response of an SSL-enabled server unless overridden by "securityHeaders"
+var defaultSecurityHeaders = map[string]string{
+	"X-Frame-Options":        "SAMEORIGIN",
+	"X-Content-Type-Options": "nosniff",
+	"Referrer-Policy":        "strict-origin-when-cross-origin",
+}
+
+var rateLimitPattern = regexp.MustCompile(`^[0-9]+r/[sm]$`)
+
+// AccessRule restricts a location, or a whole SSL-enabled server, of the Nginx config to a list of client addresses,
+// to a set of basic auth users, to clients presenting a certificate signed by the CA given by "clientCaBase64", or to
+// any combination of them. For example
+//
+//	accessRule {
+//	  port           = "8444"
+//	  path           = "/"
+//	  allow          = ["10.0.0.0/8"]
+//	  basicAuthUsers = { admin = "password" }
+//	}
+type AccessRule struct {
+	// Domain selects the domain of the rule for provisioners serving several domains; all domains are selected if empty
+	Domain string `mapstructure:"domain" required:"false"`
+
+	// Port selects the servers listening on it; all servers are selected if empty
+	Port string `mapstructure:"port" required:"false"`
+
+	// Path is the path of the location, e.g. "/"; the rule applies to the whole server if empty
+	Path string `mapstructure:"path" required:"false"`
+
+	// Allow lists the addresses or CIDR ranges allowed to access the location. All other addresses are denied
+	Allow []string `mapstructure:"allow" required:"false"`
+
+	// BasicAuthUsers maps user names to their passwords, which are hashed at build time into an htpasswd file
+	BasicAuthUsers map[string]string `mapstructure:"basicAuthUsers" required:"false"`
+
+	// ClientCert requires a client certificate signed by the CA given by "clientCaBase64"
+	ClientCert bool `mapstructure:"clientCert" required:"false"`
+
+	// ClientSubjectHeader is the request header that the subject DN of a verified client certificate is passed to the
+	// app in, e.g. "X-Client-Subject". The header is overwritten so that clients cannot forge it
+	ClientSubjectHeader string `mapstructure:"clientSubjectHeader" required:"false"`
+}
+
+// ClientCaDst returns the location of the CA bundle verifying the client certificates of a domain in remote machine
+func ClientCaDst(domain string) string {
+	return fmt.Sprintf("/etc/ssl/certs/%s-client-ca.crt", domain)
+}
+
+// Returns the location of the password file of an access rule in remote machine
+func htpasswdDst(domain string, rule int) string {
+	return backendHtpasswdDst(HtpasswdDir, domain, rule)
+}
+
+func backendHtpasswdDst(htpasswdDir string, domain string, rule int) string {
+	return filepath.Join(htpasswdDir, fmt.Sprintf("%s.%d", domain, rule))
+}
+
+// Returns an error if the security settings cannot be applied
+func (c Config) validateSecurity() error {
+	if c.RateLimit != "" && !rateLimitPattern.MatchString(c.RateLimit) {
+		return fmt.Errorf("invalid rateLimit '%s'; expected requests per second or minute, e.g. '10r/s' or '300r/m'", c.RateLimit)
+	}
+
+	if c.ClientCaBase64 != "" {
+		clientCa, err := DecodeBase64(c.ClientCaBase64)
+		if err != nil {
+			return fmt.Errorf("invalid clientCaBase64: %s", err)
+		}
+		if block, _ := pem.Decode([]byte(clientCa)); block == nil || block.Type != "CERTIFICATE" {
+			return fmt.Errorf("invalid clientCaBase64: not a PEM encoded certificate bundle")
+		}
+	}
+
+	for i, rule := range c.AccessRules {
+		if len(rule.Allow) == 0 && len(rule.BasicAuthUsers) == 0 && !rule.ClientCert {
+			return fmt.Errorf("accessRule #%d needs at least one of 'allow', 'basicAuthUsers', and 'clientCert'", i+1)
+		}
+		if rule.ClientCert && c.ClientCaBase64 == "" {
+			return fmt.Errorf("accessRule #%d requires client certificates but no clientCaBase64 is configured", i+1)
+		}
+		if rule.ClientSubjectHeader != "" && !rule.ClientCert {
+			return fmt.Errorf("accessRule #%d has a clientSubjectHeader but does not require client certificates", i+1)
+		}
+	}
+
+	return nil
+}
+
+// Applies the security headers and the rate limit to every SSL-enabled server of an Nginx config and the access rules
+// to their matching servers and locations. An access rule that matches nothing is an error, because silently leaving a
+// location open is not what anyone who configured the rule wants
+func (c Config) applySecurity(domain string, nginxConfig nginx.Config) (nginx.Config, error) {
+	matched := make([]bool, len(c.AccessRules))
+
+	servers := make([]nginx.Server, 0, len(nginxConfig.Servers))
+	rateLimited := false
+	for _, server := range nginxConfig.Servers {
+		if server.TLS != nil {
+			var directives []nginx.Directive
+			if c.RateLimit != "" {
+				directives = append(
+					directives,
+					nginx.NewDirective("limit_req", "zone="+domain, "burst="+c.rateLimitBurst(), "nodelay"),
+					nginx.NewDirective("limit_req_status", "429"),
+				)
+				rateLimited = true
+			}
+			headers := c.securityHeaders()
+			directives = append(directives, headers...)
+
+			nestedHeaders := append([]nginx.Directive{}, headers...)
+			if server.TLS.HSTS != "" {
+				nestedHeaders = append(nestedHeaders, addHeader("Strict-Transport-Security", server.TLS.HSTS))
+			}
+			server.Directives = append(directives, withHeaders(server.Directives, nestedHeaders)...)
+
+			locations := make([]nginx.Location, 0, len(server.Locations))
+			for _, location := range server.Locations {
+				location.Directives = withHeaders(location.Directives, nestedHeaders)
+				if definesHeaders(location.Directives) {
+					location.Directives = append(append([]nginx.Directive{}, nestedHeaders...), location.Directives...)
+				}
+				locations = append(locations, location)
+			}
+			server.Locations = locations
+		}
+
+		for i, rule := range c.AccessRules {
+			if rule.appliesTo(domain) && server.TLS != nil && listensOn(server, rule.Port) {
+				var ruleMatched bool
+				server, ruleMatched = applyAccessRule(domain, i, rule, server)
+				matched[i] = matched[i] || ruleMatched
+			}
+		}
+
+		servers = append(servers, server)
+	}
+	nginxConfig.Servers = servers
+
+	if rateLimited {
+		nginxConfig.HttpDirectives = append(
+			append([]nginx.Directive{}, nginxConfig.HttpDirectives...),
+			nginx.NewDirective("limit_req_zone", "$binary_remote_addr", fmt.Sprintf("zone=%s:10m", domain), "rate="+c.RateLimit),
+		)
+	}
+
+	for i, rule := range c.AccessRules {
+		if rule.appliesTo(domain) && !matched[i] {
+			return nginx.Config{}, fmt.Errorf("accessRule #%d matches no SSL-enabled location '%s' on port '%s'", i+1, rule.Path, rule.Port)
+		}
+	}
+
+	return nginxConfig, nil
+}
+
+// Returns the password files of all basic auth access rules, with passwords hashed by bcrypt, in the format of the
+// configured proxy backend
+func (c Config) htpasswdFiles(domain string) ([]siteFile, error) {
+	layout := backendLayouts[c.proxyBackend()]
+
+	var files []siteFile
+	for i, rule := range c.AccessRules {
+		if len(rule.BasicAuthUsers) == 0 || !rule.appliesTo(domain) {
+			continue
+		}
+
+		users := make([]string, 0, len(rule.BasicAuthUsers))
+		for user := range rule.BasicAuthUsers {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+
+		var content strings.Builder
+		for _, user := range users {
+			hash, err := bcrypt.GenerateFromPassword([]byte(rule.BasicAuthUsers[user]), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, fmt.Errorf("error hashing the password of basic auth user '%s': %s", user, err)
+			}
+			content.WriteString(fmt.Sprintf("%s%s%s\n", user, layout.htpasswdSeparator, hash))
+		}
+
+		files = append(files, siteFile{
+			filename:    fmt.Sprintf("htpasswd.%d", i),
+			destination: backendHtpasswdDst(layout.htpasswdDir, domain, i),
+			content:     content.String(),
+			mode:        "640",
+			group:       layout.group,
+		})
+	}
+
+	return files, nil
+}
+
+// Returns the CA bundle verifying client certificates, if configured
+func (c Config) clientCaFiles(domain string) ([]siteFile, error) {
+	if c.ClientCaBase64 == "" {
+		return nil, nil
+	}
+
+	clientCa, err := DecodeBase64(c.ClientCaBase64)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding clientCaBase64: %s", err)
+	}
+
+	return []siteFile{{filename: "client-ca.crt", destination: ClientCaDst(domain), content: clientCa}}, nil
+}
+
+func (c Config) rateLimitBurst() string {
+	if c.RateLimitBurst == "" {
+		return defaultRateLimitBurst
+	}
+	return c.RateLimitBurst
+}
+
+// Returns the "add_header" directives of the security headers in a stable order
+func (c Config) securityHeaders() []nginx.Directive {
+	var directives []nginx.Directive
+	for _, header := range c.securityHeaderValues() {
+		directives = append(directives, addHeader(header[0], header[1]))
+	}
+
+	return directives
+}
+
+// Returns the name/value pairs of the security headers sorted by name. Headers configured with an empty value are not
+// sent
+func (c Config) securityHeaderValues() [][2]string {
+	headers := map[string]string{}
+	for name, value := range defaultSecurityHeaders {
+		headers[name] = value
+	}
+	for name, value := range c.SecurityHeaders {
+		headers[name] = value
+	}
+
+	names := make([]string, 0, len(headers))
+	for name, value := range headers {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	values := make([][2]string, 0, len(names))
+	for _, name := range names {
+		values = append(values, [2]string{name, headers[name]})
+	}
+
+	return values
+}
+
+func addHeader(name string, value string) nginx.Directive {
+	return nginx.NewDirective("add_header", name, `"`+strings.ReplaceAll(value, `"`, `\"`)+`"`, "always")
+}
+
+// Nginx inherits "add_header" directives from the enclosing level only if the current level defines none. This repeats
+// the given headers in every nested block that defines its own "add_header", such as the "if" blocks adding CORS
+// headers
+func withHeaders(directives []nginx.Directive, headers []nginx.Directive) []nginx.Directive {
+	if directives == nil {
+		return nil
+	}
+
+	result := make([]nginx.Directive, 0, len(directives))
+	for _, directive := range directives {
+		if directive.Block != nil {
+			block := withHeaders(directive.Block, headers)
+			if definesHeaders(directive.Block) {
+				block = append(append([]nginx.Directive{}, headers...), block...)
+			}
+			directive.Block = block
+		}
+		result = append(result, directive)
+	}
+
+	return result
+}
+
+func definesHeaders(directives []nginx.Directive) bool {
+	for _, directive := range directives {
+		if directive.Name == "add_header" {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies an access rule to a server if the rule has no path, or to the location of the server with the path of the
+// rule otherwise. Client certificates are requested by the whole server in the latter case but only enforced by the
+// location, because Nginx verifies them during the TLS handshake, i.e. before the location is known
+func applyAccessRule(domain string, i int, rule AccessRule, server nginx.Server) (nginx.Server, bool) {
+	matched := false
+	if rule.Path == "" {
+		server.Directives = append(accessDirectives(domain, i, rule), server.Directives...)
+		matched = true
+	}
+
+	locations := make([]nginx.Location, 0, len(server.Locations))
+	for _, location := range server.Locations {
+		if rule.Path == location.Path {
+			directives := accessDirectives(domain, i, rule)
+			if rule.ClientCert {
+				directives = append(
+					directives,
+					nginx.NewBlock("if", []string{"($ssl_client_verify != SUCCESS)"}, nginx.NewDirective("return", "403")),
+				)
+			}
+			location.Directives = append(directives, location.Directives...)
+			matched = true
+		}
+		if rule.ClientSubjectHeader != "" && (rule.Path == "" || rule.Path == location.Path) {
+			location.Directives = append(location.Directives, nginx.NewDirective("proxy_set_header", rule.ClientSubjectHeader, "$ssl_client_s_dn"))
+		}
+		locations = append(locations, location)
+	}
+	server.Locations = locations
+
+	if matched && rule.ClientCert {
+		tls := *server.TLS
+		tls.ClientCertificate = ClientCaDst(domain)
+		if rule.Path == "" || tls.VerifyClient == "on" {
+			tls.VerifyClient = "on"
+		} else {
+			tls.VerifyClient = "optional"
+		}
+		server.TLS = &tls
+	}
+
+	return server, matched
+}
+
+func (r AccessRule) appliesTo(domain string) bool {
+	return r.Domain == "" || r.Domain == domain
+}
+
+func listensOn(server nginx.Server, port string) bool {
+	if port == "" {
+		return true
+	}
+	for _, listen := range server.Listens {
+		if listen.Port == port {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the "allow"/"deny" and "auth_basic" directives of an access rule. When both are configured, a client must be
+// allowed by address and authenticate
+func accessDirectives(domain string, i int, rule AccessRule) []nginx.Directive {
+	var directives []nginx.Directive
+	for _, address := range rule.Allow {
+		directives = append(directives, nginx.NewDirective("allow", address))
+	}
+	if len(rule.Allow) > 0 {
+		directives = append(directives, nginx.NewDirective("deny", "all"))
+	}
+
+	if len(rule.BasicAuthUsers) > 0 {
+		directives = append(
+			directives,
+			nginx.NewDirective("auth_basic", `"Restricted"`),
+			nginx.NewDirective("auth_basic_user_file", htpasswdDst(domain, i)),
+		)
+	}
+
+	return directives
+}
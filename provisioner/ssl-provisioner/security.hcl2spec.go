@@ -0,0 +1,43 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package ssl
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatAccessRule is an auto-generated flat version of AccessRule.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatAccessRule struct {
+	Domain              *string           `mapstructure:"domain" required:"false" cty:"domain" hcl:"domain"`
+	Port                *string           `mapstructure:"port" required:"false" cty:"port" hcl:"port"`
+	Path                *string           `mapstructure:"path" required:"false" cty:"path" hcl:"path"`
+	Allow               []string          `mapstructure:"allow" required:"false" cty:"allow" hcl:"allow"`
+	BasicAuthUsers      map[string]string `mapstructure:"basicAuthUsers" required:"false" cty:"basicAuthUsers" hcl:"basicAuthUsers"`
+	ClientCert          *bool             `mapstructure:"clientCert" required:"false" cty:"clientCert" hcl:"clientCert"`
+	ClientSubjectHeader *string           `mapstructure:"clientSubjectHeader" required:"false" cty:"clientSubjectHeader" hcl:"clientSubjectHeader"`
+}
+
+// FlatMapstructure returns a new FlatAccessRule.
+// FlatAccessRule is an auto-generated flat version of AccessRule.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*AccessRule) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatAccessRule)
+}
+
+// HCL2Spec returns the hcl spec of a AccessRule.
+// This spec is used by HCL to read the fields of AccessRule.
+// The decoded values from this spec will then be applied to a FlatAccessRule.
+func (*FlatAccessRule) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"domain":              &hcldec.AttrSpec{Name: "domain", Type: cty.String, Required: false},
+		"port":                &hcldec.AttrSpec{Name: "port", Type: cty.String, Required: false},
+		"path":                &hcldec.AttrSpec{Name: "path", Type: cty.String, Required: false},
+		"allow":               &hcldec.AttrSpec{Name: "allow", Type: cty.List(cty.String), Required: false},
+		"basicAuthUsers":      &hcldec.AttrSpec{Name: "basicAuthUsers", Type: cty.Map(cty.String), Required: false},
+		"clientCert":          &hcldec.AttrSpec{Name: "clientCert", Type: cty.Bool, Required: false},
+		"clientSubjectHeader": &hcldec.AttrSpec{Name: "clientSubjectHeader", Type: cty.String, Required: false},
+	}
+	return s
+}
@@ -0,0 +1,284 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	"encoding/base64"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+var testClientCaBase64 = base64.StdEncoding.EncodeToString([]byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"))
+
+func securityTestConfig() nginx.Config {
+	return nginx.Config{
+		Servers: []nginx.Server{
+			{
+				Listens:     nginx.SslListens("443"),
+				ServerNames: []string{"api.mycompany.com"},
+				TLS:         &nginx.TLS{Certificate: "/etc/ssl/certs/api.crt", CertificateKey: "/etc/ssl/private/api.key", HSTS: "max-age=63072000"},
+				Locations: []nginx.Location{
+					{
+						Path: "/",
+						Directives: []nginx.Directive{
+							nginx.NewBlock("if", []string{"($request_method = 'GET')"}, nginx.NewDirective("add_header", "'Access-Control-Allow-Origin'", "'*'")),
+						},
+						ProxyPass: "http://localhost:8000",
+					},
+				},
+			},
+			{
+				Listens:     nginx.SslListens("8444"),
+				ServerNames: []string{"api.mycompany.com"},
+				TLS:         &nginx.TLS{Certificate: "/etc/ssl/certs/api.crt", CertificateKey: "/etc/ssl/private/api.key"},
+				Locations:   []nginx.Location{{Path: "/", ProxyPass: "http://localhost:8001"}},
+			},
+			nginx.RedirectServer("api.mycompany.com"),
+		},
+	}
+}
+
+func Test_applySecurity(t *testing.T) {
+	config := Config{
+		SecurityHeaders: map[string]string{"Content-Security-Policy": "default-src 'self'", "X-Frame-Options": "DENY", "Referrer-Policy": ""},
+		RateLimit:       "10r/s",
+		AccessRules: []AccessRule{
+			{Port: "8444", Path: "/", Allow: []string{"10.0.0.0/8"}, BasicAuthUsers: map[string]string{"admin": "secret"}},
+		},
+	}
+
+	actual, err := config.applySecurity("api.mycompany.com", securityTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `limit_req_zone $binary_remote_addr zone=api.mycompany.com:10m rate=10r/s;
+
+server {
+    listen 443 ssl;
+    listen [::]:443 ssl;
+    server_name api.mycompany.com;
+    ssl_certificate /etc/ssl/certs/api.crt;
+    ssl_certificate_key /etc/ssl/private/api.key;
+    add_header Strict-Transport-Security "max-age=63072000" always;
+    limit_req zone=api.mycompany.com burst=20 nodelay;
+    limit_req_status 429;
+    add_header Content-Security-Policy "default-src 'self'" always;
+    add_header X-Content-Type-Options "nosniff" always;
+    add_header X-Frame-Options "DENY" always;
+    location / {
+        if ($request_method = 'GET') {
+            add_header Content-Security-Policy "default-src 'self'" always;
+            add_header X-Content-Type-Options "nosniff" always;
+            add_header X-Frame-Options "DENY" always;
+            add_header Strict-Transport-Security "max-age=63072000" always;
+            add_header 'Access-Control-Allow-Origin' '*';
+        }
+        proxy_pass http://localhost:8000;
+    }
+}
+
+server {
+    listen 8444 ssl;
+    listen [::]:8444 ssl;
+    server_name api.mycompany.com;
+    ssl_certificate /etc/ssl/certs/api.crt;
+    ssl_certificate_key /etc/ssl/private/api.key;
+    limit_req zone=api.mycompany.com burst=20 nodelay;
+    limit_req_status 429;
+    add_header Content-Security-Policy "default-src 'self'" always;
+    add_header X-Content-Type-Options "nosniff" always;
+    add_header X-Frame-Options "DENY" always;
+    location / {
+        allow 10.0.0.0/8;
+        deny all;
+        auth_basic "Restricted";
+        auth_basic_user_file /etc/nginx/htpasswd/api.mycompany.com.0;
+        proxy_pass http://localhost:8001;
+    }
+}
+
+server {
+    listen 80;
+    listen [::]:80;
+    server_name api.mycompany.com;
+    if ($host = api.mycompany.com) {
+        return 301 https://$host$request_uri;
+    }
+    return 404;
+}
+`
+	if actual.Render() != expected {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expected, actual.Render())
+	}
+}
+
+func Test_applySecurityDefaults(t *testing.T) {
+	actual, err := Config{}.applySecurity("api.mycompany.com", securityTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered := actual.Render()
+	for _, header := range []string{
+		`add_header Referrer-Policy "strict-origin-when-cross-origin" always;`,
+		`add_header X-Content-Type-Options "nosniff" always;`,
+		`add_header X-Frame-Options "SAMEORIGIN" always;`,
+	} {
+		if !strings.Contains(rendered, header) {
+			t.Errorf("Expected default header %q in %s", header, rendered)
+		}
+	}
+	if strings.Contains(rendered, "limit_req") || strings.Contains(rendered, "auth_basic") {
+		t.Errorf("Rate limit and access control should be off by default: %s", rendered)
+	}
+}
+
+func Test_applySecurityUnmatchedAccessRule(t *testing.T) {
+	config := Config{AccessRules: []AccessRule{{Port: "8445", Path: "/", Allow: []string{"10.0.0.0/8"}}}}
+
+	_, err := config.applySecurity("api.mycompany.com", securityTestConfig())
+	if err == nil || !strings.Contains(err.Error(), "accessRule #1 matches no SSL-enabled location '/' on port '8445'") {
+		t.Errorf("Expected an error on unmatched access rule, got %v", err)
+	}
+}
+
+func Test_applySecurityAccessRuleOfOtherDomain(t *testing.T) {
+	config := Config{AccessRules: []AccessRule{{Domain: "app.mycompany.com", Port: "8445", Allow: []string{"10.0.0.0/8"}}}}
+
+	actual, err := config.applySecurity("api.mycompany.com", securityTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(actual.Render(), "allow") {
+		t.Errorf("Access rule of another domain should not be applied: %s", actual.Render())
+	}
+}
+
+func Test_applySecurityClientCert(t *testing.T) {
+	config := Config{
+		ClientCaBase64: testClientCaBase64,
+		AccessRules: []AccessRule{
+			{Port: "443", Path: "/", ClientCert: true, ClientSubjectHeader: "X-Client-Subject"},
+			{Port: "8444", ClientCert: true},
+		},
+		SecurityHeaders: map[string]string{"X-Frame-Options": "", "X-Content-Type-Options": "", "Referrer-Policy": ""},
+	}
+
+	actual, err := config.applySecurity("api.mycompany.com", securityTestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `server {
+    listen 443 ssl;
+    listen [::]:443 ssl;
+    server_name api.mycompany.com;
+    ssl_certificate /etc/ssl/certs/api.crt;
+    ssl_certificate_key /etc/ssl/private/api.key;
+    ssl_client_certificate /etc/ssl/certs/api.mycompany.com-client-ca.crt;
+    ssl_verify_client optional;
+    add_header Strict-Transport-Security "max-age=63072000" always;
+    location / {
+        if ($ssl_client_verify != SUCCESS) {
+            return 403;
+        }
+        if ($request_method = 'GET') {
+            add_header Strict-Transport-Security "max-age=63072000" always;
+            add_header 'Access-Control-Allow-Origin' '*';
+        }
+        proxy_set_header X-Client-Subject $ssl_client_s_dn;
+        proxy_pass http://localhost:8000;
+    }
+}
+
+server {
+    listen 8444 ssl;
+    listen [::]:8444 ssl;
+    server_name api.mycompany.com;
+    ssl_certificate /etc/ssl/certs/api.crt;
+    ssl_certificate_key /etc/ssl/private/api.key;
+    ssl_client_certificate /etc/ssl/certs/api.mycompany.com-client-ca.crt;
+    ssl_verify_client on;
+    location / {
+        proxy_pass http://localhost:8001;
+    }
+}
+`
+	if rendered := (nginx.Config{Servers: actual.Servers[:2]}).Render(); rendered != expected {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expected, rendered)
+	}
+}
+
+func Test_clientCaFiles(t *testing.T) {
+	files, err := Config{ClientCaBase64: testClientCaBase64}.clientCaFiles("api.mycompany.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].destination != "/etc/ssl/certs/api.mycompany.com-client-ca.crt" || !strings.HasPrefix(files[0].content, "-----BEGIN CERTIFICATE-----") {
+		t.Errorf("Expected the decoded client CA bundle, got %v", files)
+	}
+}
+
+func Test_htpasswdFiles(t *testing.T) {
+	config := Config{
+		AccessRules: []AccessRule{
+			{Path: "/", Allow: []string{"10.0.0.0/8"}},
+			{Path: "/admin", BasicAuthUsers: map[string]string{"bob": "secret2", "alice": "secret1"}},
+		},
+	}
+
+	files, err := config.htpasswdFiles("api.mycompany.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].destination != "/etc/nginx/htpasswd/api.mycompany.com.1" || files[0].mode != "640" {
+		t.Fatalf("Expected one htpasswd file of the second rule, got %v", files)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(files[0].content, "\n"), "\n")
+	for i, user := range []struct{ name, password string }{{"alice", "secret1"}, {"bob", "secret2"}} {
+		name, hash, _ := strings.Cut(lines[i], ":")
+		if name != user.name {
+			t.Errorf("Expected user '%s' on line %d, got '%s'", user.name, i+1, name)
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(user.password)); err != nil {
+			t.Errorf("Password of '%s' is not hashed correctly: %s", user.name, err)
+		}
+	}
+}
+
+func TestValidateSecurity(t *testing.T) {
+	data := []struct {
+		name   string
+		config Config
+		error  string
+	}{
+		{"valid", Config{RateLimit: "300r/m", AccessRules: []AccessRule{{Path: "/", Allow: []string{"10.0.0.0/8"}}}}, ""},
+		{"invalid rate limit", Config{RateLimit: "10/s"}, "invalid rateLimit '10/s'"},
+		{"rule without path", Config{AccessRules: []AccessRule{{Allow: []string{"10.0.0.0/8"}}}}, ""},
+		{"rule without restriction", Config{AccessRules: []AccessRule{{Path: "/"}}}, "needs at least one of 'allow', 'basicAuthUsers', and 'clientCert'"},
+		{"client cert", Config{ClientCaBase64: testClientCaBase64, AccessRules: []AccessRule{{ClientCert: true, ClientSubjectHeader: "X-Client-Subject"}}}, ""},
+		{"client cert without CA", Config{AccessRules: []AccessRule{{ClientCert: true}}}, "no clientCaBase64 is configured"},
+		{"subject header without client cert", Config{ClientCaBase64: testClientCaBase64, AccessRules: []AccessRule{{Allow: []string{"10.0.0.0/8"}, ClientSubjectHeader: "X-Client-Subject"}}}, "does not require client certificates"},
+		{"invalid client CA", Config{ClientCaBase64: base64.StdEncoding.EncodeToString([]byte("not a certificate"))}, "not a PEM encoded certificate bundle"},
+		{"rule with template", Config{NginxTemplate: "nginx.conf.tmpl", AccessRules: []AccessRule{{Path: "/", Allow: []string{"10.0.0.0/8"}}}}, "cannot be used together with nginxTemplate"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			err := d.config.Validate()
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
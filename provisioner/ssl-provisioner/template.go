@@ -0,0 +1,164 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// NginxTemplateData is the data model that a custom Nginx template, given by "nginxTemplate", is rendered with. For
+// example
+//
+//	server {
+//	    listen 443 ssl;
+//	    server_name {{.Domain}};
+//	    ssl_certificate {{.SslCertDst}};
+//	    ssl_certificate_key {{.SslCertKeyDst}};
+//	    client_max_body_size {{.Vars.maxBodySize}};
+//
+//	    location / {
+//	        proxy_pass http://localhost:{{.Port}};
+//	    }
+//	}
+type NginxTemplateData struct {
+	// Domain is the SSL-enabled domain of the provisioner, e.g. "appDomain" of the React provisioner
+	Domain string
+
+	// SslCertDst is the location of the SSL certificate of the Domain in remote machine
+	SslCertDst string
+
+	// SslCertKeyDst is the location of the SSL certificate key of the Domain in remote machine
+	SslCertKeyDst string
+
+	// DhParamDst is the location of the Diffie-Hellman parameters in remote machine
+	DhParamDst string
+
+	// Port is the local HTTP port of the app that Nginx proxies to
+	Port string
+
+	// Vars are the user variables given by "nginxTemplateVars"
+	Vars map[string]string
+}
+
+// NginxConfig returns the Nginx config of a domain, which is either the rendering of the custom template given by
+// "nginxTemplate", or the built-in config of the provisioner if no custom template is configured.
+//
+// Provisioners call this in their Prepare() as well, so that a broken template, a template defining a default server, an
+// access rule matching no location of the built-in config, or a built-in config that the configured proxy backend cannot
+// serve fails the build before any machine is launched
+func (c Config) NginxConfig(domain string, port string, builtIn nginx.Config) (nginx.Config, error) {
+	if c.NginxTemplate == "" {
+		var err error
+		switch c.proxyBackend() {
+		case CaddyBackend:
+			_, err = c.caddySite(domain, builtIn)
+		case TraefikBackend:
+			_, _, err = c.traefikSite(domain, builtIn)
+		default:
+			_, err = c.apply(domain, builtIn)
+		}
+		if err != nil {
+			return nginx.Config{}, err
+		}
+		return builtIn, nil
+	}
+
+	content, err := os.ReadFile(c.NginxTemplate)
+	if err != nil {
+		return nginx.Config{}, fmt.Errorf("error reading nginxTemplate '%s': %s", c.NginxTemplate, err)
+	}
+
+	t, err := template.New(c.NginxTemplate).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nginx.Config{}, fmt.Errorf("error parsing nginxTemplate '%s': %s", c.NginxTemplate, err)
+	}
+
+	vars := c.NginxTemplateVars
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	data := NginxTemplateData{
+		Domain:        domain,
+		SslCertDst:    SslCertDst(domain),
+		SslCertKeyDst: SslCertKeyDst(domain),
+		DhParamDst:    DhParamDst,
+		Port:          port,
+		Vars:          vars,
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nginx.Config{}, fmt.Errorf("error rendering nginxTemplate '%s': %s", c.NginxTemplate, err)
+	}
+
+	directives, err := nginx.Parse(buf.String())
+	if err != nil {
+		return nginx.Config{}, fmt.Errorf("nginxTemplate '%s' is not a valid Nginx config: %s", c.NginxTemplate, err)
+	}
+
+	// The default server of the machine is the one of the default Nginx config, which all provisioners share
+	for _, directive := range directives {
+		if directive.Name != "server" {
+			continue
+		}
+		for _, listen := range directive.Block {
+			if listen.Name != "listen" {
+				continue
+			}
+			for _, arg := range listen.Args {
+				if arg == "default_server" || arg == "default" {
+					return nginx.Config{}, fmt.Errorf(
+						"nginxTemplate '%s' must not define a default_server: listen %s", c.NginxTemplate, strings.Join(listen.Args, " "),
+					)
+				}
+			}
+		}
+	}
+
+	return nginx.Config{Directives: directives}, nil
+}
+
+// Returns an error if the settings that are applied to the built-in Nginx config only are used together with
+// "nginxTemplate", which is rendered as is, so that they are not silently dropped
+func (c Config) validateTemplate() error {
+	if c.NginxTemplate == "" {
+		return nil
+	}
+
+	var settings []string
+	for setting, used := range map[string]bool{
+		"tlsProfile":          c.TlsProfile != "",
+		"hstsPreload":         c.HstsPreload,
+		"ocspStapling":        c.OcspStapling != nil,
+		"resolver":            c.Resolver != "",
+		"proxyConnectTimeout": c.ProxyConnectTimeout != "",
+		"proxySendTimeout":    c.ProxySendTimeout != "",
+		"proxyReadTimeout":    c.ProxyReadTimeout != "",
+		"proxyBuffering":      c.ProxyBuffering != nil,
+		"proxyWebSocket":      c.ProxyWebSocket != nil,
+		"clientMaxBodySize":   c.ClientMaxBodySize != "",
+		"securityHeaders":     c.SecurityHeaders != nil,
+		"rateLimit":           c.RateLimit != "",
+		"rateLimitBurst":      c.RateLimitBurst != "",
+		"accessRule":          len(c.AccessRules) > 0,
+	} {
+		if used {
+			settings = append(settings, setting)
+		}
+	}
+	sort.Strings(settings)
+
+	if len(settings) > 0 {
+		return fmt.Errorf(
+			"%s cannot be used together with nginxTemplate; put them into the template instead", strings.Join(settings, ", "),
+		)
+	}
+	return nil
+}
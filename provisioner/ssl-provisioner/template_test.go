@@ -0,0 +1,123 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "nginx.conf.tmpl")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNginxConfigWithoutTemplate(t *testing.T) {
+	builtIn := nginx.Config{Servers: []nginx.Server{nginx.RedirectServer("app.mycompany.com")}}
+
+	actual, err := Config{}.NginxConfig("app.mycompany.com", "3000", builtIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(builtIn, actual) {
+		t.Errorf("Expected the built-in config when no template is configured, got %v", actual)
+	}
+}
+
+func TestNginxConfigWithTemplate(t *testing.T) {
+	config := Config{
+		NginxTemplate: writeTemplate(t, `server {
+    listen 443 ssl;
+    server_name {{.Domain}};
+    ssl_certificate {{.SslCertDst}};
+    ssl_certificate_key {{.SslCertKeyDst}};
+    client_max_body_size {{.Vars.maxBodySize}};
+    location / {
+        proxy_pass http://localhost:{{.Port}};
+    }
+}
+`),
+		NginxTemplateVars: map[string]string{"maxBodySize": "1G"},
+	}
+
+	actual, err := config.NginxConfig("nexus.mycompany.com", "8081", nginx.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `server {
+    listen 443 ssl;
+    server_name nexus.mycompany.com;
+    ssl_certificate /etc/ssl/certs/nexus.mycompany.com.crt;
+    ssl_certificate_key /etc/ssl/private/nexus.mycompany.com.key;
+    client_max_body_size 1G;
+    location / {
+        proxy_pass http://localhost:8081;
+    }
+}
+`
+	if actual.Render() != expected {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expected, actual.Render())
+	}
+}
+
+func TestNginxConfigWithInvalidTemplate(t *testing.T) {
+	data := []struct {
+		name     string
+		template string
+		error    string
+	}{
+		{"undefined variable", "client_max_body_size {{.Vars.maxBodySize}};", "error rendering nginxTemplate"},
+		{"template syntax error", "server_name {{.Domain;", "error parsing nginxTemplate"},
+		{"Nginx syntax error", "server {\n    server_name {{.Domain}}\n}", "is not a valid Nginx config"},
+		{"default server", "server {\n    listen 443 ssl default_server;\n    server_name {{.Domain}};\n}", "must not define a default_server: listen 443 ssl default_server"},
+		{"legacy default server", "server {\n    listen [::]:80 default;\n}", "must not define a default_server"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			_, err := Config{NginxTemplate: writeTemplate(t, d.template)}.NginxConfig("app.mycompany.com", "3000", nginx.Config{})
+			if err == nil || !strings.Contains(err.Error(), d.error) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	enabled := true
+
+	data := []struct {
+		name   string
+		config Config
+		error  string
+	}{
+		{"template only", Config{NginxTemplate: "nginx.conf.tmpl", NginxTemplateVars: map[string]string{"maxBodySize": "1G"}}, ""},
+		{"built-in config", Config{TlsProfile: ModernTlsProfile, HstsPreload: true, SecurityHeaders: map[string]string{}}, ""},
+		{"TLS profile", Config{NginxTemplate: "nginx.conf.tmpl", TlsProfile: ModernTlsProfile, HstsPreload: true}, "hstsPreload, tlsProfile cannot be used together with nginxTemplate"},
+		{"stapling", Config{NginxTemplate: "nginx.conf.tmpl", OcspStapling: &enabled, Resolver: "1.1.1.1"}, "ocspStapling, resolver cannot"},
+		{"proxy settings", Config{NginxTemplate: "nginx.conf.tmpl", ProxyReadTimeout: "300s", ProxyWebSocket: &enabled, ClientMaxBodySize: "0"}, "clientMaxBodySize, proxyReadTimeout, proxyWebSocket cannot"},
+		{"security headers", Config{NginxTemplate: "nginx.conf.tmpl", SecurityHeaders: map[string]string{}}, "securityHeaders cannot"},
+		{"rate limit", Config{NginxTemplate: "nginx.conf.tmpl", RateLimit: "10r/s", RateLimitBurst: "5"}, "rateLimit, rateLimitBurst cannot"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			err := d.config.Validate()
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"strings"
+)
+
+// TLS profiles following Mozilla's server side TLS guidelines - https://wiki.mozilla.org/Security/Server_Side_TLS
+const (
+	ModernTlsProfile       string = "modern"
+	IntermediateTlsProfile string = "intermediate"
+	LegacyTlsProfile       string = "legacy"
+)
+
+// DefaultTlsProfile is the profile used when none is configured. It is recommended by Mozilla for general-purpose
+// servers
+const DefaultTlsProfile string = IntermediateTlsProfile
+
+// DhParamDst is where the Diffie-Hellman parameters used by the DHE cipher suites are placed in remote machine
+const DhParamDst string = "/etc/nginx/dhparam.pem"
+
+// The Nginx config setting the nameservers of the machine as the resolver of all servers, which OCSP stapling uses to look
+// up the OCSP responder unless "resolver" is configured
+const nginxSystemResolverDst string = "/etc/nginx/conf.d/system-resolver.conf"
+
+const hstsMaxAge string = "max-age=63072000"
+const hstsPreload string = "; includeSubDomains; preload"
+
+// The pre-defined ffdhe2048 group of RFC 7919, which is what Mozilla recommends over generating custom parameters
+const ffdhe2048 string = `-----BEGIN DH PARAMETERS-----
+MIIBCAKCAQEA//////////+t+FRYortKmq/cViAnPTzx2LnFg84tNpWp4TZBFGQz
++8yTnc4kmz75fS/jY2MMddj2gbICrsRhetPfHtXV/WVhJDP1H18GbtCFY2VVPe0a
+87VXE15/V8k1mE8McODmi3fipona8+/och3xWKE2rec1MKzKT0g6eXq8CrGCsyT7
+YdEIqUuyyOP7uWrat2DX9GgdT0Kj3jlN9K5W7edjcrsZCwenyO4KbXCeAvzhzffi
+7MA0BM0oNC9hkXL+nOmFg/+OTxIy7vKBg8P+OxtMb61zO7X8vC7CIAXFjvGDfRaD
+ssbzSibBsu/6iGtCOGEoXJf//////////wIBAg==
+-----END DH PARAMETERS-----
+`
+
+type tlsProfile struct {
+	protocols           []string
+	ecdhCurve           string
+	ciphers             string
+	preferServerCiphers string
+	dhParam             bool
+}
+
+var tlsProfiles = map[string]tlsProfile{
+	ModernTlsProfile: {
+		protocols:           []string{"TLSv1.3"},
+		ecdhCurve:           "X25519:prime256v1:secp384r1",
+		preferServerCiphers: "off",
+	},
+	IntermediateTlsProfile: {
+		protocols: []string{"TLSv1.2", "TLSv1.3"},
+		ecdhCurve: "X25519:prime256v1:secp384r1",
+		ciphers: "ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES256-GCM-SHA384:" +
+			"ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-CHACHA20-POLY1305:ECDHE-RSA-CHACHA20-POLY1305:" +
+			"DHE-RSA-AES128-GCM-SHA256:DHE-RSA-AES256-GCM-SHA384:DHE-RSA-CHACHA20-POLY1305",
+		preferServerCiphers: "off",
+		dhParam:             true,
+	},
+	LegacyTlsProfile: {
+		protocols: []string{"TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3"},
+		ciphers: "ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES256-GCM-SHA384:" +
+			"ECDHE-RSA-AES256-GCM-SHA384:ECDHE-ECDSA-CHACHA20-POLY1305:ECDHE-RSA-CHACHA20-POLY1305:" +
+			"DHE-RSA-AES128-GCM-SHA256:DHE-RSA-AES256-GCM-SHA384:DHE-RSA-CHACHA20-POLY1305:" +
+			"ECDHE-ECDSA-AES128-SHA256:ECDHE-RSA-AES128-SHA256:ECDHE-ECDSA-AES128-SHA:ECDHE-RSA-AES128-SHA:" +
+			"ECDHE-ECDSA-AES256-SHA384:ECDHE-RSA-AES256-SHA384:ECDHE-ECDSA-AES256-SHA:ECDHE-RSA-AES256-SHA:" +
+			"DHE-RSA-AES128-SHA256:DHE-RSA-AES256-SHA256:AES128-GCM-SHA256:AES256-GCM-SHA384:AES128-SHA256:" +
+			"AES256-SHA256:AES128-SHA:AES256-SHA:DES-CBC3-SHA:@SECLEVEL=0",
+		preferServerCiphers: "on",
+		dhParam:             true,
+	},
+}
+
+// Validate returns an error if the configured TLS profile is not one of the supported profiles, the security settings
+// are invalid, the settings of the built-in Nginx config are used with a custom template, or the configured proxy
+// backend does not support them
+func (c Config) Validate() error {
+	if _, ok := tlsProfiles[c.tlsProfileName()]; !ok {
+		return fmt.Errorf(
+			"unknown tlsProfile '%s'; supported profiles are '%s', '%s', and '%s'",
+			c.TlsProfile,
+			ModernTlsProfile,
+			IntermediateTlsProfile,
+			LegacyTlsProfile,
+		)
+	}
+
+	if c.Resolver != "" {
+		if !c.ocspStapling() {
+			return fmt.Errorf("resolver requires ocspStapling")
+		}
+		if strings.TrimSpace(c.Resolver) == "" || strings.ContainsAny(c.Resolver, ";{}\"'\n") {
+			return fmt.Errorf("invalid resolver '%s'", c.Resolver)
+		}
+	}
+
+	if err := c.validateSecurity(); err != nil {
+		return err
+	}
+
+	if err := c.validateTemplate(); err != nil {
+		return err
+	}
+
+	return c.validateBackend()
+}
+
+func (c Config) tlsProfileName() string {
+	if c.TlsProfile == "" {
+		return DefaultTlsProfile
+	}
+	return c.TlsProfile
+}
+
+// Returns whether or not OCSP stapling is enabled, which it is by default. Certificates of internal or self-signed CAs
+// have no OCSP responder to staple from, so Nginx logs an error on every handshake unless stapling is turned off
+func (c Config) ocspStapling() bool {
+	return c.OcspStapling == nil || *c.OcspStapling
+}
+
+// Returns the value of the "Strict-Transport-Security" response header
+func (c Config) hsts() string {
+	if c.HstsPreload {
+		return hstsMaxAge + hstsPreload
+	}
+	return hstsMaxAge
+}
+
+// Applies the configured TLS profile to every SSL-enabled server of an Nginx config, which includes protocol and
+// cipher settings, session settings, OCSP stapling, HSTS and HTTP/2. Stapling uses the configured resolver, or the
+// nameservers of the machine, which getSystemResolverCommand() sets for all servers, otherwise
+func (c Config) applyTlsProfile(nginxConfig nginx.Config) nginx.Config {
+	profile := tlsProfiles[c.tlsProfileName()]
+
+	servers := make([]nginx.Server, 0, len(nginxConfig.Servers))
+	for _, server := range nginxConfig.Servers {
+		if server.TLS != nil {
+			tls := *server.TLS
+			tls.Protocols = profile.protocols
+			tls.ECDHCurve = profile.ecdhCurve
+			tls.Ciphers = profile.ciphers
+			tls.PreferServerCiphers = profile.preferServerCiphers
+			if profile.dhParam {
+				tls.DHParam = DhParamDst
+			}
+			tls.SessionTimeout = "1d"
+			tls.SessionCache = "shared:SSL:10m"
+			tls.SessionTickets = "off"
+			tls.Stapling = c.ocspStapling()
+			if tls.Stapling {
+				tls.Resolver = c.Resolver
+			}
+			tls.HSTS = c.hsts()
+			server.TLS = &tls
+
+			listens := make([]nginx.Listen, 0, len(server.Listens))
+			for _, listen := range server.Listens {
+				listen.HTTP2 = listen.SSL
+				listens = append(listens, listen)
+			}
+			server.Listens = listens
+		}
+
+		servers = append(servers, server)
+	}
+	nginxConfig.Servers = servers
+
+	return nginxConfig
+}
+
+// Returns the command writing the nameservers of /etc/resolv.conf, e.g. 127.0.0.53 of systemd-resolved, into
+// nginxSystemResolverDst. IPv6 addresses are put in brackets, as Nginx requires, and link-local ones are left out, since
+// Nginx cannot resolve through them. Nothing is written if the machine has no usable nameserver
+func getSystemResolverCommand() string {
+	return fmt.Sprintf(
+		`NAMESERVERS=$(awk '$1 == "nameserver" && $2 !~ /%%/ { print ($2 ~ /:/ ? "[" $2 "]" : $2) }' /etc/resolv.conf | xargs); if [ -n "$NAMESERVERS" ]; then echo "resolver $NAMESERVERS;" | sudo tee %s > /dev/null; fi`,
+		nginxSystemResolverDst,
+	)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	_ "embed"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"strings"
+	"testing"
+)
+
+//go:embed test-fixtures/intermediate.conf
+var expectedIntermediateConfig string
+
+func TestValidate(t *testing.T) {
+	stapling := false
+
+	data := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{"default profile", Config{}, true},
+		{"modern profile", Config{TlsProfile: ModernTlsProfile}, true},
+		{"legacy profile", Config{TlsProfile: LegacyTlsProfile}, true},
+		{"unknown profile", Config{TlsProfile: "paranoid"}, false},
+		{"resolver", Config{Resolver: "1.1.1.1 [2606:4700:4700::1111] valid=300s"}, true},
+		{"invalid resolver", Config{Resolver: "1.1.1.1; ssl_stapling off"}, false},
+		{"resolver without stapling", Config{Resolver: "1.1.1.1", OcspStapling: &stapling}, false},
+		{"without stapling", Config{OcspStapling: &stapling}, true},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			err := d.config.Validate()
+			if (err == nil) != d.valid {
+				t.Errorf("Expected valid to be %t, got error: %v", d.valid, err)
+			}
+		})
+	}
+}
+
+func Test_applyTlsProfile(t *testing.T) {
+	tls := NginxTls("app.mycompany.com")
+	nginxConfig := nginx.Config{
+		Servers: []nginx.Server{
+			{
+				Listens:     nginx.SslListens("443"),
+				ServerNames: []string{"app.mycompany.com"},
+				TLS:         tls,
+				Locations:   []nginx.Location{{Path: "/", ProxyPass: "http://localhost:3000"}},
+			},
+			nginx.RedirectServer("app.mycompany.com"),
+		},
+	}
+
+	actual := Config{HstsPreload: true}.applyTlsProfile(nginxConfig).Render()
+	if actual != expectedIntermediateConfig {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expectedIntermediateConfig, actual)
+	}
+
+	if tls.Protocols != nil || nginxConfig.Servers[0].Listens[0].HTTP2 {
+		t.Errorf("Applying a TLS profile should not modify the original Nginx config")
+	}
+}
+
+func Test_applyTlsProfileStapling(t *testing.T) {
+	nginxConfig := nginx.Config{
+		Servers: []nginx.Server{{Listens: nginx.SslListens("443"), ServerNames: []string{"app.mycompany.com"}, TLS: NginxTls("app.mycompany.com")}},
+	}
+
+	stapling := false
+	withoutStapling := Config{OcspStapling: &stapling, Resolver: ""}.applyTlsProfile(nginxConfig).Render()
+	if strings.Contains(withoutStapling, "ssl_stapling") || strings.Contains(withoutStapling, "resolver") {
+		t.Errorf("Expected neither stapling nor resolver with ocspStapling turned off: %s", withoutStapling)
+	}
+
+	withResolver := Config{Resolver: "1.1.1.1 8.8.8.8"}.applyTlsProfile(nginxConfig).Render()
+	if !strings.Contains(withResolver, "    ssl_stapling on;\n    ssl_stapling_verify on;\n    resolver 1.1.1.1 8.8.8.8;\n") {
+		t.Errorf("Expected stapling with the configured resolver: %s", withResolver)
+	}
+}
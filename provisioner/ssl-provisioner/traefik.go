@@ -0,0 +1,347 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package ssl
+
+import (
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// TraefikVersion is the Traefik release installed by the "traefik" proxy backend
+const TraefikVersion string = "3.1.2"
+
+const traefikConfigDst string = "/etc/traefik/traefik.yml"
+const traefikStaticConfigDst string = "/etc/traefik/traefik.head.yml"
+const traefikDynamicDir string = "/etc/traefik/dynamic"
+const traefikBindingsDir string = "/etc/traefik/server-bindings"
+const traefikHtpasswdDir string = "/etc/traefik/htpasswd"
+const traefikUnitDst string = "/etc/systemd/system/traefik.service"
+const traefikWantsLink string = "/etc/systemd/system/multi-user.target.wants/traefik.service"
+const traefikStaticConfigFilename string = "traefik.head.yml"
+const traefikSiteFilename string = "traefik-ssl.yml"
+const traefikUnitFilename string = "traefik.service"
+
+// The dashboard API only listens on localhost; the build uses it to check that the routers of a site are enabled
+const traefikApiAddress string = "127.0.0.1:8099"
+
+// The static config of Traefik without the HTTPS entry points, which are appended at build time from the ports of all
+// sites, so that multiple provisioners can put their domains behind the same Traefik instance
+const traefikStaticConfig string = `api:
+  insecure: true
+providers:
+  file:
+    directory: ` + traefikDynamicDir + `
+    watch: true
+entryPoints:
+  traefik:
+    address: "` + traefikApiAddress + `"
+  web:
+    address: ":80"
+    http:
+      redirections:
+        entryPoint:
+          to: websecure-443
+          scheme: https
+`
+
+const traefikUnit string = `[Unit]
+Description=Traefik
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+User=traefik
+Group=traefik
+ExecStart=/usr/local/bin/traefik --configFile=` + traefikConfigDst + `
+AmbientCapabilities=CAP_NET_BIND_SERVICE
+CapabilityBoundingSet=CAP_NET_BIND_SERVICE
+NoNewPrivileges=true
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// Writes a YAML document with two-space indentation
+type yamlWriter struct {
+	builder strings.Builder
+}
+
+func (w *yamlWriter) line(depth int, format string, args ...interface{}) {
+	w.builder.WriteString(strings.Repeat("  ", depth) + fmt.Sprintf(format, args...) + "\n")
+}
+
+// Returns the files of the site of a domain served by Traefik, i.e. its certificate, its dynamic config, and the
+// "listen"/"server_name" pairs of its Nginx config, together with the shared static config and systemd unit. The names
+// of the routers of the site are returned as well
+func (c Config) traefikSiteFiles(domain string, sslCert string, sslCertKey string, nginxConfig nginx.Config) ([]siteFile, []string, error) {
+	site, routers, err := c.traefikSite(domain, nginxConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []siteFile{
+		{filename: traefikSiteFilename, destination: filepath.Join(traefikDynamicDir, domain+".yml"), content: site, mode: "640", group: "traefik"},
+		{filename: traefikStaticConfigFilename, destination: traefikStaticConfigDst, content: traefikStaticConfig},
+		{filename: traefikUnitFilename, destination: traefikUnitDst, content: traefikUnit},
+		{filename: nginxBindingsFilename, destination: filepath.Join(traefikBindingsDir, domain), content: strings.Join(nginxConfig.Bindings(), "\n") + "\n"},
+		{filename: sslCertFilename, destination: SslCertDst(domain), content: sslCert},
+		{filename: sslCertKeyFilename, destination: SslCertKeyDst(domain), content: sslCertKey, mode: "640", group: "ssl-cert"},
+	}, routers, nil
+}
+
+// Renders the Nginx config of a domain, with the settings of the SSL layer applied, into an equivalent dynamic config
+// of Traefik's file provider, with one router per location and one set of TLS options per listen port. The names of the
+// routers are returned as well
+func (c Config) traefikSite(domain string, nginxConfig nginx.Config) (string, []string, error) {
+	servers, err := c.proxyServers(domain, nginxConfig)
+	if err != nil {
+		return "", nil, err
+	}
+
+	prefix := strings.ReplaceAll(domain, ".", "-")
+	profile := tlsProfiles[c.tlsProfileName()]
+
+	var routers, services, transports, middlewares, options yamlWriter
+	var routerNames []string
+
+	middlewares.line(2, "%s-headers:", prefix)
+	middlewares.line(3, "headers:")
+	middlewares.line(4, "customResponseHeaders:")
+	for _, header := range append(c.securityHeaderValues(), [2]string{"Strict-Transport-Security", c.hsts()}) {
+		middlewares.line(5, "%s: %s", header[0], strconv.Quote(header[1]))
+	}
+	commonMiddlewares := []string{prefix + "-headers"}
+
+	if c.RateLimit != "" {
+		average, period, _ := strings.Cut(c.RateLimit, "r/")
+		middlewares.line(2, "%s-rate-limit:", prefix)
+		middlewares.line(3, "rateLimit:")
+		middlewares.line(4, "average: %s", average)
+		middlewares.line(4, "period: 1%s", period)
+		middlewares.line(4, "burst: %s", c.rateLimitBurst())
+		commonMiddlewares = append(commonMiddlewares, prefix+"-rate-limit")
+	}
+
+	for i, rule := range c.AccessRules {
+		if !rule.appliesTo(domain) {
+			continue
+		}
+		if len(rule.Allow) > 0 {
+			middlewares.line(2, "%s-allow-%d:", prefix, i)
+			middlewares.line(3, "ipAllowList:")
+			middlewares.line(4, "sourceRange:")
+			for _, address := range rule.Allow {
+				middlewares.line(5, "- %s", strconv.Quote(address))
+			}
+		}
+		if len(rule.BasicAuthUsers) > 0 {
+			middlewares.line(2, "%s-auth-%d:", prefix, i)
+			middlewares.line(3, "basicAuth:")
+			middlewares.line(4, "usersFile: %s", backendHtpasswdDst(traefikHtpasswdDir, domain, i))
+		}
+	}
+
+	for _, server := range servers {
+		name := fmt.Sprintf("%s-%s", prefix, server.port)
+
+		options.line(2, "%s:", name)
+		options.line(3, "minVersion: %s", traefikProtocol(profile.protocols[0]))
+		options.line(3, "maxVersion: %s", traefikProtocol(profile.protocols[len(profile.protocols)-1]))
+		if ciphers := goCipherSuites[c.tlsProfileName()]; len(ciphers) > 0 {
+			options.line(3, "cipherSuites:")
+			for _, cipher := range ciphers {
+				options.line(4, "- %s", cipher)
+			}
+		}
+		if server.clientCert {
+			options.line(3, "clientAuth:")
+			options.line(4, "caFiles:")
+			options.line(5, "- %s", ClientCaDst(domain))
+			options.line(4, "clientAuthType: RequireAndVerifyClientCert")
+		}
+
+		hosts := make([]string, 0, len(server.serverNames))
+		for _, serverName := range server.serverNames {
+			hosts = append(hosts, fmt.Sprintf("Host(`%s`)", serverName))
+		}
+		host := strings.Join(hosts, " || ")
+		if len(hosts) > 1 {
+			host = "(" + host + ")"
+		}
+
+		for j, route := range server.routes {
+			if route.upstreams == nil {
+				return "", nil, fmt.Errorf("location '%s' of '%s' serves static files, which the '%s' proxyBackend cannot serve", route.path, domain, TraefikBackend)
+			}
+
+			routerName := fmt.Sprintf("%s-%d", name, j)
+			routerNames = append(routerNames, routerName)
+
+			routeMiddlewares := append([]string{}, commonMiddlewares...)
+			for _, i := range route.accessRules {
+				if len(c.AccessRules[i].Allow) > 0 {
+					routeMiddlewares = append(routeMiddlewares, fmt.Sprintf("%s-allow-%d", prefix, i))
+				}
+				if len(c.AccessRules[i].BasicAuthUsers) > 0 {
+					routeMiddlewares = append(routeMiddlewares, fmt.Sprintf("%s-auth-%d", prefix, i))
+				}
+			}
+			if route.stripPath && route.path != "/" {
+				middlewares.line(2, "%s-strip:", routerName)
+				middlewares.line(3, "stripPrefix:")
+				middlewares.line(4, "prefixes:")
+				middlewares.line(5, "- %s", strconv.Quote(route.path))
+				routeMiddlewares = append(routeMiddlewares, routerName+"-strip")
+			}
+			if route.proxy.ClientMaxBodySize != "" {
+				size, err := byteSize(route.proxy.ClientMaxBodySize)
+				if err != nil {
+					return "", nil, fmt.Errorf("invalid clientMaxBodySize of location '%s' of '%s': %s", route.path, domain, err)
+				}
+				middlewares.line(2, "%s-body:", routerName)
+				middlewares.line(3, "buffering:")
+				middlewares.line(4, "maxRequestBodyBytes: %d", size)
+				routeMiddlewares = append(routeMiddlewares, routerName+"-body")
+			}
+
+			routers.line(2, "%s:", routerName)
+			routers.line(3, "entryPoints:")
+			routers.line(4, "- websecure-%s", server.port)
+			routers.line(3, "rule: %s", strconv.Quote(fmt.Sprintf("%s && PathPrefix(`%s`)", host, route.path)))
+			routers.line(3, "service: %s", routerName)
+			routers.line(3, "middlewares:")
+			for _, middleware := range routeMiddlewares {
+				routers.line(4, "- %s", middleware)
+			}
+			routers.line(3, "tls:")
+			routers.line(4, "options: %s", name)
+
+			services.line(2, "%s:", routerName)
+			services.line(3, "loadBalancer:")
+			services.line(4, "servers:")
+			for _, upstream := range route.upstreams {
+				services.line(5, "- url: %s", strconv.Quote("http://"+upstream))
+			}
+			if route.proxy.Buffering == "off" {
+				services.line(4, "responseForwarding:")
+				services.line(5, "flushInterval: \"-1\"")
+			}
+			if route.proxy.ConnectTimeout != "" || route.proxy.ReadTimeout != "" {
+				services.line(4, "serversTransport: %s", routerName)
+
+				transports.line(2, "%s:", routerName)
+				transports.line(3, "forwardingTimeouts:")
+				for _, timeout := range [][2]string{{"dialTimeout", route.proxy.ConnectTimeout}, {"responseHeaderTimeout", route.proxy.ReadTimeout}} {
+					if timeout[1] == "" {
+						continue
+					}
+					duration, err := goDuration(timeout[1])
+					if err != nil {
+						return "", nil, fmt.Errorf("invalid proxy timeout of location '%s' of '%s': %s", route.path, domain, err)
+					}
+					transports.line(4, "%s: %s", timeout[0], duration)
+				}
+			}
+		}
+	}
+
+	var site yamlWriter
+	site.line(0, "http:")
+	site.line(1, "routers:")
+	site.builder.WriteString(routers.builder.String())
+	site.line(1, "services:")
+	site.builder.WriteString(services.builder.String())
+	if transports.builder.Len() > 0 {
+		site.line(1, "serversTransports:")
+		site.builder.WriteString(transports.builder.String())
+	}
+	site.line(1, "middlewares:")
+	site.builder.WriteString(middlewares.builder.String())
+	site.line(0, "tls:")
+	site.line(1, "certificates:")
+	site.line(2, "- certFile: %s", SslCertDst(domain))
+	site.line(2, "  keyFile: %s", SslCertKeyDst(domain))
+	site.line(1, "options:")
+	site.builder.WriteString(options.builder.String())
+
+	return site.builder.String(), routerNames, nil
+}
+
+// Return all commands for installing Traefik and loading the files of the site of a domain to the proper location in
+// remote machine.
+//
+// Traefik is installed from the pinned release tarball, which is verified against the published checksums, and runs as
+// an unprivileged systemd service. The static config is regenerated with an HTTPS entry point for every port of every
+// site. Traefik has no offline config check, so the build restarts it and then checks through its local API that every
+// router of the site is enabled; otherwise the previous files are restored and the build fails. Without a running
+// systemd, e.g. in a Docker builder, a temporary Traefik is run for the same check and stopped afterwards, and the unit
+// is enabled so that Traefik starts at next boot
+func getTraefikSetupCommands(homeDir string, owner string, domain string, routers []string, files []siteFile) []string {
+	tarball := fmt.Sprintf("traefik_v%s_linux_$(dpkg --print-architecture).tar.gz", TraefikVersion)
+	checksums := fmt.Sprintf("traefik_v%s_checksums.txt", TraefikVersion)
+	release := fmt.Sprintf("https://github.com/traefik/traefik/releases/download/v%s", TraefikVersion)
+
+	commands := []string{
+		getCleanupCommand(homeDir, files),
+		"sudo apt update && sudo apt upgrade -y",
+
+		"sudo apt install -y curl ssl-cert",
+		fmt.Sprintf(
+			"if ! traefik version 2>/dev/null | grep -q -F %s; then cd /tmp && curl -fsSLO %s/%s && curl -fsSLO %s/%s && grep \" %s$\" %s | sha256sum -c - && sudo tar -xzf %s -C /usr/local/bin traefik && rm %s %s && cd -; fi",
+			TraefikVersion, release, tarball, release, checksums, tarball, checksums, tarball, tarball, checksums,
+		),
+		"if ! id traefik >/dev/null 2>&1; then sudo useradd --system --no-create-home --shell /usr/sbin/nologin traefik; fi",
+		"sudo usermod -aG ssl-cert traefik",
+		fmt.Sprintf("sudo mkdir -p %s %s %s %s", traefikDynamicDir, traefikBindingsDir, traefikHtpasswdDir, siteOwnersDir),
+		getOwnerCheckCommand("Traefik", owner, domain),
+		getConflictCheckCommand("Traefik", filepath.Join(homeDir, nginxBindingsFilename), traefikBindingsDir, domain),
+		fmt.Sprintf("sudo rm -rf %s && sudo mkdir -m 700 -p %s", backupDir, backupDir),
+		fmt.Sprintf("if [ -e %s ]; then sudo cp -p %s %s; fi", traefikConfigDst, traefikConfigDst, filepath.Join(backupDir, filepath.Base(traefikConfigDst))),
+	}
+
+	installCommands, restoreCommands := getInstallCommands(homeDir, files)
+	commands = append(commands, installCommands...)
+	backup := filepath.Join(backupDir, filepath.Base(traefikConfigDst))
+	restoreCommands = append(
+		restoreCommands,
+		fmt.Sprintf("if [ -e %s ]; then sudo mv %s %s; else sudo rm -f %s; fi", backup, backup, traefikConfigDst, traefikConfigDst),
+	)
+
+	commands = append(
+		commands,
+		fmt.Sprintf(
+			"{ sudo cat %s; for PORT in $({ echo 443; cut -d ' ' -f 1 %s/*; } | grep -v -x 80 | sort -n -u); do printf '  websecure-%%s:\\n    address: \":%%s\"\\n' $PORT $PORT; done; } | sudo tee %s > /dev/null",
+			traefikStaticConfigDst,
+			traefikBindingsDir,
+			traefikConfigDst,
+		),
+		fmt.Sprintf(
+			"TRAEFIK_PID=; if [ -d /run/systemd/system ]; then sudo systemctl daemon-reload && sudo systemctl enable traefik && sudo systemctl restart traefik; else sudo mkdir -p %s && sudo ln -sf %s %s && echo \"systemd is not running; checking the config with a temporary Traefik, the service starts at next boot\"; sudo /usr/local/bin/traefik --configFile=%s > /dev/null 2>&1 & TRAEFIK_PID=$!; fi",
+			filepath.Dir(traefikWantsLink), traefikUnitDst, traefikWantsLink, traefikConfigDst,
+		),
+		fmt.Sprintf(
+			"for ROUTER in %s; do for i in $(seq 30); do if curl -fsS http://%s/api/http/routers/$ROUTER@file 2>/dev/null | grep -q '\"status\":\"enabled\"'; then continue 2; fi; sleep 1; done; echo \"Traefik config validation failed; restoring previous config: router $ROUTER is not enabled\" >&2; %s; if [ -n \"$TRAEFIK_PID\" ]; then sudo kill $TRAEFIK_PID 2>/dev/null || true; else sudo systemctl restart traefik; fi; exit 1; done",
+			strings.Join(routers, " "),
+			traefikApiAddress,
+			strings.Join(restoreCommands, "; "),
+		),
+		"if [ -n \"$TRAEFIK_PID\" ]; then sudo kill $TRAEFIK_PID 2>/dev/null || true; fi",
+		fmt.Sprintf("sudo rm -rf %s", backupDir),
+	)
+
+	return append(commands, getPermissionCheckCommands(files)...)
+}
+
+// Converts an Nginx protocol name, e.g. "TLSv1.2", into the one of Traefik, e.g. "VersionTLS12"
+func traefikProtocol(protocol string) string {
+	version := strings.TrimPrefix(protocol, "TLSv")
+	if !strings.Contains(version, ".") {
+		version += ".0"
+	}
+	return "VersionTLS" + strings.ReplaceAll(version, ".", "")
+}
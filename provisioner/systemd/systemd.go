@@ -0,0 +1,171 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+// Package systemd models a systemd service unit as a Go type and renders it into unit file syntax. It also offers the
+// commands that install, start and health-check such a service in remote machine.
+//
+// Just like the nginx package, rendering is deterministic, so that a given model always produces byte-identical output
+package systemd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// UnitDir is the directory of the unit files installed by the local administrator
+const UnitDir string = "/etc/systemd/system"
+
+// EnvironmentFileDir is the directory of the environment files of services, as with the Debian packages of services
+const EnvironmentFileDir string = "/etc/default"
+
+// The number of seconds a health check waits for a service to answer
+const healthCheckTimeout int = 30
+
+// Service models a service unit. Except for Description and ExecStart, every setting is optional and is left to the
+// systemd default when empty
+type Service struct {
+	Description string
+
+	// After are the units this service is ordered after and wants, e.g. "network-online.target"
+	After []string
+
+	// Before are the units that wait for this service to start, e.g. the services reading the files it generates
+	Before []string
+
+	Type             string
+	User             string
+	Group            string
+	WorkingDirectory string
+
+	// EnvironmentFiles are loaded in order. A path prefixed with "-" is ignored if it does not exist
+	EnvironmentFiles []string
+	Environment      []string
+
+	ExecStartPre []string
+	ExecStart    string
+
+	// Restart is the restart policy, e.g. "always" or "on-failure"
+	Restart    string
+	RestartSec string
+
+	// Directives are rendered as-is at the end of the [Service] section, e.g. hardening options
+	Directives [][2]string
+}
+
+// UnitDst returns the path of the unit file of a service in remote machine
+func UnitDst(name string) string {
+	return filepath.Join(UnitDir, name+".service")
+}
+
+// EnvironmentFileDst returns the path of the environment file of a service in remote machine
+func EnvironmentFileDst(name string) string {
+	return filepath.Join(EnvironmentFileDir, name)
+}
+
+// Render returns the unit file content of this model
+func (s Service) Render() string {
+	var builder strings.Builder
+	line := func(key string, value string) {
+		if value != "" {
+			builder.WriteString(key + "=" + value + "\n")
+		}
+	}
+
+	builder.WriteString("[Unit]\n")
+	line("Description", s.Description)
+	line("After", strings.Join(s.After, " "))
+	line("Wants", strings.Join(s.After, " "))
+	line("Before", strings.Join(s.Before, " "))
+
+	builder.WriteString("\n[Service]\n")
+	line("Type", s.Type)
+	line("User", s.User)
+	line("Group", s.Group)
+	line("WorkingDirectory", s.WorkingDirectory)
+	for _, environmentFile := range s.EnvironmentFiles {
+		line("EnvironmentFile", environmentFile)
+	}
+	for _, environment := range s.Environment {
+		line("Environment", environment)
+	}
+	for _, execStartPre := range s.ExecStartPre {
+		line("ExecStartPre", execStartPre)
+	}
+	line("ExecStart", s.ExecStart)
+	line("Restart", s.Restart)
+	line("RestartSec", s.RestartSec)
+	for _, directive := range s.Directives {
+		line(directive[0], directive[1])
+	}
+
+	builder.WriteString("\n[Install]\nWantedBy=multi-user.target\n")
+
+	return builder.String()
+}
+
+// CommandsCreatingUser returns the commands creating a system user, and its group of the same name, that cannot log in.
+// The user is only created if it does not exist yet, so that repeated builds keep working
+func CommandsCreatingUser(user string) []string {
+	return []string{
+		fmt.Sprintf("if ! id %s >/dev/null 2>&1; then sudo useradd --system --user-group --no-create-home --shell /usr/sbin/nologin %s; fi", user, user),
+	}
+}
+
+// CommandsInstallingUnit returns the commands moving an uploaded unit file of a service to UnitDir
+func CommandsInstallingUnit(source string, name string) []string {
+	return []string{
+		fmt.Sprintf("sudo install -o root -g root -m 644 %s %s && rm %s", source, UnitDst(name), source),
+	}
+}
+
+// CommandsStartingService returns the commands enabling a service at boot and (re)starting it, so that it picks up the
+// latest unit and files.
+//
+// Machines without a running systemd, such as the Docker containers used in acceptance tests, only get the service
+// enabled, so that it starts at next boot
+func CommandsStartingService(name string) []string {
+	return []string{
+		fmt.Sprintf(
+			"if [ -d /run/systemd/system ]; then sudo systemctl daemon-reload && sudo systemctl enable %s && sudo systemctl restart %s; else sudo mkdir -p %s/multi-user.target.wants && sudo ln -sf %s %s/multi-user.target.wants/%s.service && echo \"systemd is not running; %s starts at next boot\"; fi",
+			name, name, UnitDir, UnitDst(name), UnitDir, name, name,
+		),
+	}
+}
+
+// CommandsCheckingHealth returns the commands failing the build unless a started service answers an HTTP request to a
+// URL, e.g. "http://127.0.0.1:3000/", within 30 seconds. The recent logs of the service are printed on failure.
+//
+// The check is skipped on machines without a running systemd, where CommandsStartingService does not start the service
+func CommandsCheckingHealth(name string, url string) []string {
+	return commandsWaitingFor(name, url, "-fsS")
+}
+
+// CommandsCheckingReachable is CommandsCheckingHealth for services whose URLs may answer with an error status, e.g. the
+// 404 of an API without a resource at "/". The build only fails unless the service answers at all
+func CommandsCheckingReachable(name string, url string) []string {
+	return commandsWaitingFor(name, url, "-sS")
+}
+
+func commandsWaitingFor(name string, url string, curlFlags string) []string {
+	return []string{
+		fmt.Sprintf(
+			"if [ -d /run/systemd/system ]; then for i in $(seq %d); do if curl %s -o /dev/null %s; then break; fi; if [ $i -eq %d ]; then echo \"%s does not answer on %s\" >&2; sudo journalctl -u %s --no-pager -n 50 >&2; exit 1; fi; sleep 1; done; fi",
+			healthCheckTimeout, curlFlags, url, healthCheckTimeout, name, url, name,
+		),
+	}
+}
+
+// ExecArgs joins arguments into a command line of ExecStart, so that systemd passes each of them to the command as it
+// is. Arguments with whitespace or quotes are double-quoted, and the specifiers and variables of systemd are escaped
+func ExecArgs(args ...string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		arg = strings.ReplaceAll(strings.ReplaceAll(arg, "%", "%%"), "$", "$$")
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			arg = "\"" + strings.ReplaceAll(strings.ReplaceAll(arg, "\\", "\\\\"), "\"", "\\\"") + "\""
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
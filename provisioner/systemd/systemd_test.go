@@ -0,0 +1,128 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package systemd
+
+import (
+	_ "embed"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//go:embed test-fixtures/app.service
+var expectedUnit string
+
+func TestRender(t *testing.T) {
+	service := Service{
+		Description:      "My App",
+		After:            []string{"network-online.target"},
+		User:             "app",
+		Group:            "app",
+		WorkingDirectory: "/opt/app",
+		EnvironmentFiles: []string{"-" + EnvironmentFileDst("app")},
+		Environment:      []string{"PORT=3000"},
+		ExecStart:        "/usr/bin/env serve -s dist -l 3000",
+		Restart:          "always",
+		RestartSec:       "5",
+		Directives:       [][2]string{{"NoNewPrivileges", "true"}},
+	}
+
+	if actual := service.Render(); actual != expectedUnit {
+		t.Errorf("Expected and actual unit do not match: %s\n\n%s", expectedUnit, actual)
+	}
+}
+
+func TestCommandsInstallingUnit(t *testing.T) {
+	expectedCommands := []string{"sudo install -o root -g root -m 644 /home/ubuntu/app.service /etc/systemd/system/app.service && rm /home/ubuntu/app.service"}
+
+	if actualCommands := CommandsInstallingUnit("/home/ubuntu/app.service", "app"); !reflect.DeepEqual(expectedCommands, actualCommands) {
+		t.Errorf("Expected and actual commands do not match: %s\n\n%s", expectedCommands, actualCommands)
+	}
+}
+
+func TestCommandsCheckingHealth(t *testing.T) {
+	expectedCommands := []string{
+		"if [ -d /run/systemd/system ]; then for i in $(seq 30); do if curl -fsS -o /dev/null http://127.0.0.1:3000/; then break; fi; if [ $i -eq 30 ]; then echo \"app does not answer on http://127.0.0.1:3000/\" >&2; sudo journalctl -u app --no-pager -n 50 >&2; exit 1; fi; sleep 1; done; fi",
+	}
+
+	if actualCommands := CommandsCheckingHealth("app", "http://127.0.0.1:3000/"); !reflect.DeepEqual(expectedCommands, actualCommands) {
+		t.Errorf("Expected and actual commands do not match: %s\n\n%s", expectedCommands, actualCommands)
+	}
+}
+
+func TestCommandsCheckingReachable(t *testing.T) {
+	expectedCommands := []string{
+		"if [ -d /run/systemd/system ]; then for i in $(seq 30); do if curl -sS -o /dev/null http://127.0.0.1:8080/; then break; fi; if [ $i -eq 30 ]; then echo \"jetty does not answer on http://127.0.0.1:8080/\" >&2; sudo journalctl -u jetty --no-pager -n 50 >&2; exit 1; fi; sleep 1; done; fi",
+	}
+
+	if actualCommands := CommandsCheckingReachable("jetty", "http://127.0.0.1:8080/"); !reflect.DeepEqual(expectedCommands, actualCommands) {
+		t.Errorf("Expected and actual commands do not match: %s\n\n%s", expectedCommands, actualCommands)
+	}
+}
+
+// Runs the checks against a service answering with 404, using stubs of curl, sleep and sudo and a directory standing in
+// for the one of a running systemd
+func TestCommandsWaitingFor(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	stubs := []string{
+		"set -e",
+		`curl() { if [ "$1" = "-fsS" ]; then return 22; fi; }`,
+		"sleep() { :; }",
+		`sudo() { echo "sudo $*" >&2; }`,
+	}
+
+	data := []struct {
+		name     string
+		commands []string
+		error    string
+	}{
+		{"healthy", CommandsCheckingHealth("app", "http://127.0.0.1:3000/"), "app does not answer on http://127.0.0.1:3000/\nsudo journalctl -u app --no-pager -n 50\n"},
+		{"reachable", CommandsCheckingReachable("jetty", "http://127.0.0.1:8080/"), ""},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			script := strings.Join(append(stubs, strings.ReplaceAll(strings.Join(d.commands, "\n"), "/run/systemd/system", t.TempDir())), "\n")
+
+			var stderr strings.Builder
+			cmd := exec.Command("bash", "-c", script)
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+
+			if d.error == "" && err != nil {
+				t.Errorf("Expected the check to pass, got %s: %s", err, stderr.String())
+			}
+			if d.error != "" {
+				if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+					t.Errorf("Expected the check to fail the script, got %v", err)
+				}
+				if stderr.String() != d.error {
+					t.Errorf("Expected %q, got %q", d.error, stderr.String())
+				}
+			}
+		})
+	}
+}
+
+func TestExecArgs(t *testing.T) {
+	data := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"/usr/bin/java", "-Xmx1g", "-jar", "start.jar"}, "/usr/bin/java -Xmx1g -jar start.jar"},
+		{[]string{"-XX:OnOutOfMemoryError=kill -9 %p"}, `"-XX:OnOutOfMemoryError=kill -9 %%p"`},
+		{[]string{`exec "$JAVA_HOME/bin/java"`}, `"exec \"$$JAVA_HOME/bin/java\""`},
+		{[]string{""}, `""`},
+	}
+
+	for _, d := range data {
+		if actual := ExecArgs(d.args...); actual != d.expected {
+			t.Errorf("Expected %s, got %s", d.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package webservice
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The servlet containers that the WAR file is deployed to
+const (
+	JettyContainer  string = "jetty"
+	TomcatContainer string = "tomcat"
+)
+
+// DEFAULT_SERVLET_CONTAINER Default servlet container of the WAR file
+const DEFAULT_SERVLET_CONTAINER string = JettyContainer
+
+// DEFAULT_JETTY_VERSION Default major version of Jetty
+const DEFAULT_JETTY_VERSION string = "11"
+
+// DEFAULT_TOMCAT_VERSION Default major version of Tomcat
+const DEFAULT_TOMCAT_VERSION string = "10"
+
+const mavenCentralUrl string = "https://repo1.maven.org/maven2"
+
+// A pinned release of Jetty
+type jettyRelease struct {
+	version string
+
+	// The Maven artifact of the distribution, which is also the directory the tarball extracts into
+	artifact string
+
+	// The option of start.jar enabling modules
+	addModuleOption string
+
+	// The modules of a plain WAR deployment, unless "jettyModules" is configured
+	modules []string
+
+	// The oldest major version of Java that the release runs on, which is MIN_JAVA_VERSION unless the release requires a
+	// newer one
+	minJavaVersion int
+}
+
+// A pinned release of Tomcat
+type tomcatRelease struct {
+	version        string
+	minJavaVersion int
+}
+
+// https://eclipse.dev/jetty/download.php. Jetty 9 and 10 implement javax.servlet, Jetty 11 jakarta.servlet, while
+// Jetty 12 offers both through its environment-specific modules, e.g. "ee8-webapp" or "ee10-webapp"
+var jettyReleases = map[string]jettyRelease{
+	"9": {
+		version:         "9.4.54.v20240208",
+		artifact:        "jetty-distribution",
+		addModuleOption: "--add-to-start",
+		modules:         []string{"annotations", "server", "http", "deploy", "servlet", "webapp", "resources", "jsp"},
+		minJavaVersion:  MIN_JAVA_VERSION,
+	},
+	"10": {
+		version:         "10.0.20",
+		artifact:        "jetty-home",
+		addModuleOption: "--add-module",
+		modules:         []string{"annotations", "server", "http", "deploy", "servlet", "webapp", "resources", "jsp"},
+		minJavaVersion:  MIN_JAVA_VERSION,
+	},
+	"11": {
+		version:         "11.0.20",
+		artifact:        "jetty-home",
+		addModuleOption: "--add-module",
+		modules:         []string{"annotations", "server", "http", "deploy", "servlet", "webapp", "resources", "jsp"},
+		minJavaVersion:  MIN_JAVA_VERSION,
+	},
+	"12": {
+		version:         "12.0.7",
+		artifact:        "jetty-home",
+		addModuleOption: "--add-module",
+		modules:         []string{"server", "http", "resources", "ee10-deploy", "ee10-webapp", "ee10-annotations", "ee10-jsp"},
+		minJavaVersion:  17,
+	},
+}
+
+// https://tomcat.apache.org/whichversion.html. Tomcat 9 implements javax.servlet and Tomcat 10 jakarta.servlet
+var tomcatReleases = map[string]tomcatRelease{
+	"9":  {version: "9.0.86", minJavaVersion: MIN_JAVA_VERSION},
+	"10": {version: "10.1.19", minJavaVersion: MIN_JAVA_VERSION},
+}
+
+var jettyModuleName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// The Jakarta EE environments of the modules of Jetty 12, e.g. "ee10" of "ee10-webapp"
+var jettyEnvironmentModule = regexp.MustCompile(`^(ee[0-9]+)-`)
+
+// The modules that Jetty 12 only offers per Jakarta EE environment
+var jettyEnvironmentSpecificModules = map[string]bool{
+	"annotations": true,
+	"apache-jsp":  true,
+	"jsp":         true,
+	"jstl":        true,
+	"servlet":     true,
+	"servlets":    true,
+	"webapp":      true,
+}
+
+// The Jakarta EE environments of Jetty 12.0
+var jettyEnvironments = map[string]bool{"ee8": true, "ee9": true, "ee10": true}
+
+func (c Config) servletContainer() string {
+	if c.ServletContainer == "" {
+		return DEFAULT_SERVLET_CONTAINER
+	}
+	return c.ServletContainer
+}
+
+func (c Config) jettyVersion() string {
+	if c.JettyVersion == "" {
+		return DEFAULT_JETTY_VERSION
+	}
+	return c.JettyVersion
+}
+
+func (c Config) tomcatVersion() string {
+	if c.TomcatVersion == "" {
+		return DEFAULT_TOMCAT_VERSION
+	}
+	return c.TomcatVersion
+}
+
+func (c Config) jettyRelease() jettyRelease {
+	return jettyReleases[c.jettyVersion()]
+}
+
+func (c Config) tomcatRelease() tomcatRelease {
+	return tomcatReleases[c.tomcatVersion()]
+}
+
+// Returns whether or not the WAR file is deployed to Tomcat instead of Jetty
+func (c Config) tomcat() bool {
+	return !c.jarMode() && c.servletContainer() == TomcatContainer
+}
+
+// Returns the Jetty modules enabled in JETTY_BASE, i.e. the configured ones or those of a plain WAR deployment of the
+// release, which include the handling of the X-Forwarded-* headers behind the TLS front end
+func (c Config) jettyModules() []string {
+	modules := c.JettyModules
+	if modules == nil {
+		modules = c.jettyRelease().modules
+	}
+
+	if c.frontend() && !contains(modules, forwardedJettyModule) {
+		modules = append(append([]string{}, modules...), forwardedJettyModule)
+	}
+	return modules
+}
+
+// Returns an error if the servlet container or its version is unknown, if the settings of the other container are
+// used, if a Jetty module is not offered by the Jetty version, or if the container does not run on the Java version
+func (c Config) validateContainer() error {
+	if c.jarMode() {
+		if c.ServletContainer != "" || c.JettyVersion != "" || c.JettyModules != nil || c.TomcatVersion != "" ||
+			c.TomcatHttpPort != "" {
+			return fmt.Errorf("servletContainer, jettyVersion, jettyModules, tomcatVersion and tomcatHttpPort require warSource")
+		}
+		return nil
+	}
+
+	javaVersion, _ := strconv.Atoi(c.javaVersion())
+
+	switch c.servletContainer() {
+	case JettyContainer:
+		if c.TomcatVersion != "" || c.TomcatHttpPort != "" {
+			return fmt.Errorf("tomcatVersion and tomcatHttpPort require the '%s' servletContainer", TomcatContainer)
+		}
+
+		release, ok := jettyReleases[c.jettyVersion()]
+		if !ok {
+			return fmt.Errorf(
+				"unknown jettyVersion '%s'; supported versions are %s", c.JettyVersion, strings.Join(sortedVersions(jettyReleases), ", "),
+			)
+		}
+		if javaVersion < release.minJavaVersion {
+			return fmt.Errorf("Jetty %s requires javaVersion %d or later", c.jettyVersion(), release.minJavaVersion)
+		}
+
+		return c.validateJettyModules()
+	case TomcatContainer:
+		if c.JettyVersion != "" || c.JettyModules != nil || c.JettyHttpPort != "" || c.JettyHttps || c.JettyHttpsPort != "" {
+			return fmt.Errorf(
+				"jettyVersion, jettyModules, jettyHttpPort, jettyHttps and jettyHttpsPort require the '%s' servletContainer",
+				JettyContainer,
+			)
+		}
+
+		release, ok := tomcatReleases[c.tomcatVersion()]
+		if !ok {
+			return fmt.Errorf(
+				"unknown tomcatVersion '%s'; supported versions are %s", c.TomcatVersion, strings.Join(sortedVersions(tomcatReleases), ", "),
+			)
+		}
+		if javaVersion < release.minJavaVersion {
+			return fmt.Errorf("Tomcat %s requires javaVersion %d or later", c.tomcatVersion(), release.minJavaVersion)
+		}
+		if port, err := strconv.Atoi(c.tomcatHttpPort()); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid tomcatHttpPort '%s'", c.TomcatHttpPort)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf(
+			"unknown servletContainer '%s'; supported containers are '%s' and '%s'",
+			c.ServletContainer,
+			JettyContainer,
+			TomcatContainer,
+		)
+	}
+}
+
+// Returns an error if a configured Jetty module is malformed or not offered by the Jetty version. The "http" module is
+// required, since the webservice is served and health-checked on the HTTP port
+func (c Config) validateJettyModules() error {
+	if c.JettyModules == nil {
+		return nil
+	}
+
+	jetty12 := c.jettyVersion() == "12"
+	for _, module := range c.JettyModules {
+		if !jettyModuleName.MatchString(module) {
+			return fmt.Errorf("invalid jettyModule '%s'", module)
+		}
+
+		environment := jettyEnvironmentModule.FindStringSubmatch(module)
+		switch {
+		case jetty12 && jettyEnvironmentSpecificModules[module]:
+			return fmt.Errorf(
+				"Jetty 12 offers jettyModule '%s' per Jakarta EE environment, e.g. 'ee10-%s' or 'ee8-%s'", module, module, module,
+			)
+		case jetty12 && environment != nil && !jettyEnvironments[environment[1]]:
+			return fmt.Errorf("jettyModule '%s' is not offered by Jetty %s", module, c.jettyRelease().version)
+		case !jetty12 && environment != nil:
+			return fmt.Errorf("jettyModule '%s' requires jettyVersion 12", module)
+		}
+	}
+
+	if !contains(c.JettyModules, "http") {
+		return fmt.Errorf("jettyModules must include 'http'")
+	}
+
+	return nil
+}
+
+func sortedVersions[T any](releases map[string]T) []string {
+	versions := make([]string, 0, len(releases))
+	for version := range releases {
+		versions = append(versions, "'"+version+"'")
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return len(versions[i]) < len(versions[j]) || (len(versions[i]) == len(versions[j]) && versions[i] < versions[j])
+	})
+	return versions
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package webservice
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateContainer(t *testing.T) {
+	war := "my-webservice.war"
+
+	data := []struct {
+		name   string
+		config Config
+		error  string
+	}{
+		{"Jetty 9", Config{WarSource: war, JettyVersion: "9", JavaVersion: "11"}, ""},
+		{"Jetty 12", Config{WarSource: war, JettyVersion: "12", JettyModules: []string{"server", "http", "ee8-deploy", "ee8-webapp"}}, ""},
+		{"Jetty modules", Config{WarSource: war, JettyModules: []string{"server", "http", "deploy", "webapp", "websocket"}}, ""},
+		{"Tomcat 9", Config{WarSource: war, ServletContainer: TomcatContainer, TomcatVersion: "9", TomcatHttpPort: "9090"}, ""},
+		{"Tomcat 10", Config{WarSource: war, ServletContainer: TomcatContainer, JavaVersion: "21"}, ""},
+		{"unknown container", Config{WarSource: war, ServletContainer: "undertow"}, "unknown servletContainer"},
+		{"unknown Jetty version", Config{WarSource: war, JettyVersion: "8"}, "unknown jettyVersion '8'; supported versions are '9', '10', '11', '12'"},
+		{"unknown Tomcat version", Config{WarSource: war, ServletContainer: TomcatContainer, TomcatVersion: "11"}, "unknown tomcatVersion"},
+		{"Jetty 12 on Java 11", Config{WarSource: war, JettyVersion: "12", JavaVersion: "11"}, "Jetty 12 requires javaVersion 17 or later"},
+		{"Jetty 12 on Java 17", Config{WarSource: war, JettyVersion: "12", JavaVersion: "17"}, ""},
+		{"Jetty 9 on Java 8", Config{WarSource: war, JettyVersion: "9", JavaVersion: "8"}, "the oldest supported version is 11"},
+		{"Tomcat 9 on Java 11", Config{WarSource: war, ServletContainer: TomcatContainer, TomcatVersion: "9", JavaVersion: "11"}, ""},
+		{"Tomcat 9 on Java 8", Config{WarSource: war, ServletContainer: TomcatContainer, TomcatVersion: "9", JavaVersion: "8"}, "the oldest supported version is 11"},
+		{"Jetty 12 without environment", Config{WarSource: war, JettyVersion: "12", JettyModules: []string{"http", "webapp"}}, "per Jakarta EE environment"},
+		{"Jetty 12 with unknown environment", Config{WarSource: war, JettyVersion: "12", JettyModules: []string{"http", "ee11-webapp"}}, "not offered by Jetty 12.0.7"},
+		{"Jetty 11 with environment", Config{WarSource: war, JettyModules: []string{"http", "ee10-webapp"}}, "requires jettyVersion 12"},
+		{"Jetty modules without HTTP", Config{WarSource: war, JettyModules: []string{"server", "webapp"}}, "must include 'http'"},
+		{"invalid Jetty module", Config{WarSource: war, JettyModules: []string{"http", "webapp,jsp"}}, "invalid jettyModule"},
+		{"Jetty with Tomcat version", Config{WarSource: war, TomcatVersion: "9"}, "require the 'tomcat' servletContainer"},
+		{"Tomcat with Jetty modules", Config{WarSource: war, ServletContainer: TomcatContainer, JettyModules: []string{"http"}}, "require the 'jetty' servletContainer"},
+		{"invalid Tomcat port", Config{WarSource: war, ServletContainer: TomcatContainer, TomcatHttpPort: "http"}, "invalid tomcatHttpPort"},
+		{"JAR with container", Config{JarSource: "my-webservice.jar", ServletContainer: JettyContainer}, "require warSource"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			err := d.config.validate()
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func TestMinJavaVersions(t *testing.T) {
+	for version, release := range jettyReleases {
+		if release.minJavaVersion < MIN_JAVA_VERSION {
+			t.Errorf("Jetty %s runs on Java %d, which is older than the oldest supported version", version, release.minJavaVersion)
+		}
+	}
+	for version, release := range tomcatReleases {
+		if release.minJavaVersion < MIN_JAVA_VERSION {
+			t.Errorf("Tomcat %s runs on Java %d, which is older than the oldest supported version", version, release.minJavaVersion)
+		}
+	}
+}
+
+func Test_jettyModules(t *testing.T) {
+	data := []struct {
+		name     string
+		config   Config
+		expected []string
+	}{
+		{"Jetty 11", Config{}, []string{"annotations", "server", "http", "deploy", "servlet", "webapp", "resources", "jsp"}},
+		{"Jetty 12", Config{JettyVersion: "12"}, []string{"server", "http", "resources", "ee10-deploy", "ee10-webapp", "ee10-annotations", "ee10-jsp"}},
+		{"configured", Config{JettyModules: []string{"server", "http", "webapp"}}, []string{"server", "http", "webapp"}},
+		{"behind front end", Config{JettyModules: []string{"http"}, WebserviceDomain: "api.mycompany.com"}, []string{"http", "http-forwarded"}},
+		{"forwarded behind front end", Config{JettyModules: []string{"http-forwarded", "http"}, WebserviceDomain: "api.mycompany.com"}, []string{"http-forwarded", "http"}},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			if actual := d.config.jettyModules(); !reflect.DeepEqual(d.expected, actual) {
+				t.Errorf("Expected %v, got %v", d.expected, actual)
+			}
+		})
+	}
+}
+
+func Test_getCommandsInstallingJetty(t *testing.T) {
+	data := []struct {
+		version string
+		tarball string
+		modules string
+		sslIni  string
+	}{
+		{
+			"9",
+			"https://repo1.maven.org/maven2/org/eclipse/jetty/jetty-distribution/9.4.54.v20240208/jetty-distribution-9.4.54.v20240208.tar.gz",
+			"java -jar $JETTY_HOME/start.jar --add-to-start=annotations,server,http,deploy,servlet,webapp,resources,jsp",
+			"java -jar $JETTY_HOME/start.jar --add-to-start=ssl,https",
+		},
+		{
+			"12",
+			"https://repo1.maven.org/maven2/org/eclipse/jetty/jetty-home/12.0.7/jetty-home-12.0.7.tar.gz",
+			"java -jar $JETTY_HOME/start.jar --add-module=server,http,resources,ee10-deploy,ee10-webapp,ee10-annotations,ee10-jsp",
+			"java -jar $JETTY_HOME/start.jar --add-module=ssl,https",
+		},
+	}
+
+	for _, d := range data {
+		t.Run("Jetty "+d.version, func(t *testing.T) {
+			config := Config{HomeDir: "/home/ubuntu", JettyVersion: d.version, JavaVersion: "17", SslCertBase64: "x", KeystorePassword: "changeit", JettyHttps: true}
+
+			commands := strings.Join(getCommands(config, 0), "\n")
+			for _, expected := range []string{
+				"JETTY_TARBALL_SHA1=$(curl -fsSL " + d.tarball + ".sha1 | awk '{print $1}')",
+				"cd /tmp && curl -fsSL -o jetty.tar.gz " + d.tarball + " && echo \"$JETTY_TARBALL_SHA1  jetty.tar.gz\" | sha1sum -c -",
+				d.modules + "\n",
+				d.sslIni + "\n",
+			} {
+				if !strings.Contains(commands, expected) {
+					t.Errorf("Expected %q in commands: %s", expected, commands)
+				}
+			}
+		})
+	}
+}
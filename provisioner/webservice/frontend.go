@@ -0,0 +1,102 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package webservice
+
+import (
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/nginx"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"strings"
+)
+
+// The Jetty module that honors the X-Forwarded-* headers of the TLS front end, so that the webservice sees the scheme,
+// host and client address of the original request
+const forwardedJettyModule string = "http-forwarded"
+
+// Returns whether or not the webservice is put behind the TLS front end, i.e. a proxy serving "webserviceDomain" over HTTPS
+func (c Config) frontend() bool {
+	return c.WebserviceDomain != ""
+}
+
+// Returns whether or not the certificate is converted into a Java keystore. Without the TLS front end the certificate
+// is only there for the keystore, while behind it a keystore is created only if Jetty serves HTTPS or a password is set
+func (c Config) keystore() bool {
+	return c.SslCertBase64 != "" && (!c.frontend() || c.JettyHttps || c.KeystorePassword != "")
+}
+
+// Returns the address that the webservice binds its HTTP port to, which is loopback behind the TLS front end, so that
+// the webservice is reachable through the front end only; empty for all interfaces
+func (c Config) httpHost() string {
+	if c.frontend() {
+		return "127.0.0.1"
+	}
+	return ""
+}
+
+// Returns an error if the TLS front end is incomplete, or its settings are given without it
+func (c Config) validateFrontend() error {
+	if !c.frontend() {
+		if len(c.PrivatePaths) > 0 {
+			return fmt.Errorf("privatePaths requires webserviceDomain")
+		}
+		return nil
+	}
+
+	if c.SslCertBase64 == "" {
+		return fmt.Errorf("webserviceDomain requires sslCertBase64 and sslCertKeyBase64")
+	}
+
+	if err := c.Config.Validate(); err != nil {
+		return err
+	}
+
+	if len(c.PrivatePaths) > 0 {
+		if c.ProxyBackend != "" && c.ProxyBackend != ssl.NginxBackend {
+			return fmt.Errorf("privatePaths is only supported by the '%s' proxyBackend", ssl.NginxBackend)
+		}
+		if c.NginxTemplate != "" {
+			return fmt.Errorf("privatePaths cannot be combined with nginxTemplate")
+		}
+	}
+	for _, path := range c.PrivatePaths {
+		if !strings.HasPrefix(path, "/") || path == "/" {
+			return fmt.Errorf("invalid privatePath '%s'; it must start with '/' and not be '/' itself", path)
+		}
+	}
+
+	_, err := c.NginxConfig(c.WebserviceDomain, c.httpPort(), c.getNginxConfig())
+	return err
+}
+
+// Returns the built-in Nginx config of the TLS front end, which proxies the domain to the HTTP port of the webservice.
+// The private paths, e.g. "/actuator/" or "/healthcheck", are answered with 404 as if they did not exist, while they
+// remain reachable on the HTTP port of the webservice from the machine itself
+func (c Config) getNginxConfig() nginx.Config {
+	locations := []nginx.Location{
+		{
+			Path:      "/",
+			ProxyPass: "http://127.0.0.1:" + c.httpPort(),
+		},
+	}
+	for _, path := range c.PrivatePaths {
+		locations = append(locations, nginx.Location{
+			Path:       path,
+			Directives: []nginx.Directive{nginx.NewDirective("return", "404")},
+		})
+	}
+
+	return nginx.Config{
+		Servers: []nginx.Server{
+			{
+				Listens:     nginx.SslListens("443"),
+				ServerNames: []string{c.WebserviceDomain},
+				Root:        nginx.DefaultRoot,
+				Index:       nginx.DefaultIndex,
+				TLS:         ssl.NginxTls(c.WebserviceDomain),
+				Locations:   locations,
+			},
+			nginx.RedirectServer(c.WebserviceDomain),
+		},
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package webservice
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"strings"
+	"testing"
+)
+
+//go:embed test-fixtures/nginx-frontend.conf
+var expectedNginxConfig string
+
+func Test_getNginxConfig(t *testing.T) {
+	config := Config{WebserviceDomain: "api.mycompany.com", PrivatePaths: []string{"/actuator/", "/healthcheck"}}
+
+	if actual := config.getNginxConfig().Render(); actual != expectedNginxConfig {
+		t.Errorf("Expected and actual Nginx config do not match: %s\n\n%s", expectedNginxConfig, actual)
+	}
+}
+
+func TestValidateFrontend(t *testing.T) {
+	cert := base64.StdEncoding.EncodeToString([]byte(testCertificate))
+	domain := "api.mycompany.com"
+
+	war := "my-webservice.war"
+
+	data := []struct {
+		name   string
+		config Config
+		error  string
+	}{
+		{"front end", Config{WarSource: war, WebserviceDomain: domain, SslCertBase64: cert, SslCertKeyBase64: cert, PrivatePaths: []string{"/actuator/"}}, ""},
+		{"front end and keystore", Config{WarSource: war, WebserviceDomain: domain, SslCertBase64: cert, SslCertKeyBase64: cert, KeystorePassword: "changeit", JettyHttps: true}, ""},
+		{"front end without cert", Config{WarSource: war, WebserviceDomain: domain}, "webserviceDomain requires sslCertBase64"},
+		{"private paths without front end", Config{WarSource: war, PrivatePaths: []string{"/actuator/"}}, "privatePaths requires webserviceDomain"},
+		{"private root", Config{WarSource: war, WebserviceDomain: domain, SslCertBase64: cert, SslCertKeyBase64: cert, PrivatePaths: []string{"/"}}, "invalid privatePath"},
+		{"relative private path", Config{WarSource: war, WebserviceDomain: domain, SslCertBase64: cert, SslCertKeyBase64: cert, PrivatePaths: []string{"actuator"}}, "invalid privatePath"},
+		{
+			"private paths on Caddy",
+			Config{WarSource: war, WebserviceDomain: domain, SslCertBase64: cert, SslCertKeyBase64: cert, PrivatePaths: []string{"/actuator/"}, Config: ssl.Config{ProxyBackend: ssl.CaddyBackend}},
+			"only supported by the 'nginx' proxyBackend",
+		},
+		{"Caddy", Config{WarSource: war, WebserviceDomain: domain, SslCertBase64: cert, SslCertKeyBase64: cert, Config: ssl.Config{ProxyBackend: ssl.CaddyBackend}}, ""},
+		{"unknown TLS profile", Config{WarSource: war, WebserviceDomain: domain, SslCertBase64: cert, SslCertKeyBase64: cert, Config: ssl.Config{TlsProfile: "none"}}, "unknown tlsProfile"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			err := d.config.validate()
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func Test_getCommandsBehindFrontend(t *testing.T) {
+	config := Config{HomeDir: "/home/ubuntu", WebserviceDomain: "api.mycompany.com", SslCertBase64: "x"}
+
+	commands := strings.Join(getCommands(config, 0), "\n")
+	if !strings.Contains(commands, "--add-module=annotations,server,http,deploy,servlet,webapp,resources,jsp,http-forwarded\n") {
+		t.Errorf("Expected the http-forwarded module in commands: %s", commands)
+	}
+	if strings.Contains(commands, "keystore") {
+		t.Errorf("Expected no keystore without keystorePassword behind the front end: %s", commands)
+	}
+
+	config.KeystorePassword = "changeit"
+	commands = strings.Join(getCommands(config, 0), "\n")
+	if !strings.Contains(commands, "sudo install -o root -g $(id -gn) -m 640 /run/qubitpi-private/ssl.key /run/qubitpi-keystore/keystore.key\n") {
+		t.Errorf("Expected the staged key to be kept for the front end: %s", commands)
+	}
+
+	unit := getService(config.httpHost(), config.jettyHttpPort(), config.jvmOptions()).Render()
+	if !strings.Contains(unit, "-Djetty.http.port=8080 -Djetty.http.host=127.0.0.1\n") {
+		t.Errorf("Expected Jetty to bind to loopback behind the front end: %s", unit)
+	}
+}
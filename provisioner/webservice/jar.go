@@ -0,0 +1,194 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package webservice
+
+import (
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/systemd"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// JAR_SERVICE_NAME The name of the systemd service running the fat JAR
+const JAR_SERVICE_NAME string = "webservice"
+
+// JAR_SERVICE_USER The dedicated system user running the fat JAR
+const JAR_SERVICE_USER string = "webservice"
+
+// JAR_APP_DIR The directory in remote machine holding the fat JAR, its application config and its keystore
+const JAR_APP_DIR string = "/opt/webservice"
+
+// DEFAULT_JAR_HTTP_PORT Default port that the fat JAR serves HTTP on
+const DEFAULT_JAR_HTTP_PORT string = "8080"
+
+const jarKeystoreAlias string = "webservice"
+const jarFilename string = "webservice.jar"
+const jarServiceFilename string = JAR_SERVICE_NAME + ".service"
+const jarEnvironmentFilename string = JAR_SERVICE_NAME + ".env"
+
+var environmentVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Returns whether or not the webservice is a fat JAR, which runs without a servlet container
+func (c Config) jarMode() bool {
+	return c.JarSource != ""
+}
+
+func (c Config) jarHttpPort() string {
+	if c.JarHttpPort == "" {
+		return DEFAULT_JAR_HTTP_PORT
+	}
+	return c.JarHttpPort
+}
+
+// Returns the local HTTP port of the webservice, i.e. of the fat JAR, of Tomcat or of Jetty
+func (c Config) httpPort() string {
+	switch {
+	case c.jarMode():
+		return c.jarHttpPort()
+	case c.tomcat():
+		return c.tomcatHttpPort()
+	default:
+		return c.jettyHttpPort()
+	}
+}
+
+// Returns the file name of the application config in remote machine, e.g. "application.yml", which keeps the extension
+// of the local file
+func (c Config) applicationConfigFilename() string {
+	if c.ApplicationConfig == "" {
+		return ""
+	}
+	return "application" + filepath.Ext(c.ApplicationConfig)
+}
+
+// Returns an error unless exactly one of the WAR and the fat JAR is given, or if the settings of the other mode are used
+func (c Config) validateMode() error {
+	if (c.WarSource == "") == (c.JarSource == "") {
+		return fmt.Errorf("exactly one of warSource and jarSource must be configured")
+	}
+
+	if !c.jarMode() {
+		if c.JarHttpPort != "" || c.ApplicationConfig != "" || len(c.Environment) > 0 {
+			return fmt.Errorf("jarHttpPort, applicationConfig and environment require jarSource")
+		}
+		return nil
+	}
+
+	if c.JettyHttps || c.JettyHttpPort != "" || c.JettyHttpsPort != "" {
+		return fmt.Errorf("jettyHttps, jettyHttpPort and jettyHttpsPort require warSource")
+	}
+
+	switch filepath.Ext(c.ApplicationConfig) {
+	case ".yml", ".yaml", ".properties":
+	default:
+		if c.ApplicationConfig != "" {
+			return fmt.Errorf("invalid applicationConfig '%s'; expected a .yml, .yaml or .properties file", c.ApplicationConfig)
+		}
+	}
+
+	for name := range c.Environment {
+		if !environmentVariableName.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name '%s'", name)
+		}
+	}
+
+	return nil
+}
+
+// Returns the systemd service running the fat JAR at boot as JAR_SERVICE_USER with the JVM options. The port is passed as
+// SERVER_PORT, which Spring Boot picks up. Behind the TLS front end, the loopback address is passed as SERVER_ADDRESS
+// and the X-Forwarded-* headers are honored. The environment file overrides these variables.
+//
+// The working directory is JAR_APP_DIR, so that Spring Boot finds the application config in its "config" directory
+func getJarService(httpHost string, httpPort string, jvmOptions []string) systemd.Service {
+	args := []string{"/bin/sh", "-c", `exec "$JAVA_HOME/bin/java" "$@"`, "java"}
+	args = append(args, jvmOptions...)
+	args = append(args, "-jar", filepath.Join(JAR_APP_DIR, jarFilename))
+
+	environment := []string{"SERVER_PORT=" + httpPort}
+	if httpHost != "" {
+		environment = append(environment, "SERVER_ADDRESS="+httpHost, "SERVER_FORWARD_HEADERS_STRATEGY=native")
+	}
+
+	return systemd.Service{
+		Description:      "Java webservice",
+		After:            []string{"network-online.target"},
+		User:             JAR_SERVICE_USER,
+		Group:            JAR_SERVICE_USER,
+		WorkingDirectory: JAR_APP_DIR,
+		EnvironmentFiles: []string{systemd.EnvironmentFileDst(JAR_SERVICE_NAME)},
+		Environment:      environment,
+		ExecStart:        systemd.ExecArgs(args...),
+		Restart:          "always",
+		RestartSec:       "5",
+		Directives: [][2]string{
+			{"NoNewPrivileges", "true"},
+			{"ProtectSystem", "full"},
+			{"ProtectHome", "true"},
+			{"PrivateTmp", "true"},
+		},
+	}
+}
+
+// Returns the environment file of the fat JAR service with one "NAME=value" line per variable, sorted by name. Values
+// are quoted, so that they can contain spaces, quotes and backslashes
+func getJarEnvironmentFile(environment map[string]string) string {
+	names := make([]string, 0, len(environment))
+	for name := range environment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	quoter := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+	var builder strings.Builder
+	for _, name := range names {
+		builder.WriteString(fmt.Sprintf("%s=\"%s\"\n", name, quoter.Replace(environment[name])))
+	}
+	return builder.String()
+}
+
+// Returns the commands creating JAR_APP_DIR, which is set up by the current user and handed over to JAR_SERVICE_USER by
+// getCommandsInstallingJarService(), and moving the uploaded fat JAR into it
+func getCommandsPreparingJarDir(homeDir string) []string {
+	return []string{
+		fmt.Sprintf("sudo rm -rf %s && sudo mkdir -p %s && sudo chown $(id -un) %s", JAR_APP_DIR, JAR_APP_DIR, JAR_APP_DIR),
+		fmt.Sprintf("mv %s %s", filepath.Join(homeDir, jarFilename), filepath.Join(JAR_APP_DIR, jarFilename)),
+	}
+}
+
+// Returns the commands handing JAR_APP_DIR over to JAR_SERVICE_USER and starting the service running the fat JAR. The
+// environment file and the application config may contain secrets, so they are only readable by root and
+// JAR_SERVICE_USER. JAVA_HOME of the installed Java is appended to the environment file, so that it wins over the
+// configured variables. The build fails unless the webservice answers on its port, with any status
+func getCommandsInstallingJarService(homeDir string, httpPort string, applicationConfigFilename string) []string {
+	environmentFile := systemd.EnvironmentFileDst(JAR_SERVICE_NAME)
+
+	commands := systemd.CommandsCreatingUser(JAR_SERVICE_USER)
+	commands = append(commands, fmt.Sprintf("sudo chown -R %s:%s %s", JAR_SERVICE_USER, JAR_SERVICE_USER, JAR_APP_DIR))
+	if applicationConfigFilename != "" {
+		configDir := filepath.Join(JAR_APP_DIR, "config")
+		commands = append(
+			commands,
+			fmt.Sprintf("sudo mkdir -p %s && sudo chown root:%s %s && sudo chmod 750 %s", configDir, JAR_SERVICE_USER, configDir, configDir),
+			ssl.CommandInstallingPrivateFile(
+				filepath.Join(homeDir, applicationConfigFilename),
+				filepath.Join(configDir, applicationConfigFilename),
+				JAR_SERVICE_USER,
+				"640",
+			),
+		)
+	}
+	commands = append(
+		commands,
+		ssl.CommandInstallingPrivateFile(filepath.Join(homeDir, jarEnvironmentFilename), environmentFile, JAR_SERVICE_USER, "640"),
+		fmt.Sprintf("echo \"JAVA_HOME=$JAVA_HOME\" | sudo tee -a %s > /dev/null", environmentFile),
+	)
+	commands = append(commands, systemd.CommandsInstallingUnit(filepath.Join(homeDir, jarServiceFilename), JAR_SERVICE_NAME)...)
+	commands = append(commands, systemd.CommandsStartingService(JAR_SERVICE_NAME)...)
+	return append(commands, systemd.CommandsCheckingReachable(JAR_SERVICE_NAME, "http://127.0.0.1:"+httpPort+"/")...)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package webservice
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+//go:embed test-fixtures/webservice.service
+var expectedJarUnit string
+
+func TestValidateMode(t *testing.T) {
+	cert := base64.StdEncoding.EncodeToString([]byte(testCertificate))
+	jar := "my-webservice.jar"
+
+	data := []struct {
+		name   string
+		config Config
+		error  string
+	}{
+		{"JAR", Config{JarSource: jar, ApplicationConfig: "application.yml", Environment: map[string]string{"SPRING_PROFILES_ACTIVE": "prod"}}, ""},
+		{"JAR properties", Config{JarSource: jar, JarHttpPort: "9090", ApplicationConfig: "config/application.properties"}, ""},
+		{"JAR behind front end", Config{JarSource: jar, WebserviceDomain: "api.mycompany.com", SslCertBase64: cert, SslCertKeyBase64: cert}, ""},
+		{"JAR keystore", Config{JarSource: jar, SslCertBase64: cert, SslCertKeyBase64: cert, KeystorePassword: "changeit"}, ""},
+		{"neither WAR nor JAR", Config{}, "exactly one of warSource and jarSource"},
+		{"WAR and JAR", Config{WarSource: "my-webservice.war", JarSource: jar}, "exactly one of warSource and jarSource"},
+		{"WAR with environment", Config{WarSource: "my-webservice.war", Environment: map[string]string{"A": "b"}}, "require jarSource"},
+		{"JAR with Jetty HTTPS", Config{JarSource: jar, SslCertBase64: cert, SslCertKeyBase64: cert, KeystorePassword: "changeit", JettyHttps: true}, "require warSource"},
+		{"JAR with Jetty port", Config{JarSource: jar, JettyHttpPort: "9090"}, "require warSource"},
+		{"invalid JAR port", Config{JarSource: jar, JarHttpPort: "0"}, "invalid jarHttpPort"},
+		{"XML application config", Config{JarSource: jar, ApplicationConfig: "application.xml"}, "invalid applicationConfig"},
+		{"invalid environment variable", Config{JarSource: jar, Environment: map[string]string{"SPRING-PROFILES": "prod"}}, "invalid environment variable name"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			err := d.config.validate()
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func Test_getJarService(t *testing.T) {
+	config := Config{JarSource: "my-webservice.jar", WebserviceDomain: "api.mycompany.com"}
+
+	actualUnit := getJarService(config.httpHost(), config.jarHttpPort(), config.jvmOptions()).Render()
+	if actualUnit != expectedJarUnit {
+		t.Errorf("Expected and actual unit do not match: %s\n\n%s", expectedJarUnit, actualUnit)
+	}
+
+	if unit := getJarService("", "9090", []string{"-Xmx1g"}).Render(); strings.Contains(unit, "SERVER_ADDRESS") || !strings.Contains(unit, "Environment=SERVER_PORT=9090\n") || !strings.Contains(unit, " java -Xmx1g -jar ") {
+		t.Errorf("Expected JVM options and port 9090 on all interfaces in unit: %s", unit)
+	}
+}
+
+func Test_getJarEnvironmentFile(t *testing.T) {
+	expected := "SPRING_DATASOURCE_PASSWORD=\"pa ss\\\"word\\\\\"\nSPRING_PROFILES_ACTIVE=\"prod\"\n"
+
+	actual := getJarEnvironmentFile(map[string]string{"SPRING_PROFILES_ACTIVE": "prod", "SPRING_DATASOURCE_PASSWORD": `pa ss"word\`})
+	if actual != expected {
+		t.Errorf("Expected and actual environment file do not match: %s\n\n%s", expected, actual)
+	}
+}
+
+func Test_getCommandsInJarMode(t *testing.T) {
+	config := Config{HomeDir: "/home/ubuntu", JarSource: "my-webservice.jar", ApplicationConfig: "src/main/resources/application.yml", SslCertBase64: "x", KeystorePassword: "changeit"}
+
+	commands := strings.Join(getCommands(config, 0), "\n")
+	for _, expected := range []string{
+		"sudo apt install -y openjdk-17-jre-headless",
+		"mv /home/ubuntu/webservice.jar /opt/webservice/webservice.jar",
+		"-out /opt/webservice/etc/keystore.p12 -passout file:/run/qubitpi-keystore/keystore.password",
+		"sudo useradd --system --user-group --no-create-home --shell /usr/sbin/nologin webservice",
+		"sudo chown -R webservice:webservice /opt/webservice",
+		"sudo install -o root -g webservice -m 640 /home/ubuntu/application.yml /opt/webservice/config/application.yml",
+		"sudo install -o root -g webservice -m 640 /home/ubuntu/webservice.env /etc/default/webservice",
+		"echo \"JAVA_HOME=$JAVA_HOME\" | sudo tee -a /etc/default/webservice > /dev/null",
+		"sudo systemctl enable webservice && sudo systemctl restart webservice",
+		"curl -sS -o /dev/null http://127.0.0.1:8080/",
+	} {
+		if !strings.Contains(commands, expected) {
+			t.Errorf("Expected %q in commands: %s", expected, commands)
+		}
+	}
+
+	if strings.Contains(commands, "jetty") {
+		t.Errorf("Expected no Jetty in JAR mode: %s", commands)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package webservice
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// The distributions of Java that the webservice runs on
+const (
+	// OpenJdkDistribution installs the OpenJDK packages of Ubuntu
+	OpenJdkDistribution string = "openjdk"
+	// TemurinDistribution installs Eclipse Temurin, https://adoptium.net/
+	TemurinDistribution string = "temurin"
+	// CorrettoDistribution installs Amazon Corretto, https://aws.amazon.com/corretto/, which ships a JDK only
+	CorrettoDistribution string = "corretto"
+	// ZuluDistribution installs Azul Zulu, https://www.azul.com/downloads/
+	ZuluDistribution string = "zulu"
+)
+
+// The packages of a distribution
+const (
+	JrePackage string = "jre"
+	JdkPackage string = "jdk"
+)
+
+// The strategies installing Java in remote machine
+const (
+	// PackageJavaInstall installs the apt package of the distribution from its repository
+	PackageJavaInstall string = "package"
+	// TarballJavaInstall installs the binary tarball of the distribution, verified against its published SHA-256 checksum
+	TarballJavaInstall string = "tarball"
+)
+
+// DEFAULT_JAVA_VERSION Default major version of Java
+const DEFAULT_JAVA_VERSION string = "17"
+
+// DEFAULT_JAVA_DISTRIBUTION Default distribution of Java
+const DEFAULT_JAVA_DISTRIBUTION string = OpenJdkDistribution
+
+// MIN_JAVA_VERSION The oldest major version of Java supported
+const MIN_JAVA_VERSION int = 11
+
+const javaTarballDir string = "/usr/lib/jvm"
+const aptKeyringDir string = "/etc/apt/keyrings"
+
+var javaVersionPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// The apt repository of a distribution other than OpenJDK
+type aptRepository struct {
+	name string
+	key  string
+	url  string
+
+	// The suite of the repository; the codename of the Ubuntu release if empty
+	suite string
+}
+
+var aptRepositories = map[string]aptRepository{
+	// https://adoptium.net/installation/linux/
+	TemurinDistribution: {name: "adoptium", key: "https://packages.adoptium.net/artifactory/api/gpg/key/public", url: "https://packages.adoptium.net/artifactory/deb"},
+	// https://docs.aws.amazon.com/corretto/latest/corretto-17-ug/generic-linux-install.html
+	CorrettoDistribution: {name: "corretto", key: "https://apt.corretto.aws/corretto.key", url: "https://apt.corretto.aws", suite: "stable"},
+	// https://docs.azul.com/core/install/debian
+	ZuluDistribution: {name: "zulu", key: "https://repos.azul.com/azul-repo.key", url: "https://repos.azul.com/zulu/deb", suite: "stable"},
+}
+
+func (c Config) javaVersion() string {
+	if c.JavaVersion == "" {
+		return DEFAULT_JAVA_VERSION
+	}
+	return c.JavaVersion
+}
+
+func (c Config) javaDistribution() string {
+	if c.JavaDistribution == "" {
+		return DEFAULT_JAVA_DISTRIBUTION
+	}
+	return c.JavaDistribution
+}
+
+// Returns the package of the distribution, which is the JRE unless the distribution ships a JDK only
+func (c Config) javaPackage() string {
+	if c.JavaPackage != "" {
+		return c.JavaPackage
+	}
+	if c.javaDistribution() == CorrettoDistribution {
+		return JdkPackage
+	}
+	return JrePackage
+}
+
+func (c Config) javaInstall() string {
+	if c.JavaInstall == "" {
+		return PackageJavaInstall
+	}
+	return c.JavaInstall
+}
+
+// Returns an error if the version, distribution, package or strategy of Java is unknown, or if the distribution does not
+// offer the combination of them
+func (c Config) validateJava() error {
+	if !javaVersionPattern.MatchString(c.javaVersion()) {
+		return fmt.Errorf("invalid javaVersion '%s'; expected a major version, e.g. '17'", c.JavaVersion)
+	}
+	if version, _ := strconv.Atoi(c.javaVersion()); version < MIN_JAVA_VERSION {
+		return fmt.Errorf("javaVersion '%s' is not supported; the oldest supported version is %d", c.JavaVersion, MIN_JAVA_VERSION)
+	}
+
+	switch c.javaDistribution() {
+	case OpenJdkDistribution, TemurinDistribution, CorrettoDistribution, ZuluDistribution:
+	default:
+		return fmt.Errorf(
+			"unknown javaDistribution '%s'; supported distributions are '%s', '%s', '%s' and '%s'",
+			c.JavaDistribution, OpenJdkDistribution, TemurinDistribution, CorrettoDistribution, ZuluDistribution,
+		)
+	}
+
+	switch c.javaPackage() {
+	case JrePackage, JdkPackage:
+	default:
+		return fmt.Errorf("unknown javaPackage '%s'; supported packages are '%s' and '%s'", c.JavaPackage, JrePackage, JdkPackage)
+	}
+	if c.javaDistribution() == CorrettoDistribution && c.javaPackage() == JrePackage {
+		return fmt.Errorf("javaDistribution '%s' ships a JDK only; set javaPackage to '%s'", CorrettoDistribution, JdkPackage)
+	}
+
+	switch c.javaInstall() {
+	case PackageJavaInstall:
+	case TarballJavaInstall:
+		if c.javaDistribution() != TemurinDistribution && c.javaDistribution() != CorrettoDistribution {
+			return fmt.Errorf(
+				"javaInstall '%s' is only supported by the '%s' and '%s' javaDistribution",
+				TarballJavaInstall, TemurinDistribution, CorrettoDistribution,
+			)
+		}
+	default:
+		return fmt.Errorf("unknown javaInstall '%s'; supported strategies are '%s' and '%s'", c.JavaInstall, PackageJavaInstall, TarballJavaInstall)
+	}
+
+	return nil
+}
+
+// Returns the apt package of a version of a distribution
+func javaAptPackage(distribution string, version string, javaPackage string) string {
+	switch distribution {
+	case TemurinDistribution:
+		return fmt.Sprintf("temurin-%s-%s", version, javaPackage)
+	case CorrettoDistribution:
+		return fmt.Sprintf("java-%s-amazon-corretto-jdk", version)
+	case ZuluDistribution:
+		return fmt.Sprintf("zulu%s-ca-%s-headless", version, javaPackage)
+	default:
+		return fmt.Sprintf("openjdk-%s-%s-headless", version, javaPackage)
+	}
+}
+
+// Returns the commands installing a version of a Java distribution with a strategy.
+//
+// JAVA_HOME is exported for the rest of the provisioning and persisted system-wide in /etc/environment. The build fails
+// unless the installed Java is of the version
+func (c Config) getCommandsInstallingJava() []string {
+	var commands []string
+	if c.javaInstall() == TarballJavaInstall {
+		commands = getCommandsInstallingJavaTarball(c.javaDistribution(), c.javaVersion(), c.javaPackage())
+	} else {
+		commands = getCommandsInstallingJavaPackage(c.javaDistribution(), c.javaVersion(), c.javaPackage())
+	}
+
+	return append(
+		commands,
+		"JAVA_INSTALLED=$(\"$JAVA_HOME/bin/java\" -XshowSettings:properties -version 2>&1 | awk '/java.specification.version/ {print $3}')",
+		fmt.Sprintf(
+			"if [ \"$JAVA_INSTALLED\" != %s ]; then echo \"Expected Java %s, got $JAVA_INSTALLED\" >&2; exit 1; fi",
+			c.javaVersion(), c.javaVersion(),
+		),
+		"export PATH=$JAVA_HOME/bin:$PATH",
+		"sudo sed -i '/^JAVA_HOME=/d' /etc/environment && echo \"JAVA_HOME=$JAVA_HOME\" | sudo tee -a /etc/environment > /dev/null",
+	)
+}
+
+// Installs the apt package of a distribution, adding the repository of the distribution with its signing key if the
+// distribution is not OpenJDK. JAVA_HOME is the home of the package, regardless of other installed versions of Java,
+// and its java and keytool are made the defaults of the machine
+func getCommandsInstallingJavaPackage(distribution string, version string, javaPackage string) []string {
+	aptPackage := javaAptPackage(distribution, version, javaPackage)
+
+	commands := []string{"sudo apt update -y"}
+	if repository, ok := aptRepositories[distribution]; ok {
+		keyring := fmt.Sprintf("%s/%s.gpg", aptKeyringDir, repository.name)
+		suite := repository.suite
+		if suite == "" {
+			suite = "$(. /etc/os-release && echo $VERSION_CODENAME)"
+		}
+
+		commands = append(
+			commands,
+			"sudo apt install -y curl gnupg ca-certificates",
+			fmt.Sprintf("sudo mkdir -p %s && curl -fsSL %s | sudo gpg --batch --yes --dearmor -o %s", aptKeyringDir, repository.key, keyring),
+			fmt.Sprintf(
+				"echo \"deb [signed-by=%s] %s %s main\" | sudo tee /etc/apt/sources.list.d/%s.list > /dev/null",
+				keyring, repository.url, suite, repository.name,
+			),
+			"sudo apt update -y",
+		)
+	}
+
+	return append(
+		commands,
+		fmt.Sprintf("sudo apt install -y %s", aptPackage),
+		fmt.Sprintf("export JAVA_HOME=$(dirname $(dirname $(dpkg -L %s | grep '/bin/java$' | head -n 1)))", aptPackage),
+		"for tool in java keytool; do sudo update-alternatives --set $tool $JAVA_HOME/bin/$tool; done",
+	)
+}
+
+// Downloads the tarball of the current architecture and verifies it against the SHA-256 checksum published next to it.
+// Java is installed into a versioned directory, whose binaries are linked into /usr/local/bin, so that they are on the
+// PATH of every user
+func getCommandsInstallingJavaTarball(distribution string, version string, javaPackage string) []string {
+	javaHome := fmt.Sprintf("%s/%s-%s-%s", javaTarballDir, distribution, version, javaPackage)
+
+	var commands []string
+	if distribution == CorrettoDistribution {
+		tarball := fmt.Sprintf("amazon-corretto-%s-$JAVA_ARCH-linux-jdk.tar.gz", version)
+		commands = []string{
+			fmt.Sprintf("JAVA_TARBALL_URL=https://corretto.aws/downloads/latest/%s", tarball),
+			fmt.Sprintf("JAVA_TARBALL_SHA256=$(curl -fsSL https://corretto.aws/downloads/latest_sha256/%s)", tarball),
+		}
+	} else {
+		// The API redirects to the release asset on GitHub, next to which the checksum is published
+		commands = []string{
+			fmt.Sprintf(
+				"JAVA_TARBALL_URL=$(curl -fsS -o /dev/null -w '%%{redirect_url}' https://api.adoptium.net/v3/binary/latest/%s/ga/linux/$JAVA_ARCH/%s/hotspot/normal/eclipse)",
+				version, javaPackage,
+			),
+			fmt.Sprintf("if [ -z \"$JAVA_TARBALL_URL\" ]; then echo \"No Temurin %s tarball for $JAVA_ARCH\" >&2; exit 1; fi", version),
+			"JAVA_TARBALL_SHA256=$(curl -fsSL $JAVA_TARBALL_URL.sha256.txt | awk '{print $1}')",
+		}
+	}
+
+	commands = append(
+		[]string{
+			"sudo apt install -y curl",
+			"JAVA_ARCH=$(dpkg --print-architecture | sed -e 's/^amd64$/x64/' -e 's/^arm64$/aarch64/')",
+		},
+		commands...,
+	)
+	return append(
+		commands,
+		"cd /tmp && curl -fsSL -o java.tar.gz $JAVA_TARBALL_URL && echo \"$JAVA_TARBALL_SHA256  java.tar.gz\" | sha256sum -c -",
+		fmt.Sprintf("export JAVA_HOME=%s", javaHome),
+		"sudo rm -rf $JAVA_HOME && sudo mkdir -p $JAVA_HOME && sudo tar -xzf java.tar.gz -C $JAVA_HOME --strip-components=1 --no-same-owner",
+		"rm java.tar.gz && cd -",
+		"sudo ln -sf $JAVA_HOME/bin/* /usr/local/bin/",
+	)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package webservice
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateJava(t *testing.T) {
+	war := "my-webservice.war"
+
+	data := []struct {
+		name   string
+		config Config
+		error  string
+	}{
+		{"defaults", Config{WarSource: war}, ""},
+		{"Temurin 21 tarball", Config{WarSource: war, JavaVersion: "21", JavaDistribution: TemurinDistribution, JavaInstall: TarballJavaInstall}, ""},
+		{"Corretto", Config{WarSource: war, JavaDistribution: CorrettoDistribution}, ""},
+		{"Zulu JDK", Config{WarSource: war, JavaVersion: "11", JavaDistribution: ZuluDistribution, JavaPackage: JdkPackage}, ""},
+		{"exact version", Config{WarSource: war, JavaVersion: "17.0.9"}, "invalid javaVersion"},
+		{"Java 8", Config{WarSource: war, JavaVersion: "8"}, "oldest supported version is 11"},
+		{"unknown distribution", Config{WarSource: war, JavaDistribution: "oracle"}, "unknown javaDistribution"},
+		{"unknown package", Config{WarSource: war, JavaPackage: "jmods"}, "unknown javaPackage"},
+		{"Corretto JRE", Config{WarSource: war, JavaDistribution: CorrettoDistribution, JavaPackage: JrePackage}, "ships a JDK only"},
+		{"OpenJDK tarball", Config{WarSource: war, JavaInstall: TarballJavaInstall}, "only supported by the 'temurin' and 'corretto'"},
+		{"unknown strategy", Config{WarSource: war, JavaInstall: "sdkman"}, "unknown javaInstall"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			err := d.config.validate()
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func Test_getCommandsInstallingJava(t *testing.T) {
+	actualCommands := Config{}.getCommandsInstallingJava()
+
+	expectedCommands := []string{
+		"sudo apt update -y",
+		"sudo apt install -y openjdk-17-jre-headless",
+		"export JAVA_HOME=$(dirname $(dirname $(dpkg -L openjdk-17-jre-headless | grep '/bin/java$' | head -n 1)))",
+		"for tool in java keytool; do sudo update-alternatives --set $tool $JAVA_HOME/bin/$tool; done",
+		"JAVA_INSTALLED=$(\"$JAVA_HOME/bin/java\" -XshowSettings:properties -version 2>&1 | awk '/java.specification.version/ {print $3}')",
+		"if [ \"$JAVA_INSTALLED\" != 17 ]; then echo \"Expected Java 17, got $JAVA_INSTALLED\" >&2; exit 1; fi",
+		"export PATH=$JAVA_HOME/bin:$PATH",
+		"sudo sed -i '/^JAVA_HOME=/d' /etc/environment && echo \"JAVA_HOME=$JAVA_HOME\" | sudo tee -a /etc/environment > /dev/null",
+	}
+
+	if !reflect.DeepEqual(expectedCommands, actualCommands) {
+		t.Errorf("Expected and actual commands do not match: %s\n\n%s", expectedCommands, actualCommands)
+	}
+}
+
+// Runs the version check of the installed Java with a JAVA_HOME whose java prints the properties of Java 17
+func Test_getCommandsInstallingJavaVersionCheck(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	javaHome := t.TempDir()
+	if err := os.Mkdir(filepath.Join(javaHome, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	java := "#!/bin/sh\necho 'Property settings:' >&2\necho '    java.specification.version = 17' >&2\n"
+	if err := os.WriteFile(filepath.Join(javaHome, "bin", "java"), []byte(java), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []struct {
+		javaVersion string
+		error       string
+	}{
+		{"17", ""},
+		{"21", "Expected Java 21, got 17"},
+	}
+
+	for _, d := range data {
+		t.Run("Java "+d.javaVersion, func(t *testing.T) {
+			var check []string
+			for _, command := range (Config{JavaVersion: d.javaVersion}).getCommandsInstallingJava() {
+				if strings.Contains(command, "JAVA_INSTALLED") {
+					check = append(check, command)
+				}
+			}
+
+			var stderr strings.Builder
+			cmd := exec.Command("bash", "-c", strings.Join(append([]string{"set -e", "JAVA_HOME=" + javaHome}, check...), "\n"))
+			cmd.Stderr = &stderr
+			err := cmd.Run()
+
+			if d.error == "" && err != nil {
+				t.Errorf("Expected the check to pass, got %s: %s", err, stderr.String())
+			}
+			if d.error != "" && (err == nil || !strings.Contains(stderr.String(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v: %s", d.error, err, stderr.String())
+			}
+		})
+	}
+}
+
+func Test_getCommandsInstallingJavaDistributions(t *testing.T) {
+	data := []struct {
+		name     string
+		config   Config
+		expected []string
+	}{
+		{
+			"Temurin",
+			Config{JavaVersion: "21", JavaDistribution: TemurinDistribution},
+			[]string{
+				"curl -fsSL https://packages.adoptium.net/artifactory/api/gpg/key/public | sudo gpg --batch --yes --dearmor -o /etc/apt/keyrings/adoptium.gpg",
+				"echo \"deb [signed-by=/etc/apt/keyrings/adoptium.gpg] https://packages.adoptium.net/artifactory/deb $(. /etc/os-release && echo $VERSION_CODENAME) main\"",
+				"sudo apt install -y temurin-21-jre\n",
+			},
+		},
+		{
+			"Corretto",
+			Config{JavaDistribution: CorrettoDistribution},
+			[]string{"https://apt.corretto.aws stable main", "sudo apt install -y java-17-amazon-corretto-jdk\n"},
+		},
+		{
+			"Zulu",
+			Config{JavaVersion: "11", JavaDistribution: ZuluDistribution},
+			[]string{"https://repos.azul.com/zulu/deb stable main", "sudo apt install -y zulu11-ca-jre-headless\n"},
+		},
+		{
+			"Temurin tarball",
+			Config{JavaVersion: "21", JavaDistribution: TemurinDistribution, JavaInstall: TarballJavaInstall},
+			[]string{
+				"https://api.adoptium.net/v3/binary/latest/21/ga/linux/$JAVA_ARCH/jre/hotspot/normal/eclipse",
+				"JAVA_TARBALL_SHA256=$(curl -fsSL $JAVA_TARBALL_URL.sha256.txt | awk '{print $1}')",
+				"echo \"$JAVA_TARBALL_SHA256  java.tar.gz\" | sha256sum -c -",
+				"export JAVA_HOME=/usr/lib/jvm/temurin-21-jre\n",
+				"sudo ln -sf $JAVA_HOME/bin/* /usr/local/bin/",
+			},
+		},
+		{
+			"Corretto tarball",
+			Config{JavaDistribution: CorrettoDistribution, JavaInstall: TarballJavaInstall},
+			[]string{
+				"JAVA_TARBALL_URL=https://corretto.aws/downloads/latest/amazon-corretto-17-$JAVA_ARCH-linux-jdk.tar.gz",
+				"JAVA_TARBALL_SHA256=$(curl -fsSL https://corretto.aws/downloads/latest_sha256/amazon-corretto-17-$JAVA_ARCH-linux-jdk.tar.gz)",
+				"export JAVA_HOME=/usr/lib/jvm/corretto-17-jdk\n",
+			},
+		},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			commands := strings.Join(d.config.getCommandsInstallingJava(), "\n")
+			for _, expected := range d.expected {
+				if !strings.Contains(commands, expected) {
+					t.Errorf("Expected %q in commands: %s", expected, commands)
+				}
+			}
+		})
+	}
+}
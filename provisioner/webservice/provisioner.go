@@ -11,17 +11,86 @@ import (
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/file-provisioner"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/shell"
 	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/systemd"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
+// DEFAULT_JETTY_HTTP_PORT Default port that Jetty serves HTTP on
+const DEFAULT_JETTY_HTTP_PORT string = "8080"
+
+// DEFAULT_JETTY_HTTPS_PORT Default port that Jetty serves HTTPS on
+const DEFAULT_JETTY_HTTPS_PORT string = "8443"
+
+// SERVICE_NAME The name of the systemd service running Jetty
+const SERVICE_NAME string = "jetty"
+
+// SERVICE_USER The dedicated system user running Jetty
+const SERVICE_USER string = "jetty"
+
+// JETTY_HOME The directory in remote machine that the Jetty distribution is installed to
+const JETTY_HOME string = "/opt/jetty-home"
+
+// JETTY_BASE The directory in remote machine holding the configuration and the webapp of Jetty
+const JETTY_BASE string = "/opt/jetty-base"
+
+// DEFAULT_JVM_OPTIONS Default options of the JVM running Jetty. The heap grows up to 75% of the memory of the machine,
+// and the JVM exits on OutOfMemoryError, so that systemd restarts it instead of keeping a broken webservice running
+var DEFAULT_JVM_OPTIONS = []string{"-XX:MaxRAMPercentage=75.0", "-XX:+UseG1GC", "-XX:+ExitOnOutOfMemoryError"}
+
+const keystoreAlias string = "jetty"
+const keystoreCertFilename string = "keystore.crt"
+const keystoreKeyFilename string = "keystore.key"
+const keystorePasswordFilename string = "keystore.password"
+const jettySslIniFilename string = "jetty-ssl.ini"
+
+// The directory in remote machine that the staged key and password of the keystore are installed into, readable by the
+// group of the SSH user, which creates the keystore. It lives on the tmpfs of /run, like ssl.PrivateStagingDir
+const keystoreWorkDir string = "/run/qubitpi-keystore"
+const serviceFilename string = SERVICE_NAME + ".service"
+
 type Config struct {
-	WarSource string `mapstructure:"warSource" required:"true"`
+	WarSource string `mapstructure:"warSource" required:"false"`
 	HomeDir   string `mapstructure:"homeDir" required:"false"`
 
+	JarSource         string            `mapstructure:"jarSource" required:"false"`
+	JarHttpPort       string            `mapstructure:"jarHttpPort" required:"false"`
+	ApplicationConfig string            `mapstructure:"applicationConfig" required:"false"`
+	Environment       map[string]string `mapstructure:"environment" required:"false"`
+
+	JavaVersion      string `mapstructure:"javaVersion" required:"false"`
+	JavaDistribution string `mapstructure:"javaDistribution" required:"false"`
+	JavaPackage      string `mapstructure:"javaPackage" required:"false"`
+	JavaInstall      string `mapstructure:"javaInstall" required:"false"`
+
+	ServletContainer string   `mapstructure:"servletContainer" required:"false"`
+	JettyVersion     string   `mapstructure:"jettyVersion" required:"false"`
+	JettyModules     []string `mapstructure:"jettyModules" required:"false"`
+	TomcatVersion    string   `mapstructure:"tomcatVersion" required:"false"`
+	TomcatHttpPort   string   `mapstructure:"tomcatHttpPort" required:"false"`
+
+	JettyHttpPort string   `mapstructure:"jettyHttpPort" required:"false"`
+	JvmOptions    []string `mapstructure:"jvmOptions" required:"false"`
+
+	SslCertBase64    string `mapstructure:"sslCertBase64" required:"false"`
+	SslCertKeyBase64 string `mapstructure:"sslCertKeyBase64" required:"false"`
+	KeystoreType     string `mapstructure:"keystoreType" required:"false"`
+	KeystorePassword string `mapstructure:"keystorePassword" required:"false"`
+	JettyHttps       bool   `mapstructure:"jettyHttps" required:"false"`
+	JettyHttpsPort   string `mapstructure:"jettyHttpsPort" required:"false"`
+
+	TrustedCaBase64 string `mapstructure:"trustedCaBase64" required:"false"`
+
+	WebserviceDomain string   `mapstructure:"webserviceDomain" required:"false"`
+	PrivatePaths     []string `mapstructure:"privatePaths" required:"false"`
+
+	ssl.Config `mapstructure:",squash"`
+
 	ctx interpolate.Context
 }
 
@@ -39,29 +108,294 @@ func (p *Provisioner) Prepare(raws ...interface{}) error {
 		return err
 	}
 
-	return nil
+	return p.config.validate()
+}
+
+// Returns an error if the webservice, Java, servlet container, keystore, truststore or TLS front end settings are incomplete or invalid
+func (c Config) validate() error {
+	if err := c.validateMode(); err != nil {
+		return err
+	}
+	if err := c.validateJava(); err != nil {
+		return err
+	}
+	if err := c.validateContainer(); err != nil {
+		return err
+	}
+
+	if (c.SslCertBase64 == "") != (c.SslCertKeyBase64 == "") {
+		return fmt.Errorf("sslCertBase64 and sslCertKeyBase64 must be configured together")
+	}
+
+	if c.keystore() {
+		if err := ssl.ValidateKeystore(c.KeystoreType, c.KeystorePassword); err != nil {
+			return err
+		}
+	} else if c.JettyHttps {
+		return fmt.Errorf("jettyHttps requires sslCertBase64 and sslCertKeyBase64")
+	}
+
+	if port, err := strconv.Atoi(c.jettyHttpPort()); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid jettyHttpPort '%s'", c.JettyHttpPort)
+	}
+	if port, err := strconv.Atoi(c.jarHttpPort()); err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid jarHttpPort '%s'", c.JarHttpPort)
+	}
+	if c.JettyHttps && c.jettyHttpPort() == c.jettyHttpsPort() {
+		return fmt.Errorf("jettyHttpPort and jettyHttpsPort must differ")
+	}
+	for _, option := range c.JvmOptions {
+		if !strings.HasPrefix(option, "-") {
+			return fmt.Errorf("invalid jvmOption '%s'; JVM options start with '-'", option)
+		}
+	}
+
+	if c.TrustedCaBase64 != "" {
+		if _, err := c.trustedCas(); err != nil {
+			return err
+		}
+	}
+
+	return c.validateFrontend()
+}
+
+func (c Config) trustedCas() ([]string, error) {
+	bundle, err := ssl.DecodeBase64(c.TrustedCaBase64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trustedCaBase64: %s", err)
+	}
+
+	cas, err := ssl.SplitCertificates(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trustedCaBase64: %s", err)
+	}
+
+	return cas, nil
+}
+
+func (c Config) keystoreType() string {
+	if c.KeystoreType == "" {
+		return ssl.DefaultKeystoreType
+	}
+	return c.KeystoreType
+}
+
+func (c Config) jettyHttpPort() string {
+	if c.JettyHttpPort == "" {
+		return DEFAULT_JETTY_HTTP_PORT
+	}
+	return c.JettyHttpPort
+}
+
+func (c Config) jvmOptions() []string {
+	if c.JvmOptions == nil {
+		return DEFAULT_JVM_OPTIONS
+	}
+	return c.JvmOptions
+}
+
+func (c Config) jettyHttpsPort() string {
+	if c.JettyHttpsPort == "" {
+		return DEFAULT_JETTY_HTTPS_PORT
+	}
+	return c.JettyHttpsPort
 }
 
 func (p *Provisioner) Provision(ctx context.Context, ui packersdk.Ui, communicator packersdk.Communicator, generatedData map[string]interface{}) error {
 	p.config.HomeDir = ssl.GetHomeDir(p.config.HomeDir)
 
-	warFileDst := fmt.Sprintf(filepath.Join(p.config.HomeDir, "ROOT.war"))
+	err := p.uploadWebservice(ui, communicator)
+	if err != nil {
+		return err
+	}
+
+	uploads, err := p.config.getUploads()
+	if err != nil {
+		return err
+	}
+	for filename, content := range uploads {
+		err = ssl.Upload(p.config.ctx, ui, communicator, content, filepath.Join(p.config.HomeDir, filename))
+		if err != nil {
+			return err
+		}
+	}
+
+	privateUploads, err := p.config.getPrivateUploads()
+	if err != nil {
+		return err
+	}
+	for filename, content := range privateUploads {
+		err = ssl.UploadPrivate(ctx, ui, communicator, content, filename)
+		if err != nil {
+			return err
+		}
+	}
 
-	err := file.Provision(p.config.ctx, ui, communicator, p.config.WarSource, warFileDst)
+	trustedCas, err := p.config.trustedCaCount()
 	if err != nil {
 		return err
 	}
 
-	return shell.Provision(ctx, ui, communicator, getCommands(p.config.HomeDir))
+	err = shell.Provision(ctx, ui, communicator, getCommands(p.config, trustedCas))
+	if err != nil || !p.config.frontend() {
+		return err
+	}
+
+	nginxConfig, err := p.config.NginxConfig(p.config.WebserviceDomain, p.config.httpPort(), p.config.getNginxConfig())
+	if err != nil {
+		return err
+	}
+
+	// The key staged for the keystore is kept for the front end
+	sslCertKeyBase64 := p.config.SslCertKeyBase64
+	if p.config.keystore() {
+		sslCertKeyBase64 = ""
+	}
+
+	return ssl.Provision(
+		ctx,
+		p.config.ctx,
+		ui,
+		communicator,
+		p.config.HomeDir,
+		ssl.Owner("webservice-provisioner", generatedData),
+		p.config.WebserviceDomain,
+		p.config.SslCertBase64,
+		sslCertKeyBase64,
+		p.config.Config,
+		nginxConfig,
+	)
 }
 
-func getCommands(homeDir string) []string {
-	return append(
-		getCommandsUpdatingUbuntu(),
-		append(getCommandsInstallingJDK17(), getCommandsInstallingJetty(homeDir)...)...,
+// Uploads the WAR file, or the fat JAR together with its application config, to the home directory
+func (p *Provisioner) uploadWebservice(ui packersdk.Ui, communicator packersdk.Communicator) error {
+	if !p.config.jarMode() {
+		return file.Provision(p.config.ctx, ui, communicator, p.config.WarSource, filepath.Join(p.config.HomeDir, "ROOT.war"))
+	}
+
+	err := file.Provision(p.config.ctx, ui, communicator, p.config.JarSource, filepath.Join(p.config.HomeDir, jarFilename))
+	if err != nil || p.config.ApplicationConfig == "" {
+		return err
+	}
+
+	return file.Provision(
+		p.config.ctx,
+		ui,
+		communicator,
+		p.config.ApplicationConfig,
+		filepath.Join(p.config.HomeDir, p.config.applicationConfigFilename()),
 	)
 }
 
+// Returns the contents of the files, other than the WAR file or the fat JAR, uploaded to the home directory by their file
+// names, i.e. the unit of the Jetty or Tomcat service, or the unit and environment file of the fat JAR service, the
+// certificate of the keystore, and the trusted CA certificates
+func (c Config) getUploads() (map[string]string, error) {
+	uploads := map[string]string{serviceFilename: getService(c.httpHost(), c.jettyHttpPort(), c.jvmOptions()).Render()}
+	if c.jarMode() {
+		uploads = map[string]string{
+			jarServiceFilename:     getJarService(c.httpHost(), c.jarHttpPort(), c.jvmOptions()).Render(),
+			jarEnvironmentFilename: getJarEnvironmentFile(c.Environment),
+		}
+	} else if c.tomcat() {
+		uploads = map[string]string{tomcatServiceFilename: getTomcatService(c.jvmOptions()).Render()}
+	}
+
+	if c.keystore() {
+		sslCert, err := ssl.DecodeBase64(c.SslCertBase64)
+		if err != nil {
+			return nil, err
+		}
+		uploads[keystoreCertFilename] = sslCert
+	}
+
+	if c.TrustedCaBase64 != "" {
+		cas, err := c.trustedCas()
+		if err != nil {
+			return nil, err
+		}
+		for i, ca := range cas {
+			uploads[trustedCaFilename(i)] = ca
+		}
+	}
+
+	return uploads, nil
+}
+
+// Returns the contents of the files streamed into ssl.PrivateStagingDir by their file names, i.e. the key and password of
+// the keystore and the keystore settings of Jetty, which contain the password. The key is staged under the name of the
+// key of the front end, which reuses it
+func (c Config) getPrivateUploads() (map[string]string, error) {
+	if !c.keystore() {
+		return nil, nil
+	}
+
+	sslCertKey, err := ssl.DecodeBase64(c.SslCertKeyBase64)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads := map[string]string{
+		ssl.StagedSslCertKeyFilename: sslCertKey,
+		keystorePasswordFilename:     c.KeystorePassword,
+	}
+	if c.JettyHttps {
+		uploads[jettySslIniFilename] = getJettySslIni(c.jettyHttpsPort(), c.keystoreType(), c.KeystorePassword)
+	}
+	return uploads, nil
+}
+
+func (c Config) trustedCaCount() (int, error) {
+	if c.TrustedCaBase64 == "" {
+		return 0, nil
+	}
+
+	cas, err := c.trustedCas()
+	return len(cas), err
+}
+
+func trustedCaFilename(i int) string {
+	return fmt.Sprintf("trusted-ca-%d.crt", i)
+}
+
+// Returns all commands installing Java and the webservice, which is either the WAR file deployed to Jetty or Tomcat, or
+// the fat JAR running on its own
+func getCommands(config Config, trustedCas int) []string {
+	commands := append(getCommandsUpdatingUbuntu(), config.getCommandsInstallingJava()...)
+
+	baseDir, alias := JETTY_BASE, keystoreAlias
+	switch {
+	case config.jarMode():
+		baseDir, alias = JAR_APP_DIR, jarKeystoreAlias
+		commands = append(commands, getCommandsPreparingJarDir(config.HomeDir)...)
+	case config.tomcat():
+		baseDir, alias = TOMCAT_HOME, tomcatKeystoreAlias
+		commands = append(
+			commands,
+			getCommandsInstallingTomcat(config.HomeDir, config.tomcatVersion(), config.httpHost(), config.tomcatHttpPort())...,
+		)
+	default:
+		commands = append(commands, getCommandsInstallingJetty(config.HomeDir, config.jettyRelease(), config.jettyModules())...)
+	}
+
+	if config.keystore() {
+		commands = append(commands, getCommandsCreatingKeystore(config.HomeDir, config.keystoreType(), baseDir, alias, config.frontend())...)
+		if config.JettyHttps {
+			commands = append(commands, getCommandsEnablingJettyHttps(config.HomeDir, config.jettyRelease())...)
+		}
+	}
+
+	commands = append(commands, getCommandsImportingTrustedCas(config.HomeDir, trustedCas)...)
+	switch {
+	case config.jarMode():
+		return append(commands, getCommandsInstallingJarService(config.HomeDir, config.jarHttpPort(), config.applicationConfigFilename())...)
+	case config.tomcat():
+		return append(commands, getCommandsInstallingTomcatService(config.HomeDir, config.tomcatHttpPort())...)
+	default:
+		return append(commands, getCommandsInstallingService(config.HomeDir, config.jettyHttpPort())...)
+	}
+}
+
 func getCommandsUpdatingUbuntu() []string {
 	return []string{
 		"sudo apt update && sudo apt upgrade -y",
@@ -69,27 +403,184 @@ func getCommandsUpdatingUbuntu() []string {
 	}
 }
 
-// Install JDK 17 - https://www.rosehosting.com/blog/how-to-install-java-17-lts-on-ubuntu-20-04/
-func getCommandsInstallingJDK17() []string {
+// Install and configure a release of Jetty container with a list of modules. The distribution, which is verified against
+// its checksum on Maven Central, is installed to JETTY_HOME and the base to JETTY_BASE, which is set up by the current
+// user and handed over to SERVICE_USER by getCommandsInstallingService(). The start.d directory is created upfront, so
+// that Jetty 9 writes the module settings there instead of into start.ini, as later releases do
+func getCommandsInstallingJetty(homeDir string, release jettyRelease, modules []string) []string {
+	tarballUrl := fmt.Sprintf(
+		"%s/org/eclipse/jetty/%s/%s/%s-%s.tar.gz",
+		mavenCentralUrl,
+		release.artifact,
+		release.version,
+		release.artifact,
+		release.version,
+	)
+
 	return []string{
-		"sudo apt update -y",
-		"sudo apt install openjdk-17-jdk -y",
-		"export JAVA_HOME=/usr/lib/jvm/java-17-openjdk-amd64",
+		"sudo apt install -y curl",
+		fmt.Sprintf("JETTY_TARBALL_SHA1=$(curl -fsSL %s.sha1 | awk '{print $1}')", tarballUrl),
+		fmt.Sprintf("cd /tmp && curl -fsSL -o jetty.tar.gz %s && echo \"$JETTY_TARBALL_SHA1  jetty.tar.gz\" | sha1sum -c -", tarballUrl),
+		fmt.Sprintf(
+			"sudo rm -rf %s && sudo mkdir -p %s && sudo tar -xzf jetty.tar.gz -C %s --strip-components=1 --no-same-owner",
+			JETTY_HOME,
+			JETTY_HOME,
+			JETTY_HOME,
+		),
+		"rm jetty.tar.gz",
+		fmt.Sprintf("export JETTY_HOME=%s", JETTY_HOME),
+		fmt.Sprintf("sudo rm -rf %s && sudo mkdir -p %s && sudo chown $(id -un) %s", JETTY_BASE, JETTY_BASE, JETTY_BASE),
+		fmt.Sprintf("cd %s && mkdir -p start.d webapps", JETTY_BASE),
+		fmt.Sprintf("java -jar $JETTY_HOME/start.jar %s=%s", release.addModuleOption, strings.Join(modules, ",")),
+		fmt.Sprintf("mv %s/ROOT.war webapps/ROOT.war", homeDir),
+		fmt.Sprintf("cd %s", homeDir),
+	}
+}
+
+// Returns the systemd service running Jetty at boot as SERVICE_USER with the JVM options, on an HTTP port bound to a
+// host, or to all interfaces if the host is empty.
+//
+// systemd does not expand variables in the path of a command, so the java of JAVA_HOME, which the environment file
+// sets, is started through the shell
+func getService(httpHost string, httpPort string, jvmOptions []string) systemd.Service {
+	args := []string{"/bin/sh", "-c", `exec "$JAVA_HOME/bin/java" "$@"`, "java"}
+	args = append(args, jvmOptions...)
+	args = append(
+		args,
+		"-Djava.io.tmpdir="+filepath.Join(JETTY_BASE, "work"),
+		"-jar", filepath.Join(JETTY_HOME, "start.jar"),
+		"jetty.home="+JETTY_HOME,
+		"jetty.base="+JETTY_BASE,
+		"-Djetty.http.port="+httpPort,
+	)
+	if httpHost != "" {
+		args = append(args, "-Djetty.http.host="+httpHost)
+	}
+
+	return systemd.Service{
+		Description:      "Jetty webservice",
+		After:            []string{"network-online.target"},
+		User:             SERVICE_USER,
+		Group:            SERVICE_USER,
+		WorkingDirectory: JETTY_BASE,
+		EnvironmentFiles: []string{systemd.EnvironmentFileDst(SERVICE_NAME)},
+		ExecStart:        systemd.ExecArgs(args...),
+		Restart:          "always",
+		RestartSec:       "5",
+		Directives: [][2]string{
+			{"NoNewPrivileges", "true"},
+			{"ProtectSystem", "full"},
+			{"ProtectHome", "true"},
+			{"PrivateTmp", "true"},
+		},
+	}
+}
+
+// Returns the commands handing JETTY_BASE over to SERVICE_USER and starting the service running Jetty. JAVA_HOME of the
+// installed JDK is written to the environment file of the service. The build fails unless Jetty answers on its port,
+// with any status, since the webservice may have no resource at "/"
+func getCommandsInstallingService(homeDir string, httpPort string) []string {
+	environmentFile := systemd.EnvironmentFileDst(SERVICE_NAME)
+
+	commands := systemd.CommandsCreatingUser(SERVICE_USER)
+	commands = append(
+		commands,
+		fmt.Sprintf("mkdir -p %s", filepath.Join(JETTY_BASE, "work")),
+		fmt.Sprintf("sudo chown -R %s:%s %s", SERVICE_USER, SERVICE_USER, JETTY_BASE),
+		fmt.Sprintf("echo \"JAVA_HOME=$JAVA_HOME\" | sudo tee %s > /dev/null", environmentFile),
+	)
+	commands = append(commands, systemd.CommandsInstallingUnit(filepath.Join(homeDir, serviceFilename), SERVICE_NAME)...)
+	commands = append(commands, systemd.CommandsStartingService(SERVICE_NAME)...)
+	return append(commands, systemd.CommandsCheckingReachable(SERVICE_NAME, "http://127.0.0.1:"+httpPort+"/")...)
+}
+
+// Returns the path of the keystore in remote machine relative to JETTY_BASE, TOMCAT_HOME or JAR_APP_DIR
+func keystorePath(keystoreType string) string {
+	return "etc/keystore." + ssl.KeystoreExtension(keystoreType)
+}
+
+// Converts the uploaded certificate and the staged key into the keystore of Jetty, Tomcat or the fat JAR, under a base
+// directory with an alias. The staged key and password are installed into keystoreWorkDir for the SSH user, and all of
+// them are shredded afterwards, except for the staged key if the front end reuses it. The cleanup also runs when the
+// script exits, next to the other cleanups of the script, so that nothing is left behind if the conversion fails
+func getCommandsCreatingKeystore(homeDir string, keystoreType string, baseDir string, alias string, keepStagedKey bool) []string {
+	certPath := filepath.Join(homeDir, keystoreCertFilename)
+	keyPath := filepath.Join(keystoreWorkDir, keystoreKeyFilename)
+	passwordPath := filepath.Join(keystoreWorkDir, keystorePasswordFilename)
+	stagedKey := ssl.PrivateStagingPath(ssl.StagedSslCertKeyFilename)
+	stagedPassword := ssl.PrivateStagingPath(keystorePasswordFilename)
+
+	installKey := ssl.CommandInstallingPrivateFile(stagedKey, keyPath, "$(id -gn)", "640")
+	if keepStagedKey {
+		installKey = fmt.Sprintf("sudo install -o root -g $(id -gn) -m 640 %s %s", stagedKey, keyPath)
 	}
+
+	return append(
+		append(
+			[]string{
+				shell.CommandCleaningUpOnExit(
+					fmt.Sprintf(
+						"shred -u -f %s 2>/dev/null; sudo shred -u -f %s %s %s 2>/dev/null; sudo rm -rf %s",
+						certPath, keyPath, passwordPath, stagedPassword, keystoreWorkDir,
+					),
+				),
+				fmt.Sprintf("sudo install -d -o root -g $(id -gn) -m 750 %s", keystoreWorkDir),
+				installKey,
+				ssl.CommandInstallingPrivateFile(stagedPassword, passwordPath, "$(id -gn)", "640"),
+			},
+			ssl.CommandsCreatingKeystore(
+				keystoreType,
+				certPath,
+				keyPath,
+				passwordPath,
+				filepath.Join(baseDir, keystorePath(keystoreType)),
+				alias,
+			)...,
+		),
+		fmt.Sprintf("shred -u %s && sudo shred -u %s %s && sudo rm -rf %s", certPath, keyPath, passwordPath, keystoreWorkDir),
+	)
 }
 
-// Install and configure Jetty (for JDK 17) container
-func getCommandsInstallingJetty(homeDir string) []string {
+// Enables the "ssl" and "https" modules of Jetty and appends the staged keystore settings to the generated ssl.ini, which
+// is only readable by the current user, since it contains the keystore password. The staged settings are shredded when
+// the script exits, if they are still there
+func getCommandsEnablingJettyHttps(homeDir string, release jettyRelease) []string {
+	sslIni := ssl.PrivateStagingPath(jettySslIniFilename)
+
 	return []string{
-		"export JETTY_VERSION=11.0.15",
-		"wget https://repo1.maven.org/maven2/org/eclipse/jetty/jetty-home/$JETTY_VERSION/jetty-home-$JETTY_VERSION.tar.gz",
-		"tar -xzvf jetty-home-$JETTY_VERSION.tar.gz",
-		"rm jetty-home-$JETTY_VERSION.tar.gz",
-		fmt.Sprintf("export JETTY_HOME=%s/jetty-home-$JETTY_VERSION", homeDir),
-		"mkdir jetty-base",
-		"cd jetty-base",
-		"java -jar $JETTY_HOME/start.jar --add-module=annotations,server,http,deploy,servlet,webapp,resources,jsp",
-		fmt.Sprintf("mv %s/ROOT.war webapps/ROOT.war", homeDir),
-		"cd ../",
+		shell.CommandCleaningUpOnExit(fmt.Sprintf("sudo shred -u -f %s 2>/dev/null", sslIni)),
+		fmt.Sprintf("cd %s", JETTY_BASE),
+		fmt.Sprintf("java -jar $JETTY_HOME/start.jar %s=ssl,https", release.addModuleOption),
+		fmt.Sprintf("sudo cat %s >> start.d/ssl.ini && sudo shred -u %s", sslIni, sslIni),
+		"chmod 600 start.d/ssl.ini",
+		fmt.Sprintf("cd %s", homeDir),
+	}
+}
+
+// Returns the Jetty properties pointing the "ssl" module at the keystore and setting the HTTPS port
+func getJettySslIni(port string, keystoreType string, password string) string {
+	return strings.Join(
+		[]string{
+			"",
+			"jetty.ssl.port=" + port,
+			"jetty.sslContext.keyStorePath=" + keystorePath(keystoreType),
+			"jetty.sslContext.keyStoreType=" + keystoreType,
+			"jetty.sslContext.keyStorePassword=" + password,
+			"jetty.sslContext.keyManagerPassword=" + password,
+			"",
+		},
+		"\n",
+	)
+}
+
+// Imports the uploaded CA certificates into the truststore of the JDK, so that the webservice trusts servers signed by
+// them, e.g. internal services with a private CA
+func getCommandsImportingTrustedCas(homeDir string, trustedCas int) []string {
+	var commands []string
+	for i := 0; i < trustedCas; i++ {
+		caPath := filepath.Join(homeDir, trustedCaFilename(i))
+		commands = append(commands, ssl.CommandsImportingTrustedCa(caPath, fmt.Sprintf("trusted-ca-%d", i))...)
+		commands = append(commands, fmt.Sprintf("rm %s", caPath))
 	}
+	return commands
 }
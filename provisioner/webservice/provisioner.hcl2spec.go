@@ -3,6 +3,7 @@
 package webservice
 
 import (
+	ssl "github.com/QubitPi/packer-plugin-qubitpi/provisioner/ssl-provisioner"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -10,8 +11,50 @@ import (
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
-	WarSource *string `mapstructure:"warSource" required:"true" cty:"warSource" hcl:"warSource"`
-	HomeDir   *string `mapstructure:"homeDir" required:"false" cty:"homeDir" hcl:"homeDir"`
+	WarSource           *string              `mapstructure:"warSource" required:"false" cty:"warSource" hcl:"warSource"`
+	HomeDir             *string              `mapstructure:"homeDir" required:"false" cty:"homeDir" hcl:"homeDir"`
+	JarSource           *string              `mapstructure:"jarSource" required:"false" cty:"jarSource" hcl:"jarSource"`
+	JarHttpPort         *string              `mapstructure:"jarHttpPort" required:"false" cty:"jarHttpPort" hcl:"jarHttpPort"`
+	ApplicationConfig   *string              `mapstructure:"applicationConfig" required:"false" cty:"applicationConfig" hcl:"applicationConfig"`
+	Environment         map[string]string    `mapstructure:"environment" required:"false" cty:"environment" hcl:"environment"`
+	JavaVersion         *string              `mapstructure:"javaVersion" required:"false" cty:"javaVersion" hcl:"javaVersion"`
+	JavaDistribution    *string              `mapstructure:"javaDistribution" required:"false" cty:"javaDistribution" hcl:"javaDistribution"`
+	JavaPackage         *string              `mapstructure:"javaPackage" required:"false" cty:"javaPackage" hcl:"javaPackage"`
+	JavaInstall         *string              `mapstructure:"javaInstall" required:"false" cty:"javaInstall" hcl:"javaInstall"`
+	ServletContainer    *string              `mapstructure:"servletContainer" required:"false" cty:"servletContainer" hcl:"servletContainer"`
+	JettyVersion        *string              `mapstructure:"jettyVersion" required:"false" cty:"jettyVersion" hcl:"jettyVersion"`
+	JettyModules        []string             `mapstructure:"jettyModules" required:"false" cty:"jettyModules" hcl:"jettyModules"`
+	TomcatVersion       *string              `mapstructure:"tomcatVersion" required:"false" cty:"tomcatVersion" hcl:"tomcatVersion"`
+	TomcatHttpPort      *string              `mapstructure:"tomcatHttpPort" required:"false" cty:"tomcatHttpPort" hcl:"tomcatHttpPort"`
+	JettyHttpPort       *string              `mapstructure:"jettyHttpPort" required:"false" cty:"jettyHttpPort" hcl:"jettyHttpPort"`
+	JvmOptions          []string             `mapstructure:"jvmOptions" required:"false" cty:"jvmOptions" hcl:"jvmOptions"`
+	SslCertBase64       *string              `mapstructure:"sslCertBase64" required:"false" cty:"sslCertBase64" hcl:"sslCertBase64"`
+	SslCertKeyBase64    *string              `mapstructure:"sslCertKeyBase64" required:"false" cty:"sslCertKeyBase64" hcl:"sslCertKeyBase64"`
+	KeystoreType        *string              `mapstructure:"keystoreType" required:"false" cty:"keystoreType" hcl:"keystoreType"`
+	KeystorePassword    *string              `mapstructure:"keystorePassword" required:"false" cty:"keystorePassword" hcl:"keystorePassword"`
+	JettyHttps          *bool                `mapstructure:"jettyHttps" required:"false" cty:"jettyHttps" hcl:"jettyHttps"`
+	JettyHttpsPort      *string              `mapstructure:"jettyHttpsPort" required:"false" cty:"jettyHttpsPort" hcl:"jettyHttpsPort"`
+	TrustedCaBase64     *string              `mapstructure:"trustedCaBase64" required:"false" cty:"trustedCaBase64" hcl:"trustedCaBase64"`
+	WebserviceDomain    *string              `mapstructure:"webserviceDomain" required:"false" cty:"webserviceDomain" hcl:"webserviceDomain"`
+	PrivatePaths        []string             `mapstructure:"privatePaths" required:"false" cty:"privatePaths" hcl:"privatePaths"`
+	ProxyBackend        *string              `mapstructure:"proxyBackend" required:"false" cty:"proxyBackend" hcl:"proxyBackend"`
+	TlsProfile          *string              `mapstructure:"tlsProfile" required:"false" cty:"tlsProfile" hcl:"tlsProfile"`
+	HstsPreload         *bool                `mapstructure:"hstsPreload" required:"false" cty:"hstsPreload" hcl:"hstsPreload"`
+	OcspStapling        *bool                `mapstructure:"ocspStapling" required:"false" cty:"ocspStapling" hcl:"ocspStapling"`
+	Resolver            *string              `mapstructure:"resolver" required:"false" cty:"resolver" hcl:"resolver"`
+	NginxTemplate       *string              `mapstructure:"nginxTemplate" required:"false" cty:"nginxTemplate" hcl:"nginxTemplate"`
+	NginxTemplateVars   map[string]string    `mapstructure:"nginxTemplateVars" required:"false" cty:"nginxTemplateVars" hcl:"nginxTemplateVars"`
+	ProxyConnectTimeout *string              `mapstructure:"proxyConnectTimeout" required:"false" cty:"proxyConnectTimeout" hcl:"proxyConnectTimeout"`
+	ProxySendTimeout    *string              `mapstructure:"proxySendTimeout" required:"false" cty:"proxySendTimeout" hcl:"proxySendTimeout"`
+	ProxyReadTimeout    *string              `mapstructure:"proxyReadTimeout" required:"false" cty:"proxyReadTimeout" hcl:"proxyReadTimeout"`
+	ProxyBuffering      *bool                `mapstructure:"proxyBuffering" required:"false" cty:"proxyBuffering" hcl:"proxyBuffering"`
+	ProxyWebSocket      *bool                `mapstructure:"proxyWebSocket" required:"false" cty:"proxyWebSocket" hcl:"proxyWebSocket"`
+	ClientMaxBodySize   *string              `mapstructure:"clientMaxBodySize" required:"false" cty:"clientMaxBodySize" hcl:"clientMaxBodySize"`
+	SecurityHeaders     map[string]string    `mapstructure:"securityHeaders" required:"false" cty:"securityHeaders" hcl:"securityHeaders"`
+	RateLimit           *string              `mapstructure:"rateLimit" required:"false" cty:"rateLimit" hcl:"rateLimit"`
+	RateLimitBurst      *string              `mapstructure:"rateLimitBurst" required:"false" cty:"rateLimitBurst" hcl:"rateLimitBurst"`
+	AccessRules         []ssl.FlatAccessRule `mapstructure:"accessRule" required:"false" cty:"accessRule" hcl:"accessRule"`
+	ClientCaBase64      *string              `mapstructure:"clientCaBase64" required:"false" cty:"clientCaBase64" hcl:"clientCaBase64"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -26,8 +69,50 @@ func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec }
 // The decoded values from this spec will then be applied to a FlatConfig.
 func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"warSource": &hcldec.AttrSpec{Name: "warSource", Type: cty.String, Required: false},
-		"homeDir":   &hcldec.AttrSpec{Name: "homeDir", Type: cty.String, Required: false},
+		"warSource":           &hcldec.AttrSpec{Name: "warSource", Type: cty.String, Required: false},
+		"homeDir":             &hcldec.AttrSpec{Name: "homeDir", Type: cty.String, Required: false},
+		"jarSource":           &hcldec.AttrSpec{Name: "jarSource", Type: cty.String, Required: false},
+		"jarHttpPort":         &hcldec.AttrSpec{Name: "jarHttpPort", Type: cty.String, Required: false},
+		"applicationConfig":   &hcldec.AttrSpec{Name: "applicationConfig", Type: cty.String, Required: false},
+		"environment":         &hcldec.AttrSpec{Name: "environment", Type: cty.Map(cty.String), Required: false},
+		"javaVersion":         &hcldec.AttrSpec{Name: "javaVersion", Type: cty.String, Required: false},
+		"javaDistribution":    &hcldec.AttrSpec{Name: "javaDistribution", Type: cty.String, Required: false},
+		"javaPackage":         &hcldec.AttrSpec{Name: "javaPackage", Type: cty.String, Required: false},
+		"javaInstall":         &hcldec.AttrSpec{Name: "javaInstall", Type: cty.String, Required: false},
+		"servletContainer":    &hcldec.AttrSpec{Name: "servletContainer", Type: cty.String, Required: false},
+		"jettyVersion":        &hcldec.AttrSpec{Name: "jettyVersion", Type: cty.String, Required: false},
+		"jettyModules":        &hcldec.AttrSpec{Name: "jettyModules", Type: cty.List(cty.String), Required: false},
+		"tomcatVersion":       &hcldec.AttrSpec{Name: "tomcatVersion", Type: cty.String, Required: false},
+		"tomcatHttpPort":      &hcldec.AttrSpec{Name: "tomcatHttpPort", Type: cty.String, Required: false},
+		"jettyHttpPort":       &hcldec.AttrSpec{Name: "jettyHttpPort", Type: cty.String, Required: false},
+		"jvmOptions":          &hcldec.AttrSpec{Name: "jvmOptions", Type: cty.List(cty.String), Required: false},
+		"sslCertBase64":       &hcldec.AttrSpec{Name: "sslCertBase64", Type: cty.String, Required: false},
+		"sslCertKeyBase64":    &hcldec.AttrSpec{Name: "sslCertKeyBase64", Type: cty.String, Required: false},
+		"keystoreType":        &hcldec.AttrSpec{Name: "keystoreType", Type: cty.String, Required: false},
+		"keystorePassword":    &hcldec.AttrSpec{Name: "keystorePassword", Type: cty.String, Required: false},
+		"jettyHttps":          &hcldec.AttrSpec{Name: "jettyHttps", Type: cty.Bool, Required: false},
+		"jettyHttpsPort":      &hcldec.AttrSpec{Name: "jettyHttpsPort", Type: cty.String, Required: false},
+		"trustedCaBase64":     &hcldec.AttrSpec{Name: "trustedCaBase64", Type: cty.String, Required: false},
+		"webserviceDomain":    &hcldec.AttrSpec{Name: "webserviceDomain", Type: cty.String, Required: false},
+		"privatePaths":        &hcldec.AttrSpec{Name: "privatePaths", Type: cty.List(cty.String), Required: false},
+		"proxyBackend":        &hcldec.AttrSpec{Name: "proxyBackend", Type: cty.String, Required: false},
+		"tlsProfile":          &hcldec.AttrSpec{Name: "tlsProfile", Type: cty.String, Required: false},
+		"hstsPreload":         &hcldec.AttrSpec{Name: "hstsPreload", Type: cty.Bool, Required: false},
+		"ocspStapling":        &hcldec.AttrSpec{Name: "ocspStapling", Type: cty.Bool, Required: false},
+		"resolver":            &hcldec.AttrSpec{Name: "resolver", Type: cty.String, Required: false},
+		"nginxTemplate":       &hcldec.AttrSpec{Name: "nginxTemplate", Type: cty.String, Required: false},
+		"nginxTemplateVars":   &hcldec.AttrSpec{Name: "nginxTemplateVars", Type: cty.Map(cty.String), Required: false},
+		"proxyConnectTimeout": &hcldec.AttrSpec{Name: "proxyConnectTimeout", Type: cty.String, Required: false},
+		"proxySendTimeout":    &hcldec.AttrSpec{Name: "proxySendTimeout", Type: cty.String, Required: false},
+		"proxyReadTimeout":    &hcldec.AttrSpec{Name: "proxyReadTimeout", Type: cty.String, Required: false},
+		"proxyBuffering":      &hcldec.AttrSpec{Name: "proxyBuffering", Type: cty.Bool, Required: false},
+		"proxyWebSocket":      &hcldec.AttrSpec{Name: "proxyWebSocket", Type: cty.Bool, Required: false},
+		"clientMaxBodySize":   &hcldec.AttrSpec{Name: "clientMaxBodySize", Type: cty.String, Required: false},
+		"securityHeaders":     &hcldec.AttrSpec{Name: "securityHeaders", Type: cty.Map(cty.String), Required: false},
+		"rateLimit":           &hcldec.AttrSpec{Name: "rateLimit", Type: cty.String, Required: false},
+		"rateLimitBurst":      &hcldec.AttrSpec{Name: "rateLimitBurst", Type: cty.String, Required: false},
+		"accessRule":          &hcldec.BlockListSpec{TypeName: "accessRule", Nested: hcldec.ObjectSpec((*ssl.FlatAccessRule)(nil).HCL2Spec())},
+		"clientCaBase64":      &hcldec.AttrSpec{Name: "clientCaBase64", Type: cty.String, Required: false},
 	}
 	return s
 }
@@ -0,0 +1,160 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package webservice
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//go:embed test-fixtures/jetty.service
+var expectedUnit string
+
+const testCertificate string = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+
+func TestValidate(t *testing.T) {
+	cert := base64.StdEncoding.EncodeToString([]byte(testCertificate))
+
+	war := "my-webservice.war"
+
+	data := []struct {
+		name   string
+		config Config
+		error  string
+	}{
+		{"no TLS", Config{WarSource: war}, ""},
+		{"keystore", Config{WarSource: war, SslCertBase64: cert, SslCertKeyBase64: cert, KeystorePassword: "changeit", JettyHttps: true}, ""},
+		{"trusted CA", Config{WarSource: war, TrustedCaBase64: cert}, ""},
+		{"cert without key", Config{WarSource: war, SslCertBase64: cert, KeystorePassword: "changeit"}, "must be configured together"},
+		{"short password", Config{WarSource: war, SslCertBase64: cert, SslCertKeyBase64: cert, KeystorePassword: "12345"}, "at least 6 characters"},
+		{"HTTPS without cert", Config{WarSource: war, JettyHttps: true}, "jettyHttps requires sslCertBase64"},
+		{"JVM options", Config{WarSource: war, JettyHttpPort: "9090", JvmOptions: []string{"-Xmx1g", "-Dfile.encoding=UTF-8"}}, ""},
+		{"invalid HTTP port", Config{WarSource: war, JettyHttpPort: "http"}, "invalid jettyHttpPort"},
+		{"HTTP port of HTTPS", Config{WarSource: war, SslCertBase64: cert, SslCertKeyBase64: cert, KeystorePassword: "changeit", JettyHttps: true, JettyHttpPort: "8443"}, "must differ"},
+		{"invalid JVM option", Config{WarSource: war, JvmOptions: []string{"Xmx1g"}}, "invalid jvmOption"},
+		{"invalid trusted CA", Config{WarSource: war, TrustedCaBase64: base64.StdEncoding.EncodeToString([]byte("not a certificate"))}, "invalid trustedCaBase64"},
+	}
+
+	for _, d := range data {
+		t.Run(d.name, func(t *testing.T) {
+			err := d.config.validate()
+			if d.error == "" && err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+			if d.error != "" && (err == nil || !strings.Contains(err.Error(), d.error)) {
+				t.Errorf("Expected error containing %q, got %v", d.error, err)
+			}
+		})
+	}
+}
+
+func Test_getCommandsEnablingJettyHttps(t *testing.T) {
+	expectedCommands := []string{
+		`EXIT_CLEANUPS="${EXIT_CLEANUPS:+$EXIT_CLEANUPS; }"'{ sudo shred -u -f /run/qubitpi-private/jetty-ssl.ini 2>/dev/null; } || true'; trap 'eval "$EXIT_CLEANUPS"' EXIT`,
+		"cd /opt/jetty-base",
+		"java -jar $JETTY_HOME/start.jar --add-module=ssl,https",
+		"sudo cat /run/qubitpi-private/jetty-ssl.ini >> start.d/ssl.ini && sudo shred -u /run/qubitpi-private/jetty-ssl.ini",
+		"chmod 600 start.d/ssl.ini",
+		"cd /home/ubuntu",
+	}
+
+	if actualCommands := getCommandsEnablingJettyHttps("/home/ubuntu", jettyReleases[DEFAULT_JETTY_VERSION]); !reflect.DeepEqual(expectedCommands, actualCommands) {
+		t.Errorf("Expected and actual commands do not match: %s\n\n%s", expectedCommands, actualCommands)
+	}
+}
+
+func Test_getJettySslIni(t *testing.T) {
+	expected := "\njetty.ssl.port=8443\njetty.sslContext.keyStorePath=etc/keystore.jks\njetty.sslContext.keyStoreType=JKS\njetty.sslContext.keyStorePassword=changeit\njetty.sslContext.keyManagerPassword=changeit\n"
+
+	if actual := getJettySslIni("8443", "JKS", "changeit"); actual != expected {
+		t.Errorf("Expected and actual ssl.ini do not match: %s\n\n%s", expected, actual)
+	}
+}
+
+func Test_getCommands(t *testing.T) {
+	config := Config{HomeDir: "/home/ubuntu", SslCertBase64: "x", JettyHttps: true}
+
+	commands := strings.Join(getCommands(config, 2), "\n")
+	for _, expected := range []string{
+		`EXIT_CLEANUPS="${EXIT_CLEANUPS:+$EXIT_CLEANUPS; }"'{ shred -u -f /home/ubuntu/keystore.crt 2>/dev/null; sudo shred -u -f /run/qubitpi-keystore/keystore.key /run/qubitpi-keystore/keystore.password /run/qubitpi-private/keystore.password 2>/dev/null; sudo rm -rf /run/qubitpi-keystore; } || true'; trap 'eval "$EXIT_CLEANUPS"' EXIT`,
+		"sudo install -d -o root -g $(id -gn) -m 750 /run/qubitpi-keystore",
+		"sudo install -o root -g $(id -gn) -m 640 /run/qubitpi-private/ssl.key /run/qubitpi-keystore/keystore.key && sudo shred -u /run/qubitpi-private/ssl.key",
+		"sudo install -o root -g $(id -gn) -m 640 /run/qubitpi-private/keystore.password /run/qubitpi-keystore/keystore.password && sudo shred -u /run/qubitpi-private/keystore.password",
+		"-inkey /run/qubitpi-keystore/keystore.key -name jetty -out /opt/jetty-base/etc/keystore.p12 -passout file:/run/qubitpi-keystore/keystore.password",
+		"shred -u /home/ubuntu/keystore.crt && sudo shred -u /run/qubitpi-keystore/keystore.key /run/qubitpi-keystore/keystore.password && sudo rm -rf /run/qubitpi-keystore",
+		"--add-module=ssl,https",
+		"sudo keytool -importcert -noprompt -cacerts -storepass changeit -alias trusted-ca-1 -file /home/ubuntu/trusted-ca-1.crt",
+	} {
+		if !strings.Contains(commands, expected) {
+			t.Errorf("Expected %q in commands: %s", expected, commands)
+		}
+	}
+
+	if plain := getCommands(Config{HomeDir: "/home/ubuntu"}, 0); strings.Contains(strings.Join(plain, "\n"), "keystore") {
+		t.Errorf("Expected no keystore without a certificate: %s", plain)
+	}
+}
+
+func Test_getPrivateUploads(t *testing.T) {
+	config := Config{
+		WarSource:        "my-webservice.war",
+		SslCertBase64:    base64.StdEncoding.EncodeToString([]byte("certificate")),
+		SslCertKeyBase64: base64.StdEncoding.EncodeToString([]byte("private key")),
+		KeystorePassword: "changeit",
+		JettyHttps:       true,
+	}
+
+	uploads, err := config.getUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for filename, content := range uploads {
+		if content == "private key" || strings.Contains(content, "changeit") {
+			t.Errorf("Expected neither the key nor the password among the uploads to the home directory, got '%s'", filename)
+		}
+	}
+
+	privateUploads, err := config.getPrivateUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if privateUploads["ssl.key"] != "private key" || privateUploads[keystorePasswordFilename] != "changeit" {
+		t.Errorf("Expected the key and password to be staged, got %v", privateUploads)
+	}
+	if !strings.Contains(privateUploads[jettySslIniFilename], "jetty.sslContext.keyStorePassword=changeit") {
+		t.Errorf("Expected the keystore settings of Jetty to be staged, got %v", privateUploads)
+	}
+}
+
+func Test_getService(t *testing.T) {
+	actualUnit := getService(Config{}.httpHost(), Config{}.jettyHttpPort(), Config{}.jvmOptions()).Render()
+
+	if actualUnit != expectedUnit {
+		t.Errorf("Expected and actual unit do not match: %s\n\n%s", expectedUnit, actualUnit)
+	}
+
+	if unit := getService("", "9090", []string{}).Render(); !strings.Contains(unit, `"$$@\"" java -Djava.io.tmpdir=`) || !strings.Contains(unit, "-Djetty.http.port=9090\n") {
+		t.Errorf("Expected no JVM options and port 9090 in unit: %s", unit)
+	}
+}
+
+func Test_getCommandsInstallingService(t *testing.T) {
+	commands := strings.Join(getCommandsInstallingService("/home/ubuntu", "8080"), "\n")
+
+	for _, expected := range []string{
+		"sudo useradd --system --user-group --no-create-home --shell /usr/sbin/nologin jetty",
+		"sudo chown -R jetty:jetty /opt/jetty-base",
+		"echo \"JAVA_HOME=$JAVA_HOME\" | sudo tee /etc/default/jetty > /dev/null",
+		"sudo install -o root -g root -m 644 /home/ubuntu/jetty.service /etc/systemd/system/jetty.service",
+		"sudo systemctl enable jetty && sudo systemctl restart jetty",
+		"curl -sS -o /dev/null http://127.0.0.1:8080/",
+	} {
+		if !strings.Contains(commands, expected) {
+			t.Errorf("Expected %q in commands: %s", expected, commands)
+		}
+	}
+}
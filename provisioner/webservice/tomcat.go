@@ -0,0 +1,155 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package webservice
+
+import (
+	"fmt"
+	"github.com/QubitPi/packer-plugin-qubitpi/provisioner/systemd"
+	"path/filepath"
+	"strings"
+)
+
+// TOMCAT_SERVICE_NAME The name of the systemd service running Tomcat
+const TOMCAT_SERVICE_NAME string = "tomcat"
+
+// TOMCAT_SERVICE_USER The dedicated system user running Tomcat
+const TOMCAT_SERVICE_USER string = "tomcat"
+
+// TOMCAT_HOME The directory in remote machine that Tomcat is installed to, which also holds its configuration, webapp
+// and keystore
+const TOMCAT_HOME string = "/opt/tomcat"
+
+// DEFAULT_TOMCAT_HTTP_PORT Default port that Tomcat serves HTTP on
+const DEFAULT_TOMCAT_HTTP_PORT string = "8080"
+
+const tomcatKeystoreAlias string = "tomcat"
+const tomcatServiceFilename string = TOMCAT_SERVICE_NAME + ".service"
+
+// The packages that Tomcat accesses reflectively, which the JDK must open to it, as catalina.sh does
+var tomcatOpenedPackages = []string{
+	"java.base/java.lang",
+	"java.base/java.io",
+	"java.base/java.util",
+	"java.base/java.util.concurrent",
+	"java.rmi/sun.rmi.transport",
+}
+
+func (c Config) tomcatHttpPort() string {
+	if c.TomcatHttpPort == "" {
+		return DEFAULT_TOMCAT_HTTP_PORT
+	}
+	return c.TomcatHttpPort
+}
+
+// Install Tomcat of a major version to TOMCAT_HOME, which is set up by the current user and handed over to
+// TOMCAT_SERVICE_USER by getCommandsInstallingTomcatService(). The distribution is verified against its checksum on the
+// Apache archive. The default webapps are replaced by the WAR file, the shutdown port is disabled, since systemd stops
+// Tomcat, and the HTTP connector listens on a port bound to a host, or to all interfaces if the host is empty. Behind
+// the TLS front end, the X-Forwarded-* headers of the proxy are honored
+func getCommandsInstallingTomcat(homeDir string, version string, httpHost string, httpPort string) []string {
+	release := tomcatReleases[version]
+	tarballUrl := fmt.Sprintf(
+		"https://archive.apache.org/dist/tomcat/tomcat-%s/v%s/bin/apache-tomcat-%s.tar.gz",
+		version,
+		release.version,
+		release.version,
+	)
+	serverXml := filepath.Join(TOMCAT_HOME, "conf", "server.xml")
+
+	connector := fmt.Sprintf(`port="%s"`, httpPort)
+	if httpHost != "" {
+		connector = fmt.Sprintf(`port="%s" address="%s"`, httpPort, httpHost)
+	}
+
+	commands := []string{
+		"sudo apt install -y curl",
+		fmt.Sprintf("TOMCAT_TARBALL_SHA512=$(curl -fsSL %s.sha512 | awk '{print $1}')", tarballUrl),
+		fmt.Sprintf("cd /tmp && curl -fsSL -o tomcat.tar.gz %s && echo \"$TOMCAT_TARBALL_SHA512  tomcat.tar.gz\" | sha512sum -c -", tarballUrl),
+		fmt.Sprintf(
+			"sudo rm -rf %s && sudo mkdir -p %s && sudo chown $(id -un) %s && tar -xzf tomcat.tar.gz -C %s --strip-components=1",
+			TOMCAT_HOME,
+			TOMCAT_HOME,
+			TOMCAT_HOME,
+			TOMCAT_HOME,
+		),
+		"rm tomcat.tar.gz",
+		fmt.Sprintf("rm -rf %s/webapps/* && mv %s/ROOT.war %s/webapps/ROOT.war", TOMCAT_HOME, homeDir, TOMCAT_HOME),
+		fmt.Sprintf(`sed -i 's|<Server port="8005"|<Server port="-1"|' %s`, serverXml),
+		fmt.Sprintf(`sed -i 's|<Connector port="8080" protocol="HTTP/1.1"|<Connector %s protocol="HTTP/1.1"|' %s`, connector, serverXml),
+	}
+	if httpHost != "" {
+		commands = append(
+			commands,
+			fmt.Sprintf(
+				`sed -i 's|</Host>|  <Valve className="org.apache.catalina.valves.RemoteIpValve" protocolHeader="X-Forwarded-Proto" />\n      </Host>|' %s`,
+				serverXml,
+			),
+		)
+	}
+	return append(commands, fmt.Sprintf("cd %s", homeDir))
+}
+
+// Returns the systemd service running Tomcat at boot as TOMCAT_SERVICE_USER with the JVM options. The bootstrap class is
+// started with the same system properties as catalina.sh, so that Tomcat logs to its "logs" directory and to the journal.
+//
+// systemd does not expand variables in the path of a command, so the java of JAVA_HOME, which the environment file
+// sets, is started through the shell
+func getTomcatService(jvmOptions []string) systemd.Service {
+	args := []string{"/bin/sh", "-c", `exec "$JAVA_HOME/bin/java" "$@"`, "java"}
+	args = append(args, jvmOptions...)
+	for _, pkg := range tomcatOpenedPackages {
+		args = append(args, "--add-opens="+pkg+"=ALL-UNNAMED")
+	}
+	args = append(
+		args,
+		"-Djava.util.logging.config.file="+filepath.Join(TOMCAT_HOME, "conf", "logging.properties"),
+		"-Djava.util.logging.manager=org.apache.juli.ClassLoaderLogManager",
+		"-Djdk.tls.ephemeralDHKeySize=2048",
+		"-Djava.protocol.handler.pkgs=org.apache.catalina.webresources",
+		"-Dcatalina.home="+TOMCAT_HOME,
+		"-Dcatalina.base="+TOMCAT_HOME,
+		"-Djava.io.tmpdir="+filepath.Join(TOMCAT_HOME, "temp"),
+		"-classpath", strings.Join(
+			[]string{filepath.Join(TOMCAT_HOME, "bin", "bootstrap.jar"), filepath.Join(TOMCAT_HOME, "bin", "tomcat-juli.jar")},
+			":",
+		),
+		"org.apache.catalina.startup.Bootstrap",
+		"start",
+	)
+
+	return systemd.Service{
+		Description:      "Tomcat webservice",
+		After:            []string{"network-online.target"},
+		User:             TOMCAT_SERVICE_USER,
+		Group:            TOMCAT_SERVICE_USER,
+		WorkingDirectory: TOMCAT_HOME,
+		EnvironmentFiles: []string{systemd.EnvironmentFileDst(TOMCAT_SERVICE_NAME)},
+		ExecStart:        systemd.ExecArgs(args...),
+		Restart:          "always",
+		RestartSec:       "5",
+		Directives: [][2]string{
+			{"NoNewPrivileges", "true"},
+			{"ProtectSystem", "full"},
+			{"ProtectHome", "true"},
+			{"PrivateTmp", "true"},
+		},
+	}
+}
+
+// Returns the commands handing TOMCAT_HOME over to TOMCAT_SERVICE_USER and starting the service running Tomcat.
+// JAVA_HOME of the installed JDK is written to the environment file of the service. The build fails unless Tomcat
+// answers on its port, with any status, since the webservice may have no resource at "/"
+func getCommandsInstallingTomcatService(homeDir string, httpPort string) []string {
+	environmentFile := systemd.EnvironmentFileDst(TOMCAT_SERVICE_NAME)
+
+	commands := systemd.CommandsCreatingUser(TOMCAT_SERVICE_USER)
+	commands = append(
+		commands,
+		fmt.Sprintf("sudo chown -R %s:%s %s", TOMCAT_SERVICE_USER, TOMCAT_SERVICE_USER, TOMCAT_HOME),
+		fmt.Sprintf("echo \"JAVA_HOME=$JAVA_HOME\" | sudo tee %s > /dev/null", environmentFile),
+	)
+	commands = append(commands, systemd.CommandsInstallingUnit(filepath.Join(homeDir, tomcatServiceFilename), TOMCAT_SERVICE_NAME)...)
+	commands = append(commands, systemd.CommandsStartingService(TOMCAT_SERVICE_NAME)...)
+	return append(commands, systemd.CommandsCheckingReachable(TOMCAT_SERVICE_NAME, "http://127.0.0.1:"+httpPort+"/")...)
+}
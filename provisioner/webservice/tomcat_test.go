@@ -0,0 +1,66 @@
+// Copyright (c) Jiaqi Liu
+// SPDX-License-Identifier: MPL-2.0
+
+package webservice
+
+import (
+	_ "embed"
+	"strings"
+	"testing"
+)
+
+//go:embed test-fixtures/tomcat.service
+var expectedTomcatUnit string
+
+func Test_getTomcatService(t *testing.T) {
+	actualUnit := getTomcatService(DEFAULT_JVM_OPTIONS).Render()
+	if actualUnit != expectedTomcatUnit {
+		t.Errorf("Expected and actual unit do not match: %s\n\n%s", expectedTomcatUnit, actualUnit)
+	}
+}
+
+func Test_getCommandsInTomcatMode(t *testing.T) {
+	config := Config{HomeDir: "/home/ubuntu", WarSource: "my-webservice.war", ServletContainer: TomcatContainer, TomcatVersion: "9", SslCertBase64: "x", KeystorePassword: "changeit"}
+	tarball := "https://archive.apache.org/dist/tomcat/tomcat-9/v9.0.86/bin/apache-tomcat-9.0.86.tar.gz"
+
+	commands := strings.Join(getCommands(config, 0), "\n")
+	for _, expected := range []string{
+		"TOMCAT_TARBALL_SHA512=$(curl -fsSL " + tarball + ".sha512 | awk '{print $1}')",
+		"cd /tmp && curl -fsSL -o tomcat.tar.gz " + tarball + " && echo \"$TOMCAT_TARBALL_SHA512  tomcat.tar.gz\" | sha512sum -c -",
+		"rm -rf /opt/tomcat/webapps/* && mv /home/ubuntu/ROOT.war /opt/tomcat/webapps/ROOT.war",
+		`sed -i 's|<Server port="8005"|<Server port="-1"|' /opt/tomcat/conf/server.xml`,
+		`sed -i 's|<Connector port="8080" protocol="HTTP/1.1"|<Connector port="8080" protocol="HTTP/1.1"|' /opt/tomcat/conf/server.xml`,
+		"-out /opt/tomcat/etc/keystore.p12 -passout file:/run/qubitpi-keystore/keystore.password",
+		"sudo useradd --system --user-group --no-create-home --shell /usr/sbin/nologin tomcat",
+		"sudo chown -R tomcat:tomcat /opt/tomcat",
+		"echo \"JAVA_HOME=$JAVA_HOME\" | sudo tee /etc/default/tomcat > /dev/null",
+		"sudo systemctl enable tomcat && sudo systemctl restart tomcat",
+		"curl -sS -o /dev/null http://127.0.0.1:8080/",
+	} {
+		if !strings.Contains(commands, expected) {
+			t.Errorf("Expected %q in commands: %s", expected, commands)
+		}
+	}
+
+	if strings.Contains(commands, "jetty") || strings.Contains(commands, "RemoteIpValve") {
+		t.Errorf("Expected neither Jetty nor the proxy valve in Tomcat mode without front end: %s", commands)
+	}
+
+	uploads, err := Config{WarSource: config.WarSource, ServletContainer: TomcatContainer}.getUploads()
+	if err != nil || uploads[tomcatServiceFilename] == "" || uploads[serviceFilename] != "" {
+		t.Errorf("Expected the Tomcat unit, but not the Jetty unit, in uploads: %v, %v", uploads, err)
+	}
+}
+
+func Test_getCommandsInstallingTomcatBehindFrontend(t *testing.T) {
+	commands := strings.Join(getCommandsInstallingTomcat("/home/ubuntu", "10", "127.0.0.1", "9090"), "\n")
+	for _, expected := range []string{
+		"https://archive.apache.org/dist/tomcat/tomcat-10/v10.1.19/bin/apache-tomcat-10.1.19.tar.gz",
+		`sed -i 's|<Connector port="8080" protocol="HTTP/1.1"|<Connector port="9090" address="127.0.0.1" protocol="HTTP/1.1"|' /opt/tomcat/conf/server.xml`,
+		`<Valve className="org.apache.catalina.valves.RemoteIpValve" protocolHeader="X-Forwarded-Proto" />`,
+	} {
+		if !strings.Contains(commands, expected) {
+			t.Errorf("Expected %q in commands: %s", expected, commands)
+		}
+	}
+}